@@ -0,0 +1,249 @@
+package irnc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+	"github.com/warthog618/gpiod"
+)
+
+const backlightCheckInterval = 200 * time.Millisecond
+
+// Screen backlight driver
+type BacklightBackend interface {
+	// brightness from 0 to 1
+	SetBrightness(brightness float64) error
+	Close() error
+}
+
+// Hardware PWM exposed via sysfs
+type SysfsPWMBacklight struct {
+	Chip, Channel uint
+	Period time.Duration
+	initialized bool
+}
+
+// Write value to sysfs attribute
+func writeSysfsValue(path string, value interface{}) error {
+	return os.WriteFile(path, []byte(fmt.Sprint(value)), 0644)
+}
+
+// Export and enable PWM channel on first use, then set duty cycle
+func (b *SysfsPWMBacklight) SetBrightness(brightness float64) error {
+	chipDir := fmt.Sprintf("/sys/class/pwm/pwmchip%d", b.Chip)
+	channelDir := filepath.Join(chipDir, fmt.Sprintf("pwm%d", b.Channel))
+	if !b.initialized {
+		if _, err := os.Stat(channelDir); os.IsNotExist(err) {
+			err = writeSysfsValue(filepath.Join(chipDir, "export"), b.Channel)
+			if err != nil { return errors.New(fmt.Sprintf("PWM channel export error: %v", err)) }
+		}
+		// duty cycle must never exceed period, so it's reset before period change
+		writeSysfsValue(filepath.Join(channelDir, "duty_cycle"), 0)
+		err := writeSysfsValue(filepath.Join(channelDir, "period"), b.Period.Nanoseconds())
+		if err != nil { return errors.New(fmt.Sprintf("PWM period setting error: %v", err)) }
+		err = writeSysfsValue(filepath.Join(channelDir, "enable"), 1)
+		if err != nil { return errors.New(fmt.Sprintf("PWM enabling error: %v", err)) }
+		b.initialized = true
+	}
+	return writeSysfsValue(filepath.Join(channelDir, "duty_cycle"), int64(float64(b.Period.Nanoseconds()) * brightness))
+}
+
+// PWM channel stays enabled, so screen stays lit after exit
+func (b *SysfsPWMBacklight) Close() error {
+	return nil
+}
+
+// Backlight switched on/off by GPIO line (any non-zero brightness is full brightness)
+type GPIOBacklight struct {
+	Chip string
+	Line int
+	chip *gpiod.Chip
+	line *gpiod.Line
+}
+
+// Request output line on first use, then set its level
+func (b *GPIOBacklight) SetBrightness(brightness float64) error {
+	value := 0
+	if brightness > 0 { value = 1 }
+	if b.line == nil {
+		chip, err := gpiod.NewChip(b.Chip, gpiod.WithConsumer("irnc"))
+		if err != nil { return errors.New(fmt.Sprintf("GPIO chip %s opening error: %v", b.Chip, err)) }
+		line, err := chip.RequestLine(b.Line, gpiod.AsOutput(value))
+		if err != nil {
+			chip.Close()
+			return errors.New(fmt.Sprintf("GPIO line %d request error: %v", b.Line, err))
+		}
+		b.chip, b.line = chip, line
+		return nil
+	}
+	return b.line.SetValue(value)
+}
+
+// Release GPIO line
+func (b *GPIOBacklight) Close() error {
+	if b.line == nil { return nil }
+	b.line.Close()
+	return b.chip.Close()
+}
+
+// Applies brightness from live configuration, dims screen after inactivity
+type backlightController struct {
+	backend BacklightBackend
+	config BacklightConfig
+	lastActivity time.Time
+	dimmed bool
+	// dim brightness is set on backend, screen which stays lit (backend failure) isn't reported dimmed
+	dimApplied bool
+	activityMtx sync.Mutex
+	wakeCh chan struct{}
+	cancel context.CancelFunc
+	done chan struct{}
+}
+
+var backlight *backlightController
+var backlightMtx sync.Mutex
+
+// Get backlight backend selected by configuration (nil if disabled)
+func newBacklightBackend(config BacklightConfig) (BacklightBackend, error) {
+	switch config.Backend {
+		case "":
+			return nil, nil
+		case "pwm":
+			return &SysfsPWMBacklight{Chip: config.PWMChip, Channel: config.PWMChannel, Period: config.PWMPeriod}, nil
+		case "gpio":
+			return &GPIOBacklight{Chip: config.GPIOChip, Line: config.GPIOLine}, nil
+		default:
+			return nil, errors.New(fmt.Sprintf("Unknown backlight backend %q", config.Backend))
+	}
+}
+
+// Compute brightness to apply and whether it's dimmed one
+func (c *backlightController) targetBrightness() (float64, bool) {
+	lc := GetLiveConfig()
+	percent := lc.BrightnessPercent
+	if lc.NightMode && percent > c.config.NightBrightnessPercent {
+		percent = c.config.NightBrightnessPercent
+	}
+	c.activityMtx.Lock()
+	dimmed := c.dimmed
+	c.activityMtx.Unlock()
+	if dimmed && percent > c.config.DimBrightnessPercent {
+		percent = c.config.DimBrightnessPercent
+	}
+	return float64(percent) / 100, dimmed
+}
+
+// Update dim state by inactivity time
+func (c *backlightController) checkActivity() {
+	c.activityMtx.Lock()
+	defer c.activityMtx.Unlock()
+	dimmed := c.config.AutoDimTimeout > 0 && time.Since(c.lastActivity) > c.config.AutoDimTimeout
+	if dimmed != c.dimmed {
+		log.Println("Screen dimmed:", dimmed)
+		c.dimmed = dimmed
+	}
+}
+
+// Keep backend in sync with target brightness until context is done
+func (c *backlightController) run(ctx context.Context) {
+	defer close(c.done)
+	defer c.backend.Close()
+	ticker := time.NewTicker(backlightCheckInterval)
+	defer ticker.Stop()
+	applied := -1.0
+	var lastErr string
+	for {
+		c.checkActivity()
+		brightness, dimmed := c.targetBrightness()
+		if brightness != applied {
+			err := c.backend.SetBrightness(brightness)
+			if err == nil {
+				applied = brightness
+				lastErr = ""
+			} else if err.Error() != lastErr {
+				// retried every check, but reported once
+				lastErr = err.Error()
+				log.Println("Backlight error:", err)
+			}
+		}
+		c.activityMtx.Lock()
+		c.dimApplied = dimmed && applied == brightness
+		c.activityMtx.Unlock()
+		select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			case <-c.wakeCh:
+		}
+	}
+}
+
+// Start backlight control in background (if enabled)
+func startBacklight(config BacklightConfig) {
+	backend, err := newBacklightBackend(config)
+	if err != nil {
+		log.Println("Backlight configuration error:", err)
+		return
+	}
+	if backend == nil { return }
+	ctx, cancel := context.WithCancel(context.Background())
+	c := &backlightController{
+		backend: backend,
+		config: config,
+		lastActivity: time.Now(),
+		wakeCh: make(chan struct{}, 1),
+		cancel: cancel,
+		done: make(chan struct{}),
+	}
+	backlightMtx.Lock()
+	backlight = c
+	backlightMtx.Unlock()
+	go c.run(ctx)
+}
+
+// Get running backlight control, nil if it's disabled
+func getBacklight() *backlightController {
+	backlightMtx.Lock()
+	defer backlightMtx.Unlock()
+	return backlight
+}
+
+// Stop backlight control
+func stopBacklight() {
+	c := getBacklight()
+	if c == nil { return }
+	c.cancel()
+	<-c.done
+	backlightMtx.Lock()
+	backlight = nil
+	backlightMtx.Unlock()
+}
+
+// Register user input (touch, key or physical button), wakes dimmed screen
+func NotifyUserActivity() {
+	c := getBacklight()
+	if c == nil { return }
+	c.activityMtx.Lock()
+	c.lastActivity = time.Now()
+	wasDimmed := c.dimmed
+	c.activityMtx.Unlock()
+	if !wasDimmed { return }
+	select {
+		case c.wakeCh<- struct{}{}:
+		default:
+	}
+}
+
+// Check whether screen is dimmed due to inactivity (and dim brightness is really set), so input only wakes it
+func BacklightDimmed() bool {
+	c := getBacklight()
+	if c == nil { return false }
+	c.activityMtx.Lock()
+	defer c.activityMtx.Unlock()
+	return c.dimApplied
+}
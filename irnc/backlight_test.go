@@ -0,0 +1,81 @@
+package irnc
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Backend remembering last brightness, optionally failing
+type fakeBacklight struct {
+	brightness float64
+	failing bool
+	mtx sync.Mutex
+}
+
+func (b *fakeBacklight) SetBrightness(brightness float64) error {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	if b.failing { return errors.New("PWM isn't available") }
+	b.brightness = brightness
+	return nil
+}
+
+func (b *fakeBacklight) Close() error {
+	return nil
+}
+
+func (b *fakeBacklight) get() float64 {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	return b.brightness
+}
+
+// Run controller of backend as global backlight until test ends
+func startTestBacklight(t *testing.T, backend BacklightBackend) {
+	liveConfigMtx.Lock()
+	prevLiveConfig := liveConfig
+	liveConfig.BrightnessPercent = 80
+	liveConfigMtx.Unlock()
+	ctx, cancel := context.WithCancel(context.Background())
+	c := &backlightController{
+		backend: backend,
+		config: BacklightConfig{AutoDimTimeout: 100 * time.Millisecond, DimBrightnessPercent: 5, NightBrightnessPercent: 10},
+		lastActivity: time.Now(),
+		wakeCh: make(chan struct{}, 1),
+		cancel: cancel,
+		done: make(chan struct{}),
+	}
+	backlightMtx.Lock()
+	backlight = c
+	backlightMtx.Unlock()
+	go c.run(ctx)
+	t.Cleanup(func() {
+		stopBacklight()
+		liveConfigMtx.Lock()
+		liveConfig = prevLiveConfig
+		liveConfigMtx.Unlock()
+	})
+}
+
+func TestBacklightDimming(t *testing.T) {
+	backend := &fakeBacklight{}
+	startTestBacklight(t, backend)
+	time.Sleep(50 * time.Millisecond)
+	if backend.get() != 0.8 || BacklightDimmed() { t.Fatal("Full brightness expected, got", backend.get(), BacklightDimmed()) }
+	time.Sleep(400 * time.Millisecond)
+	if backend.get() != 0.05 || !BacklightDimmed() { t.Fatal("Dimmed screen expected, got", backend.get(), BacklightDimmed()) }
+	// activity wakes screen without waiting for next check
+	NotifyUserActivity()
+	time.Sleep(20 * time.Millisecond)
+	if backend.get() != 0.8 || BacklightDimmed() { t.Fatal("Woken screen expected, got", backend.get(), BacklightDimmed()) }
+}
+
+func TestBacklightFailingBackend(t *testing.T) {
+	startTestBacklight(t, &fakeBacklight{failing: true})
+	time.Sleep(400 * time.Millisecond)
+	// screen stays lit, so input mustn't be swallowed as wake-up
+	if BacklightDimmed() { t.Fatal("Screen is reported dimmed although brightness isn't applied") }
+}
@@ -7,11 +7,21 @@ import (
 )
 
 type Camera interface {
+	Name() string
 	VerifyConfiguration() []error
-	Start(context.Context)
+	// start capturing in background until context is done
+	Start(context.Context) error
+	// wait until resources are released after start context is done
+	Wait()
+	LastFrameTime() time.Time
+	// frames per second received from device recently
+	FPS() float64
 	Preview() (image.Image, error)
-	SaveSnapshot(namePrefix string) error
-	SaveVideo(namePrefix string, videoDuration time.Duration) error
+	// copy current frame (preview frame even if full resolution stills are configured), file is written by Save of result
+	GrabSnapshot(namePrefix string, meta ImageMetadata, preview bool) (*Snapshot, error)
+	SaveVideo(ctx context.Context, namePrefix string, videoDuration time.Duration) error
+	VideoFileName(namePrefix string) string
+	StreamH264(ctx context.Context) (<-chan []byte, error)
 }
 
 type CameraDisposition struct {
@@ -0,0 +1,462 @@
+package irnc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Capture file name: timestamp prefix, camera suffix and extension
+var captureFileRegexp = regexp.MustCompile(`^(.+)_(n|ir)\.[0-9a-z]+$`)
+
+type CaptureSet struct {
+	Prefix string `json:"prefix"`
+	// folder relative to capture root, empty for root itself
+	Dir string `json:"dir,omitempty"`
+	Files []string `json:"files"`
+}
+
+type CameraRecordingStatus struct {
+	Filename string `json:"filename"`
+	SizeBytes int64 `json:"size_bytes"`
+	ElapsedSec float64 `json:"elapsed_sec"`
+	RemainingSec float64 `json:"remaining_sec"`
+	Finished bool `json:"finished"`
+}
+
+type RecordingStatus struct {
+	Active bool `json:"active"`
+	Prefix string `json:"prefix,omitempty"`
+	Dir string `json:"dir,omitempty"`
+	Started time.Time `json:"started,omitempty"`
+	DurationSec uint `json:"duration_sec,omitempty"`
+	// by camera name
+	Cameras map[string]CameraRecordingStatus `json:"cameras,omitempty"`
+	// estimate for configured bitrates of both cameras
+	SpaceLeftMinutes float64 `json:"space_left_minutes"`
+}
+
+type recordingSession struct {
+	status RecordingStatus
+	duration time.Duration
+	// finish time by camera name
+	finished map[string]time.Time
+	cancel context.CancelFunc
+	done chan struct{}
+}
+
+var recording *recordingSession
+var recordingMtx sync.Mutex
+// in-flight snapshots and recordings
+var capturesWg sync.WaitGroup
+// guarded by recordingMtx
+var capturesStopped bool
+// guarded by recordingMtx, set during cameras restart
+var capturesPaused bool
+
+// Get error refusing new capture during shutdown or cameras restart, nil if captures are accepted (recordingMtx must be held)
+func capturesRefused() error {
+	if capturesStopped {
+		return errors.New("Captures are stopped due to shutdown")
+	}
+	if capturesPaused {
+		return errors.New("Captures are paused due to cameras restart")
+	}
+	return nil
+}
+
+// Register new capture unless shutdown has begun
+func beginCapture() error {
+	recordingMtx.Lock()
+	defer recordingMtx.Unlock()
+	err := capturesRefused()
+	if err != nil { return err }
+	capturesWg.Add(1)
+	return nil
+}
+
+// Refuse new captures and wait for in-flight ones (recording or running sequence prevents pausing, scheduled one doesn't)
+func pauseCaptures() error {
+	recordingMtx.Lock()
+	if recording != nil {
+		recordingMtx.Unlock()
+		return errors.New("Cameras can't be restarted during recording")
+	}
+	if sequence != nil && !sequence.status.Scheduled {
+		recordingMtx.Unlock()
+		return errors.New("Cameras can't be restarted during timelapse or burst")
+	}
+	capturesPaused = true
+	recordingMtx.Unlock()
+	capturesWg.Wait()
+	return nil
+}
+
+// Accept captures again after cameras restart
+func resumeCaptures() {
+	recordingMtx.Lock()
+	capturesPaused = false
+	recordingMtx.Unlock()
+}
+
+// Refuse new captures, stop recording and wait for in-flight captures to be finalized
+func stopCaptures() {
+	recordingMtx.Lock()
+	capturesStopped = true
+	recordingMtx.Unlock()
+	err := StopRecording()
+	if err == nil { log.Println("Recording stopped due to shutdown") }
+	err = StopSequence()
+	if err == nil { log.Println("Sequence stopped due to shutdown") }
+	capturesWg.Wait()
+}
+
+// Snapshot pair being saved in background
+type SnapshotJob struct {
+	Prefix string
+	Dir string
+	// grabbed frames by camera name, read-only
+	snapshots map[string]*Snapshot
+	done chan struct{}
+	// guarded by done
+	errs []error
+}
+
+// Wait until snapshot files are written, get all errors of snapshot
+func (j *SnapshotJob) Wait() []error {
+	<-j.done
+	return j.errs
+}
+
+// Copy frames from both cameras simultaneously and save them in background, so frames aren't held up by encoding
+// Returns frame grabbing errors, saving errors are logged and published with snapshot_taken event
+func StartSnapshot() (*SnapshotJob, []error) {
+	err := beginCapture()
+	if err != nil { return nil, []error{err} }
+	now := time.Now()
+	dir, err := prepareCaptureDir(now, 0)
+	if err != nil {
+		capturesWg.Done()
+		return nil, []error{err}
+	}
+	return startSnapshotJob(dir, now.Format(timestampFormat), ImageMetadata{Time: now, Position: CurrentPosition()}, false, "")
+}
+
+// Grab frames of both cameras for begun capture and save them in background (preview frames only if requested), sequence prefix is passed to event
+func startSnapshotJob(dir, prefix string, meta ImageMetadata, preview bool, sequence string) (*SnapshotJob, []error) {
+	job := &SnapshotJob{Prefix: prefix, Dir: dir, snapshots: make(map[string]*Snapshot), done: make(chan struct{})}
+	pathPrefix := filepath.Join(CaptureRoot(), dir, job.Prefix)
+	nCam, irCam := Cameras()
+	var errs []error
+	var resultsMtx sync.Mutex
+	var wg sync.WaitGroup
+	for _, cam := range []Camera{nCam, irCam} {
+		wg.Add(1)
+		go func(cam Camera) {
+			defer wg.Done()
+			snapshot, err := cam.GrabSnapshot(pathPrefix, meta, preview)
+			resultsMtx.Lock()
+			defer resultsMtx.Unlock()
+			if err == nil {
+				job.snapshots[cam.Name()] = snapshot
+			} else {
+				errs = append(errs, errors.New(fmt.Sprintf("%s snapshot error: %v", cam.Name(), err)))
+			}
+		}(cam)
+	}
+	wg.Wait()
+	job.errs = append(job.errs, errs...)
+	var snapshots []*Snapshot
+	for _, snapshot := range job.snapshots {
+		snapshots = append(snapshots, snapshot)
+	}
+	go func() {
+		defer capturesWg.Done()
+		for _, err := range saveSnapshots(snapshots) {
+			log.Println(err)
+			job.errs = append(job.errs, err)
+		}
+		saveCapturePosition(CaptureRoot(), CaptureSet{Prefix: job.Prefix, Dir: dir}, meta.Position)
+		indexCaptureSet(dir, job.Prefix, currentCameraConfigs())
+		PublishEvent(Event{Type: EventSnapshotTaken, Prefix: job.Prefix, Dir: dir, Sequence: sequence, Errors: errorStrings(job.errs)})
+		close(job.done)
+	}()
+	return job, errs
+}
+
+// Encode snapshots in parallel
+func saveSnapshots(snapshots []*Snapshot) (errs []error) {
+	var errsMtx sync.Mutex
+	var wg sync.WaitGroup
+	for _, snapshot := range snapshots {
+		wg.Add(1)
+		go func(snapshot *Snapshot) {
+			defer wg.Done()
+			err := snapshot.Save()
+			if err == nil { return }
+			errsMtx.Lock()
+			defer errsMtx.Unlock()
+			errs = append(errs, errors.New(fmt.Sprintf("%s saving error: %v", filepath.Base(snapshot.Filename), err)))
+		}(snapshot)
+	}
+	wg.Wait()
+	return
+}
+
+// Take photo from both cameras simultaneously and wait until it's saved, return common name prefix
+func TakeSnapshot() (prefix string, errs []error) {
+	job, errs := StartSnapshot()
+	if job == nil { return "", errs }
+	return job.Prefix, job.Wait()
+}
+
+// Start recording video from both cameras simultaneously, returned channel is closed when recording ends
+func StartRecording(videoDuration time.Duration) (<-chan struct{}, error) {
+	recordingMtx.Lock()
+	defer recordingMtx.Unlock()
+	err := capturesRefused()
+	if err != nil { return nil, err }
+	if recording != nil {
+		return nil, errors.New("Recording is already in progress")
+	}
+	// folder isn't created for refused recording
+	now := time.Now()
+	dir, err := prepareCaptureDir(now, recordingSizeBytes(videoDuration))
+	if err != nil { return nil, err }
+	capturesWg.Add(1)
+	ctx, cancel := context.WithCancel(context.Background())
+	session := &recordingSession{
+		status: RecordingStatus{
+			Active: true,
+			Prefix: now.Format(timestampFormat),
+			Dir: dir,
+			Started: now,
+			DurationSec: uint(videoDuration / time.Second),
+		},
+		duration: videoDuration,
+		finished: make(map[string]time.Time),
+		cancel: cancel,
+		done: make(chan struct{}),
+	}
+	recording = session
+
+	nCam, irCam := Cameras()
+	var wg sync.WaitGroup
+	for _, cam := range []Camera{nCam, irCam} {
+		wg.Add(1)
+		go func(cam Camera) {
+			defer wg.Done()
+			err := cam.SaveVideo(ctx, filepath.Join(CaptureRoot(), dir, session.status.Prefix), videoDuration)
+			if err != nil { log.Printf("%s video saving error: %v", cam.Name(), err) }
+			recordingMtx.Lock()
+			session.finished[cam.Name()] = time.Now()
+			recordingMtx.Unlock()
+		}(cam)
+	}
+	PublishEvent(Event{Type: EventRecordingStarted, Prefix: session.status.Prefix, Dir: dir})
+	cameras := currentCameraConfigs()
+	position := CurrentPosition()
+	go func() {
+		wg.Wait()
+		cancel()
+		recordingMtx.Lock()
+		recording = nil
+		recordingMtx.Unlock()
+		saveCapturePosition(CaptureRoot(), CaptureSet{Prefix: session.status.Prefix, Dir: dir}, position)
+		indexCaptureSet(dir, session.status.Prefix, cameras)
+		PublishEvent(Event{Type: EventRecordingStopped, Prefix: session.status.Prefix, Dir: dir})
+		close(session.done)
+		capturesWg.Done()
+	}()
+	return session.done, nil
+}
+
+// Stop current recording ahead of time and wait for files to be finalized
+func StopRecording() error {
+	recordingMtx.Lock()
+	session := recording
+	recordingMtx.Unlock()
+	if session == nil {
+		return errors.New("No recording in progress")
+	}
+	session.cancel()
+	<-session.done
+	return nil
+}
+
+// Get free space of filesystem containing directory
+func freeSpaceBytes(dir string) (uint64, error) {
+	var stat syscall.Statfs_t
+	err := syscall.Statfs(dir, &stat)
+	if err != nil { return 0, err }
+	return uint64(stat.Bavail) * uint64(stat.Bsize), nil
+}
+
+// Combined bitrate of both cameras
+func recordingBitrate() float64 {
+	config := getAppConfig()
+	return float64(config.NConfig.Bitrate + config.IRConfig.Bitrate)
+}
+
+// Estimate size of recording from both cameras with their configured bitrates
+func recordingSizeBytes(videoDuration time.Duration) uint64 {
+	return uint64(recordingBitrate() / 8 * videoDuration.Seconds())
+}
+
+// Estimate how long both cameras can record with their configured bitrates until free space reaches minimum
+func recordingSpaceLeft(config StorageConfig) time.Duration {
+	freeBytes, err := freeSpaceBytes(config.Root)
+	if err != nil {
+		log.Println("Free space retrieval error:", err)
+		return 0
+	}
+	if freeBytes <= config.MinFreeBytes { return 0 }
+	return time.Duration(float64(freeBytes - config.MinFreeBytes) * 8 / recordingBitrate() * float64(time.Second))
+}
+
+// Get state of current recording with progress of every camera
+func GetRecordingStatus() RecordingStatus {
+	recordingMtx.Lock()
+	var status RecordingStatus
+	if recording != nil {
+		status = recording.status
+		status.Cameras = make(map[string]CameraRecordingStatus)
+		nCam, irCam := Cameras()
+		for _, cam := range []Camera{nCam, irCam} {
+			camStatus := CameraRecordingStatus{Filename: cam.VideoFileName(filepath.Join(CaptureRoot(), status.Dir, status.Prefix))}
+			end := time.Now()
+			if finishTime, finished := recording.finished[cam.Name()]; finished {
+				camStatus.Finished = true
+				end = finishTime
+			}
+			elapsed := end.Sub(status.Started)
+			camStatus.ElapsedSec = elapsed.Seconds()
+			if !camStatus.Finished && elapsed < recording.duration {
+				camStatus.RemainingSec = (recording.duration - elapsed).Seconds()
+			}
+			status.Cameras[cam.Name()] = camStatus
+		}
+	}
+	recordingMtx.Unlock()
+	
+	for name, camStatus := range status.Cameras {
+		if fileInfo, err := os.Stat(camStatus.Filename); err == nil {
+			camStatus.SizeBytes = fileInfo.Size()
+			status.Cameras[name] = camStatus
+		}
+	}
+	status.SpaceLeftMinutes = recordingSpaceLeft(getAppConfig().Storage).Minutes()
+	return status
+}
+
+// List files of capture root and its folders grouped by capture name prefix, newest first
+func ListCaptureSets(root string) ([]CaptureSet, error) {
+	setsByPath := make(map[string]*CaptureSet)
+	var res []CaptureSet
+	var listDir func(dir string, nested bool) error
+	listDir = func(dir string, nested bool) error {
+		entries, err := os.ReadDir(filepath.Join(root, dir))
+		if err != nil { return err }
+		for _, entry := range entries {
+			if entry.IsDir() {
+				// only one level of folders (per-day ones)
+				if !nested && entry.Name() != logDirName {
+					err = listDir(entry.Name(), true)
+					if err != nil { return err }
+				}
+				continue
+			}
+			match := captureFileRegexp.FindStringSubmatch(entry.Name())
+			if match == nil { continue }
+			path := filepath.Join(dir, match[1])
+			set, ok := setsByPath[path]
+			if !ok {
+				set = &CaptureSet{Prefix: match[1], Dir: dir}
+				setsByPath[path] = set
+			}
+			set.Files = append(set.Files, entry.Name())
+		}
+		return nil
+	}
+	err := listDir("", false)
+	if err != nil { return nil, err }
+	for _, set := range setsByPath {
+		res = append(res, *set)
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Prefix > res[j].Prefix })
+	return res, nil
+}
+
+// Get capture set with given prefix from capture folder (without files if there are none)
+func findCaptureSet(root, dir, prefix string) (CaptureSet, error) {
+	set := CaptureSet{Prefix: prefix, Dir: dir}
+	entries, err := os.ReadDir(filepath.Join(root, dir))
+	if err != nil { return set, err }
+	for _, entry := range entries {
+		match := captureFileRegexp.FindStringSubmatch(entry.Name())
+		if !entry.IsDir() && match != nil && match[1] == prefix {
+			set.Files = append(set.Files, entry.Name())
+		}
+	}
+	return set, nil
+}
+
+// Get file of capture set made by camera with given id ("n" or "ir"), empty if there is none
+func (set CaptureSet) CameraFile(camID string) string {
+	for _, name := range set.Files {
+		match := captureFileRegexp.FindStringSubmatch(name)
+		if match != nil && match[2] == camID { return name }
+	}
+	return ""
+}
+
+// Check that file name belongs to some capture
+func IsCaptureFileName(name string) bool {
+	return captureFileRegexp.MatchString(name)
+}
+
+// Change palette of infrared camera
+func SetIRColorScheme(colorSchemeNumber uint) error {
+	settingsMtx.Lock()
+	defer settingsMtx.Unlock()
+	return setIRColorScheme(colorSchemeNumber)
+}
+
+// Change palette of infrared camera (settingsMtx must be held)
+func setIRColorScheme(colorSchemeNumber uint) error {
+	_, irCam := Cameras()
+	ir, ok := irCam.(*IRCamera)
+	if !ok {
+		return errors.New(fmt.Sprintf("Palette change is not supported by %T", irCam))
+	}
+	err := ir.SetColorScheme(colorSchemeNumber)
+	if err != nil { return err }
+	// keep palette on cameras restart
+	updateAppConfig(func(config *Config) { config.IRConfig.ColorSchemeNumber = colorSchemeNumber })
+	return nil
+}
+
+// Switch infrared camera to next palette (after last one goes first)
+func CycleIRColorScheme() error {
+	settingsMtx.Lock()
+	defer settingsMtx.Unlock()
+	next := (getAppConfig().IRConfig.ColorSchemeNumber + 1) % (MaxIRColorSchemeNumber + 1)
+	return setIRColorScheme(next)
+}
+
+// Stop recording in progress or start new one with live configuration duration
+func ToggleRecording() error {
+	if GetRecordingStatus().Active {
+		return StopRecording()
+	}
+	_, err := StartRecording(GetLiveConfig().VideoDuration())
+	return err
+}
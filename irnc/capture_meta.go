@@ -0,0 +1,130 @@
+package irnc
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// User-provided data about capture set, kept in sidecar file next to captured files
+type CaptureMeta struct {
+	Starred bool `json:"starred"`
+	Tags []string `json:"tags,omitempty"`
+	Notes string `json:"notes,omitempty"`
+	// location at capture start, present only when receiver had recent fix
+	Position *GPSPosition `json:"position,omitempty"`
+}
+
+// serializes sidecar read-modify-write
+var captureMetaMtx sync.Mutex
+
+// Sidecar file name for capture set (not matched as capture file itself)
+func CaptureMetaFileName(prefix string) string {
+	return fmt.Sprintf("%s_meta.json", prefix)
+}
+
+// Load capture set sidecar, missing sidecar means empty metadata
+func LoadCaptureMeta(dir, prefix string) (CaptureMeta, error) {
+	var meta CaptureMeta
+	data, err := os.ReadFile(filepath.Join(dir, CaptureMetaFileName(prefix)))
+	if os.IsNotExist(err) { return meta, nil }
+	if err != nil { return meta, err }
+	err = json.Unmarshal(data, &meta)
+	return meta, err
+}
+
+// Save capture set sidecar atomically
+func SaveCaptureMeta(dir, prefix string, meta CaptureMeta) error {
+	data, err := json.MarshalIndent(meta, "", "\t")
+	if err != nil { return err }
+	filename := filepath.Join(dir, CaptureMetaFileName(prefix))
+	tmpFilename := filename + ".tmp"
+	err = os.WriteFile(tmpFilename, data, 0644)
+	if err != nil { return err }
+	return os.Rename(tmpFilename, filename)
+}
+
+// Change capture set sidecar
+func changeCaptureMeta(root string, set CaptureSet, change func(meta *CaptureMeta)) error {
+	captureMetaMtx.Lock()
+	defer captureMetaMtx.Unlock()
+	dir := set.Directory(root)
+	meta, err := LoadCaptureMeta(dir, set.Prefix)
+	if err != nil { return err }
+	change(&meta)
+	return SaveCaptureMeta(dir, set.Prefix, meta)
+}
+
+// Change capture set sidecar and announce update
+func updateCaptureMeta(root string, set CaptureSet, change func(meta *CaptureMeta)) error {
+	err := changeCaptureMeta(root, set, change)
+	if err != nil { return err }
+	indexCaptureSet(set.Dir, set.Prefix, nil)
+	PublishEvent(Event{Type: EventCaptureUpdated, Prefix: set.Prefix, Dir: set.Dir})
+	return nil
+}
+
+// Mark or unmark capture set as starred
+func SetCaptureStarred(root string, set CaptureSet, starred bool) error {
+	return updateCaptureMeta(root, set, func(meta *CaptureMeta) { meta.Starred = starred })
+}
+
+// Replace tags and notes of capture set
+func SetCaptureAnnotation(root string, set CaptureSet, tags []string, notes string) error {
+	return updateCaptureMeta(root, set, func(meta *CaptureMeta) {
+		meta.Tags = tags
+		meta.Notes = notes
+	})
+}
+
+// Record location of new capture set in its sidecar (no-op without position)
+func saveCapturePosition(root string, set CaptureSet, position *GPSPosition) {
+	if position == nil { return }
+	err := changeCaptureMeta(root, set, func(meta *CaptureMeta) { meta.Position = position })
+	if err != nil { log.Printf("Capture set %s position saving error: %v", set.Prefix, err) }
+}
+
+// Get quick annotation configuration
+func GetAnnotationConfig() AnnotationConfig {
+	return getAppConfig().Annotation
+}
+
+// Check whether capture set belongs to recording in progress
+func isBeingRecorded(set CaptureSet) bool {
+	recordingMtx.Lock()
+	defer recordingMtx.Unlock()
+	return recording != nil && recording.status.Prefix == set.Prefix && recording.status.Dir == set.Dir
+}
+
+// Remove all files of capture set including sidecar, folder of set is removed once empty
+func DeleteCaptureSet(root string, set CaptureSet) error {
+	if isBeingRecorded(set) {
+		return errors.New("Capture set is being recorded")
+	}
+	var errs []error
+	var names []string
+	for _, name := range append(set.Files, CaptureMetaFileName(set.Prefix)) {
+		names = append(names, filepath.Join(set.Directory(root), name))
+	}
+	// VOD playlists of recordings go with them
+	for _, name := range append(names, hlsFilesOf(configuredHLSDir(), set.Prefix)...) {
+		err := os.Remove(name)
+		if err != nil && !os.IsNotExist(err) {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) > 0 {
+		return errors.New(fmt.Sprintf("Capture set %s deletion errors: %v", set.Prefix, errs))
+	}
+	if set.Dir != "" {
+		// fails while folder has other sets
+		os.Remove(set.Directory(root))
+	}
+	indexCaptureSet(set.Dir, set.Prefix, nil)
+	PublishEvent(Event{Type: EventCaptureDeleted, Prefix: set.Prefix, Dir: set.Dir})
+	return nil
+}
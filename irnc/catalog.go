@@ -0,0 +1,360 @@
+package irnc
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+	bolt "go.etcd.io/bbolt"
+)
+
+var catalogBucket = []byte("capture_sets")
+// database is locked by running application
+const catalogOpenTimeout = time.Second
+
+// Capture set as indexed by catalog
+type CatalogEntry struct {
+	CaptureSet
+	CaptureMeta
+	// start of capture
+	Time time.Time `json:"time"`
+	SizeBytes int64 `json:"size_bytes"`
+	// length of longest video, 0 for photos
+	DurationSec float64 `json:"duration_sec,omitempty"`
+	// configuration of cameras by camera id ("n" or "ir") at capture time, unknown for sets indexed from disk only
+	Cameras map[string]CameraConfig `json:"cameras,omitempty"`
+}
+
+// Catalog search criteria, zero values match everything
+type CatalogQuery struct {
+	// capture time range
+	From, To time.Time
+	// sets must have all of them
+	Tags []string
+	// case-insensitive substring of prefix or notes
+	Text string
+	StarredOnly bool
+	// "photo", "video" or empty for both
+	Kind string
+	// skip that many matches, then return at most Limit ones (0 for all)
+	Offset, Limit int
+}
+
+// Embedded database indexing capture sets of capture root
+type Catalog struct {
+	db *bolt.DB
+	root string
+}
+
+var appCatalog *Catalog
+var appCatalogMtx sync.Mutex
+
+// Check that file is recorded video
+func isVideoFileName(name string) bool {
+	return filepath.Ext(name) == ".h264"
+}
+
+// Check that entry meets criteria
+func (q CatalogQuery) Matches(entry CatalogEntry) bool {
+	if !q.From.IsZero() && entry.Time.Before(q.From) { return false }
+	if !q.To.IsZero() && entry.Time.After(q.To) { return false }
+	if q.StarredOnly && !entry.Starred { return false }
+	for _, tag := range q.Tags {
+		found := false
+		for _, entryTag := range entry.Tags {
+			if strings.EqualFold(entryTag, tag) {
+				found = true
+				break
+			}
+		}
+		if !found { return false }
+	}
+	if q.Text != "" {
+		text := strings.ToLower(q.Text)
+		if !strings.Contains(strings.ToLower(entry.Prefix), text) && !strings.Contains(strings.ToLower(entry.Notes), text) { return false }
+	}
+	switch q.Kind {
+		case "photo":
+			if entry.hasVideo() { return false }
+		case "video":
+			if !entry.hasVideo() { return false }
+	}
+	return true
+}
+
+// Check that criteria are consistent
+func (q CatalogQuery) Verify() (res []error) {
+	if q.Kind != "" && q.Kind != "photo" && q.Kind != "video" {
+		res = append(res, errors.New(fmt.Sprintf("Unknown capture kind %q", q.Kind)))
+	}
+	if q.Offset < 0 || q.Limit < 0 {
+		res = append(res, errors.New("Offset and limit can't be negative"))
+	}
+	return
+}
+
+// Check that capture set has video files
+func (entry CatalogEntry) hasVideo() bool {
+	for _, name := range entry.Files {
+		if isVideoFileName(name) { return true }
+	}
+	return false
+}
+
+// Collect matching entries from newest first sequence honoring offset and limit
+type catalogCollector struct {
+	query CatalogQuery
+	skipped int
+	res []CatalogEntry
+}
+
+// Add entry if it matches, return false once limit is reached
+func (c *catalogCollector) add(entry CatalogEntry) bool {
+	if !c.query.Matches(entry) { return true }
+	if c.skipped < c.query.Offset {
+		c.skipped++
+		return true
+	}
+	c.res = append(c.res, entry)
+	return c.query.Limit == 0 || len(c.res) < c.query.Limit
+}
+
+// Describe capture set found on disk: sizes, start time and duration from file times, sidecar
+func newCatalogEntry(root string, set CaptureSet) (CatalogEntry, error) {
+	entry := CatalogEntry{CaptureSet: set}
+	var earliest, latestVideo time.Time
+	for _, name := range set.Files {
+		fileInfo, err := os.Stat(filepath.Join(set.Directory(root), name))
+		if err != nil { continue }
+		entry.SizeBytes += fileInfo.Size()
+		if earliest.IsZero() || fileInfo.ModTime().Before(earliest) {
+			earliest = fileInfo.ModTime()
+		}
+		if isVideoFileName(name) && fileInfo.ModTime().After(latestVideo) {
+			latestVideo = fileInfo.ModTime()
+		}
+	}
+	// prefix is local start time, files are written later
+	t, err := time.ParseInLocation(timestampFormat, set.Prefix, time.Local)
+	if err != nil { t = earliest }
+	entry.Time = t
+	if !latestVideo.IsZero() && latestVideo.After(t) {
+		entry.DurationSec = latestVideo.Sub(t).Seconds()
+	}
+	meta, err := LoadCaptureMeta(set.Directory(root), set.Prefix)
+	entry.CaptureMeta = meta
+	return entry, err
+}
+
+// Database key: newest capture sets go last
+func catalogKey(set CaptureSet) []byte {
+	return []byte(set.Prefix + "\x00" + set.Dir)
+}
+
+// Factory function for Catalog, database is created if needed
+func OpenCatalog(filename, root string) (*Catalog, error) {
+	db, err := bolt.Open(filename, 0644, &bolt.Options{Timeout: catalogOpenTimeout})
+	if err == bolt.ErrTimeout { return nil, errors.New(fmt.Sprintf("Catalog %s is used by another process", filename)) }
+	if err != nil { return nil, err }
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(catalogBucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &Catalog{db: db, root: root}, nil
+}
+
+// Close database
+func (c *Catalog) Close() error {
+	return c.db.Close()
+}
+
+// Get count of indexed capture sets
+func (c *Catalog) Len() (count int, err error) {
+	err = c.db.View(func(tx *bolt.Tx) error {
+		count = tx.Bucket(catalogBucket).Stats().KeyN
+		return nil
+	})
+	return
+}
+
+// Store entry replacing previous one of the same capture set
+func (c *Catalog) Put(entry CatalogEntry) error {
+	data, err := json.Marshal(entry)
+	if err != nil { return err }
+	return c.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(catalogBucket).Put(catalogKey(entry.CaptureSet), data)
+	})
+}
+
+// Get entry of capture set, false if it isn't indexed
+func (c *Catalog) Get(set CaptureSet) (entry CatalogEntry, found bool, err error) {
+	err = c.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket(catalogBucket).Get(catalogKey(set))
+		if data == nil { return nil }
+		found = true
+		return json.Unmarshal(data, &entry)
+	})
+	return
+}
+
+// Remove entry of capture set
+func (c *Catalog) Remove(set CaptureSet) error {
+	return c.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(catalogBucket).Delete(catalogKey(set))
+	})
+}
+
+// Reindex capture set from its files (set without files is removed), known camera configurations are kept when none are given
+func (c *Catalog) Index(dir, prefix string, cameras map[string]CameraConfig) error {
+	set, err := findCaptureSet(c.root, dir, prefix)
+	if err != nil && !os.IsNotExist(err) { return err }
+	if len(set.Files) == 0 { return c.Remove(set) }
+	entry, err := newCatalogEntry(c.root, set)
+	if err != nil { log.Println("Capture metadata loading error:", err) }
+	if cameras == nil {
+		previous, found, err := c.Get(set)
+		if err != nil { return err }
+		if found { cameras = previous.Cameras }
+	}
+	entry.Cameras = cameras
+	return c.Put(entry)
+}
+
+// Find entries matching query, newest first
+func (c *Catalog) Query(q CatalogQuery) ([]CatalogEntry, error) {
+	collector := catalogCollector{query: q}
+	err := c.db.View(func(tx *bolt.Tx) error {
+		cursor := tx.Bucket(catalogBucket).Cursor()
+		for key, data := cursor.Last(); key != nil; key, data = cursor.Prev() {
+			var entry CatalogEntry
+			err := json.Unmarshal(data, &entry)
+			if err != nil { return errors.New(fmt.Sprintf("Catalog entry %q decoding error: %v", key, err)) }
+			if !collector.add(entry) { break }
+		}
+		return nil
+	})
+	return collector.res, err
+}
+
+// Replace all entries by capture sets found on disk (known camera configurations are kept), return count of sets
+func (c *Catalog) Rebuild() (int, error) {
+	sets, err := ListCaptureSets(c.root)
+	if err != nil { return 0, err }
+	var entries []CatalogEntry
+	for _, set := range sets {
+		entry, err := newCatalogEntry(c.root, set)
+		if err != nil { log.Printf("Capture set %s metadata loading error: %v", set.Prefix, err) }
+		entries = append(entries, entry)
+	}
+	err = c.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(catalogBucket)
+		for i, entry := range entries {
+			var previous CatalogEntry
+			if data := bucket.Get(catalogKey(entry.CaptureSet)); data != nil && json.Unmarshal(data, &previous) == nil {
+				entries[i].Cameras = previous.Cameras
+			}
+		}
+		err := tx.DeleteBucket(catalogBucket)
+		if err != nil { return err }
+		bucket, err = tx.CreateBucket(catalogBucket)
+		if err != nil { return err }
+		for _, entry := range entries {
+			data, err := json.Marshal(entry)
+			if err != nil { return err }
+			err = bucket.Put(catalogKey(entry.CaptureSet), data)
+			if err != nil { return err }
+		}
+		return nil
+	})
+	if err != nil { return 0, err }
+	return len(entries), nil
+}
+
+// Get running catalog, nil if it's disabled
+func getAppCatalog() *Catalog {
+	appCatalogMtx.Lock()
+	defer appCatalogMtx.Unlock()
+	return appCatalog
+}
+
+// Get configurations of current cameras by camera id
+func currentCameraConfigs() map[string]CameraConfig {
+	config := getAppConfig()
+	return map[string]CameraConfig{"n": config.NConfig, "ir": config.IRConfig}
+}
+
+// Find capture sets matching query (newest first) in catalog, or on disk when catalog is disabled
+func QueryCaptures(q CatalogQuery) ([]CatalogEntry, error) {
+	errs := q.Verify()
+	if len(errs) > 0 { return nil, errs[0] }
+	if c := getAppCatalog(); c != nil { return c.Query(q) }
+	root := CaptureRoot()
+	sets, err := ListCaptureSets(root)
+	if err != nil { return nil, err }
+	collector := catalogCollector{query: q}
+	for _, set := range sets {
+		entry, err := newCatalogEntry(root, set)
+		if err != nil { log.Printf("Capture set %s metadata loading error: %v", set.Prefix, err) }
+		if !collector.add(entry) { break }
+	}
+	return collector.res, nil
+}
+
+// Rebuild catalog of running application, or open configured one when application isn't initialized (command line use)
+func RebuildCatalog() (int, error) {
+	if c := getAppCatalog(); c != nil { return c.Rebuild() }
+	config := getAppConfig()
+	if config == nil { config = loadConfig() }
+	if config.Catalog.File == "" { return 0, errors.New("Catalog is disabled") }
+	c, err := OpenCatalog(config.Catalog.File, config.Storage.Root)
+	if err != nil { return 0, err }
+	defer c.Close()
+	return c.Rebuild()
+}
+
+// Reindex capture set in running catalog (if enabled), camera configurations are given for new captures only
+func indexCaptureSet(dir, prefix string, cameras map[string]CameraConfig) {
+	c := getAppCatalog()
+	if c == nil { return }
+	err := c.Index(dir, prefix, cameras)
+	if err != nil { log.Printf("Catalog update error for %s: %v", prefix, err) }
+}
+
+// Open catalog for captures, empty one is filled from disk
+func startCatalog(config CatalogConfig, root string) {
+	if config.File == "" { return }
+	c, err := OpenCatalog(config.File, root)
+	if err != nil {
+		log.Println("Catalog opening error:", err)
+		return
+	}
+	count, err := c.Len()
+	if err == nil && count == 0 {
+		count, err = c.Rebuild()
+		if err == nil { log.Printf("Catalog is built from %d capture sets on disk", count) }
+	}
+	if err != nil { log.Println("Catalog initialization error:", err) }
+	appCatalogMtx.Lock()
+	appCatalog = c
+	appCatalogMtx.Unlock()
+}
+
+// Close catalog
+func stopCatalog() {
+	appCatalogMtx.Lock()
+	c := appCatalog
+	appCatalog = nil
+	appCatalogMtx.Unlock()
+	if c == nil { return }
+	err := c.Close()
+	if err != nil { log.Println("Catalog closing error:", err) }
+}
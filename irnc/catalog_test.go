@@ -0,0 +1,93 @@
+package irnc
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// Get prefixes of entries in order
+func entryPrefixes(entries []CatalogEntry) (res []string) {
+	for _, entry := range entries {
+		res = append(res, entry.Prefix)
+	}
+	return
+}
+
+// Run query and compare found prefixes with expected ones
+func checkCatalogQuery(t *testing.T, c *Catalog, q CatalogQuery, expected ...string) {
+	t.Helper()
+	entries, err := c.Query(q)
+	if err != nil { t.Fatal("Catalog query error:", err) }
+	found := entryPrefixes(entries)
+	if len(found) != len(expected) {
+		t.Fatalf("Query %+v: %v expected, got %v", q, expected, found)
+	}
+	for i := range found {
+		if found[i] != expected[i] { t.Fatalf("Query %+v: %v expected, got %v", q, expected, found) }
+	}
+}
+
+func TestCatalog(t *testing.T) {
+	root := t.TempDir()
+	writeTestCaptures(t, root, map[string]string{
+		"2021.03.01/2021.03.01_10.00.00_n.png": "n photo",
+		"2021.03.01/2021.03.01_10.00.00_ir.png": "ir photo",
+		"2021.03.01/2021.03.01_10.00.00_meta.json": `{"starred":true,"tags":["pump 3"]}`,
+		"2021.03.15/2021.03.15_11.00.00_n.h264": "n video",
+		"2021.03.15/2021.03.15_11.00.00_meta.json": `{"tags":["Pump 3","leak"],"notes":"Valve flange"}`,
+		"2021.04.02/2021.04.02_12.00.00_n.png": "n photo",
+		"logs/2021.04.02_12.00.00.log": "log",
+	})
+	videoTime, _ := time.ParseInLocation(timestampFormat, "2021.03.15_11.00.30", time.Local)
+	os.Chtimes(filepath.Join(root, "2021.03.15/2021.03.15_11.00.00_n.h264"), videoTime, videoTime)
+
+	filename := filepath.Join(t.TempDir(), "catalog.db")
+	c, err := OpenCatalog(filename, root)
+	if err != nil { t.Fatal("Catalog opening error:", err) }
+	count, err := c.Rebuild()
+	if err != nil || count != 3 { t.Fatal("3 capture sets expected in rebuilt catalog, got", count, err) }
+
+	checkCatalogQuery(t, c, CatalogQuery{}, "2021.04.02_12.00.00", "2021.03.15_11.00.00", "2021.03.01_10.00.00")
+	march, _ := time.ParseInLocation(dayFolderFormat, "2021.03.01", time.Local)
+	april := march.AddDate(0, 1, 0)
+	checkCatalogQuery(t, c, CatalogQuery{From: march, To: april, Tags: []string{"pump 3"}}, "2021.03.15_11.00.00", "2021.03.01_10.00.00")
+	checkCatalogQuery(t, c, CatalogQuery{Tags: []string{"pump 3", "leak"}}, "2021.03.15_11.00.00")
+	checkCatalogQuery(t, c, CatalogQuery{Text: "flange"}, "2021.03.15_11.00.00")
+	checkCatalogQuery(t, c, CatalogQuery{StarredOnly: true}, "2021.03.01_10.00.00")
+	checkCatalogQuery(t, c, CatalogQuery{Kind: "video"}, "2021.03.15_11.00.00")
+	checkCatalogQuery(t, c, CatalogQuery{Kind: "photo", Offset: 1, Limit: 1}, "2021.03.01_10.00.00")
+
+	video, found, err := c.Get(CaptureSet{Prefix: "2021.03.15_11.00.00", Dir: "2021.03.15"})
+	if err != nil || !found { t.Fatal("Video capture set is not found:", err) }
+	if video.DurationSec != 30 || video.SizeBytes != int64(len("n video")) || len(video.Files) != 1 {
+		t.Fatalf("Unexpected video entry %+v", video)
+	}
+
+	// new capture with camera configurations, which survive rebuild
+	writeTestCaptures(t, root, map[string]string{"2021.04.02/2021.04.02_13.00.00_ir.png": "ir photo"})
+	cameras := map[string]CameraConfig{"ir": GetHardcodedConfig().IRConfig}
+	err = c.Index("2021.04.02", "2021.04.02_13.00.00", cameras)
+	if err != nil { t.Fatal("Capture set indexing error:", err) }
+	_, err = c.Rebuild()
+	if err != nil { t.Fatal("Catalog rebuild error:", err) }
+	entry, found, _ := c.Get(CaptureSet{Prefix: "2021.04.02_13.00.00", Dir: "2021.04.02"})
+	if !found || entry.Cameras["ir"].ColorSchemeNumber != cameras["ir"].ColorSchemeNumber {
+		t.Fatalf("Camera configurations are lost: %+v", entry)
+	}
+
+	// deleted files remove entry
+	os.Remove(filepath.Join(root, "2021.04.02/2021.04.02_13.00.00_ir.png"))
+	err = c.Index("2021.04.02", "2021.04.02_13.00.00", nil)
+	if err != nil { t.Fatal("Capture set reindexing error:", err) }
+	checkCatalogQuery(t, c, CatalogQuery{From: april}, "2021.04.02_12.00.00")
+
+	// catalog persists and is locked while open
+	if _, err := OpenCatalog(filename, root); err == nil { t.Fatal("Catalog opened twice") }
+	c.Close()
+	c, err = OpenCatalog(filename, root)
+	if err != nil { t.Fatal("Catalog reopening error:", err) }
+	defer c.Close()
+	if count, _ := c.Len(); count != 3 { t.Fatal("3 capture sets expected after reopening, got", count) }
+}
@@ -1,37 +1,299 @@
 package irnc
 
 import (
+	"errors"
+	"fmt"
+	"sync"
 	"time"
 )
 
 const GeneralExternalsExecutionTimeout = 15 * time.Second
 const RecordedVideoSize = 60 * time.Second
+const MinZoomPercent = 100
+const MaxZoomPercent = 400
 
 type PhysicalDeviceConfig struct {
+	// manufacturer and model written to image metadata
+	Make, Model string
 	MaxRecordWidth, MaxRecordHeight uint
 	RotationDegree int
 }
 
+type CatalogConfig struct {
+	// embedded database indexing capture sets, empty to disable (captures are searched on disk then)
+	File string
+}
+
 type CameraConfig struct {
 	Bitrate uint
 	ColorSchemeNumber uint
 	PhysicalConfig PhysicalDeviceConfig
 	PreviewPixelDensity uint
 	RecordWidth, RecordHeight uint
+	Snapshot SnapshotConfig
 	V4L2DeviceNumber uint
 }
 
+type SnapshotConfig struct {
+	// "png", "jpeg", "webp" (lossless, requires cwebp), "tiff" (uncompressed, 16 bits per sample) or "raw" (frame planes after text header)
+	Format string
+	// 1-100
+	JPEGQuality int
+	// "default", "none", "speed" or "best"
+	PNGCompression string
+	// device is switched to max resolution for every snapshot (N camera only, IR frames have max resolution already)
+	FullResolution bool
+}
+
+type AnnotationConfig struct {
+	// quick annotation is offered after every successful capture while live preview is shown
+	PromptAfterCapture bool
+	// choices shown as large buttons (asset IDs, defect types)
+	Tags []string
+}
+
+type APIConfig struct {
+	// listen address of remote control API, empty to disable
+	Address string
+	// bearer token required by API, empty to disable authorization
+	Token string
+}
+
+type HLSConfig struct {
+	// rolling live playlists "live_n.m3u8"/"live_ir.m3u8"
+	LiveEnabled bool
+	// VOD playlists "<prefix>_n.m3u8"/"<prefix>_ir.m3u8" for every recording
+	RecordingsEnabled bool
+	// directory for playlists and segments
+	Dir string
+	SegmentDuration time.Duration
+	// retention window of live playlist in segments
+	LiveSegments uint
+}
+
+type MQTTConfig struct {
+	// broker URL like "tcp://localhost:1883", empty to disable
+	Broker string
+	ClientID string
+	Username, Password string
+	// events are published to "<EventTopicPrefix>/<event type>"
+	EventTopicPrefix string
+	// JSON commands are received from this topic, empty to disable
+	CommandTopic string
+	// retained "online"/"offline" (last will) status
+	StatusTopic string
+	// retry interval of first connection doubles from min to max, lost connection is retried from 1 s (client library) to max
+	ReconnectMinInterval, ReconnectMaxInterval time.Duration
+}
+
+type BacklightConfig struct {
+	// "pwm" (sysfs PWM), "gpio" (on/off only, GPIO character device) or empty to disable
+	Backend string
+	// sysfs PWM channel "/sys/class/pwm/pwmchip<PWMChip>/pwm<PWMChannel>"
+	PWMChip, PWMChannel uint
+	PWMPeriod time.Duration
+	// GPIO character device and line offset
+	GPIOChip string
+	GPIOLine int
+	// dim screen after no user input for this long, 0 to disable
+	AutoDimTimeout time.Duration
+	DimBrightnessPercent uint
+	// brightness limit in night mode
+	NightBrightnessPercent uint
+}
+
+type S3Config struct {
+	// host[:port] of S3-compatible service, empty to disable sync
+	Endpoint string
+	UseTLS bool
+	Region string
+	AccessKey, SecretKey string
+	Bucket string
+	// object keys are "<KeyPrefix>/<capture folder>/<file>"
+	KeyPrefix string
+	// pending uploads are kept here across restarts
+	QueueFile string
+	// larger files are uploaded in parts of this size (5 MiB at least), interrupted upload continues from last complete part
+	PartSize uint64
+	// upload rate in bytes per second, 0 for unlimited
+	BandwidthLimit uint64
+	// uploads wait until recording is finished
+	PauseWhileRecording bool
+	RetryInterval time.Duration
+}
+
+type StorageConfig struct {
+	// directory for captures and logs
+	Root string
+	// captures of every day go to "<Root>/<yyyy.mm.dd>" folder
+	PerDayFolders bool
+	// captures are refused when free space would drop below minimum, warning is issued below warning level
+	MinFreeBytes, WarnFreeBytes uint64
+	// captures older than max age are deleted, then oldest ones while total size exceeds max (starred are kept), 0 disables limit
+	MaxAge time.Duration
+	MaxTotalBytes uint64
+	RetentionInterval time.Duration
+}
+
+type ExportConfig struct {
+	// where removable volumes are mounted
+	MediaDir string
+	// only mount points are treated as volumes (disable to use plain directories, e.g. manually mounted ones)
+	MountPointsOnly bool
+	// captures are copied to "<volume>/<DirName>/<capture folder>"
+	DirName string
+	// default of "delete originals after verified copy" option
+	DeleteAfterExport bool
+}
+
+type GPSConfig struct {
+	// "nmea" (NMEA receiver on serial device), "gpsd" or empty to disable
+	Source string
+	// serial device like "/dev/ttyUSB0" (non-serial files like FIFOs are read as is) and its speed
+	Device string
+	BaudRate uint
+	// host:port of gpsd
+	GPSDAddress string
+	// fixes older than this aren't attached to captures
+	MaxFixAge time.Duration
+	RetryInterval time.Duration
+}
+
+type GPIOConfig struct {
+	// GPIO character device like "gpiochip0", empty to disable
+	Chip string
+	// line offsets of push buttons (active low with pull-up), negative to disable
+	SnapshotLine, RecordLine, ExitLine, PaletteLine int
+	// line offsets of rotary encoder (quadrature A/B, active low with pull-up), negative to disable
+	EncoderALine, EncoderBLine int
+	// button edges closer than this to previous one are contact bounce
+	Debounce time.Duration
+	// zoom change per encoder detent
+	ZoomStepPercent uint
+}
+
+type SupervisorConfig struct {
+	// frame flow check period
+	CheckInterval time.Duration
+	// no frames for this long mark camera degraded
+	StallTimeout time.Duration
+	// no frames for this long lead to camera restart
+	StallRestartTimeout time.Duration
+	// delay before restart after failure, doubled after every consecutive failure
+	MinBackoff, MaxBackoff time.Duration
+}
+
+// Settings which can be changed without cameras restart
+type LiveConfig struct {
+	PreviewFramerate uint `json:"preview_framerate"`
+	VideoDurationSec uint `json:"video_duration_sec"`
+	// digital zoom of preview (center crop)
+	ZoomPercent uint `json:"zoom_percent"`
+	// screen backlight
+	BrightnessPercent uint `json:"brightness_percent"`
+	// dim red-tinted UI preserving dark adaptation
+	NightMode bool `json:"night_mode"`
+}
+
 type Config struct {
+	Annotation AnnotationConfig
+	API APIConfig
+	Backlight BacklightConfig
+	Catalog CatalogConfig
+	Export ExportConfig
+	GPIO GPIOConfig
+	GPS GPSConfig
+	HLS HLSConfig
+	Live LiveConfig
+	MQTT MQTTConfig
 	NConfig, IRConfig CameraConfig
 	PreviewWidth, PreviewHeight, PreviewFramerate uint
+	S3 S3Config
+	// arrangement of previews and buttons (interpreted by GUI)
+	ScreenLayout string
+	Storage StorageConfig
+	Supervisor SupervisorConfig
 }
 
 // Get application specific settings for preview and cameras
 func GetHardcodedConfig() *Config {
 	return &Config {
+		Annotation: AnnotationConfig {
+			PromptAfterCapture: true,
+			Tags: []string{"Pump 1", "Pump 2", "Pump 3", "Valve", "Motor", "Hot spot", "Leak", "Insulation", "Corrosion"},
+		},
+		API: APIConfig {
+			Address: ":8080",
+			Token: "",
+		},
+		Backlight: BacklightConfig {
+			// PWM0 on BCM18 (requires "dtoverlay=pwm" in /boot/config.txt)
+			Backend: "pwm",
+			PWMChip: 0,
+			PWMChannel: 0,
+			PWMPeriod: time.Millisecond,
+			GPIOChip: "gpiochip0",
+			GPIOLine: 18,
+			AutoDimTimeout: 2 * time.Minute,
+			DimBrightnessPercent: 5,
+			NightBrightnessPercent: 10,
+		},
+		Catalog: CatalogConfig {
+			File: "catalog.db",
+		},
+		Export: ExportConfig {
+			MediaDir: "/media",
+			MountPointsOnly: true,
+			DirName: "irnc",
+			DeleteAfterExport: false,
+		},
+		GPIO: GPIOConfig {
+			Chip: "",
+			SnapshotLine: 5,
+			RecordLine: 6,
+			ExitLine: 13,
+			PaletteLine: 19,
+			EncoderALine: 20,
+			EncoderBLine: 21,
+			Debounce: 30 * time.Millisecond,
+			ZoomStepPercent: 10,
+		},
+		GPS: GPSConfig {
+			Source: "",
+			Device: "/dev/serial0",
+			BaudRate: 9600,
+			GPSDAddress: "localhost:2947",
+			MaxFixAge: 10 * time.Second,
+			RetryInterval: 5 * time.Second,
+		},
+		HLS: HLSConfig {
+			LiveEnabled: false,
+			RecordingsEnabled: false,
+			Dir: "hls",
+			SegmentDuration: 2 * time.Second,
+			LiveSegments: 6,
+		},
+		Live: LiveConfig {
+			PreviewFramerate: 15,
+			VideoDurationSec: uint(RecordedVideoSize / time.Second),
+			ZoomPercent: MinZoomPercent,
+			BrightnessPercent: 100,
+			NightMode: false,
+		},
+		MQTT: MQTTConfig {
+			Broker: "",
+			ClientID: "irnc",
+			EventTopicPrefix: "irnc/events",
+			CommandTopic: "irnc/command",
+			StatusTopic: "irnc/status",
+			ReconnectMinInterval: time.Second,
+			ReconnectMaxInterval: 2 * time.Minute,
+		},
 		NConfig: CameraConfig {
 			Bitrate: 17000000,
 			PhysicalConfig: PhysicalDeviceConfig {
+				Make: "Waveshare",
+				Model: "RPi Camera (H)",
 				MaxRecordWidth: 1920,
 				MaxRecordHeight: 1080,
 				RotationDegree: 0,
@@ -39,12 +301,20 @@ func GetHardcodedConfig() *Config {
 			PreviewPixelDensity: 2,
 			RecordWidth: 190,
 			RecordHeight: 320,
+			Snapshot: SnapshotConfig {
+				Format: "png",
+				JPEGQuality: 90,
+				PNGCompression: "default",
+				FullResolution: false,
+			},
 			V4L2DeviceNumber: 0,
 		},
 		IRConfig: CameraConfig {
 			Bitrate: 17000000,
 			ColorSchemeNumber: 11,
 			PhysicalConfig: PhysicalDeviceConfig {
+				Make: "Seek Thermal",
+				Model: "CompactPRO",
 				MaxRecordWidth: 320,
 				MaxRecordHeight: 240,
 				RotationDegree: 90,
@@ -52,10 +322,118 @@ func GetHardcodedConfig() *Config {
 			PreviewPixelDensity: 1,
 			RecordWidth: 190,
 			RecordHeight: 320,
+			Snapshot: SnapshotConfig {
+				Format: "png",
+				JPEGQuality: 90,
+				PNGCompression: "default",
+				FullResolution: false,
+			},
 			V4L2DeviceNumber: 1,
 		},
 		PreviewWidth: 190,
 		PreviewHeight: 320, // actually it's 189.57031 x 312/318
 		PreviewFramerate: 15,
+		ScreenLayout: "side_by_side",
+		S3: S3Config {
+			Endpoint: "",
+			UseTLS: true,
+			Region: "",
+			AccessKey: "",
+			SecretKey: "",
+			Bucket: "irnc",
+			KeyPrefix: "irnc",
+			QueueFile: "s3_queue.json",
+			PartSize: 8 << 20,
+			BandwidthLimit: 1 << 20,
+			PauseWhileRecording: true,
+			RetryInterval: 30 * time.Second,
+		},
+		Storage: StorageConfig {
+			Root: "captures",
+			PerDayFolders: true,
+			MinFreeBytes: 200 << 20,
+			WarnFreeBytes: 1 << 30,
+			MaxAge: 0,
+			MaxTotalBytes: 8 << 30,
+			RetentionInterval: 10 * time.Minute,
+		},
+		Supervisor: SupervisorConfig {
+			CheckInterval: 500 * time.Millisecond,
+			StallTimeout: 2 * time.Second,
+			StallRestartTimeout: 10 * time.Second,
+			MinBackoff: time.Second,
+			MaxBackoff: time.Minute,
+		},
+	}
+}
+
+var liveConfig LiveConfig
+var liveConfigMtx sync.RWMutex
+
+// Do basic consistency checks for live configuration values
+func (lc LiveConfig) Verify() (res []error) {
+	if lc.PreviewFramerate == 0 {
+		res = append(res, errors.New("Preview framerate must be positive"))
 	}
+	if lc.VideoDurationSec == 0 {
+		res = append(res, errors.New("Video duration must be positive"))
+	}
+	if lc.ZoomPercent < MinZoomPercent || lc.ZoomPercent > MaxZoomPercent {
+		res = append(res, errors.New(fmt.Sprintf("Zoom must be between %d%% and %d%%", MinZoomPercent, MaxZoomPercent)))
+	}
+	// completely dark screen can't be fixed from the screen itself
+	if lc.BrightnessPercent == 0 || lc.BrightnessPercent > 100 {
+		res = append(res, errors.New("Brightness must be between 1% and 100%"))
+	}
+	return
+}
+
+// Duration of recorded video
+func (lc LiveConfig) VideoDuration() time.Duration {
+	return time.Duration(lc.VideoDurationSec) * time.Second
+}
+
+// Get current live configuration
+func GetLiveConfig() LiveConfig {
+	liveConfigMtx.RLock()
+	defer liveConfigMtx.RUnlock()
+	return liveConfig
+}
+
+// Replace current live configuration if it passes verification
+func SetLiveConfig(lc LiveConfig) []error {
+	errs := lc.Verify()
+	if len(errs) > 0 { return errs }
+	liveConfigMtx.Lock()
+	defer liveConfigMtx.Unlock()
+	liveConfig = lc
+	return nil
+}
+
+// Change preview zoom by given percents within allowed range
+func AdjustZoom(deltaPercent int) uint {
+	liveConfigMtx.Lock()
+	defer liveConfigMtx.Unlock()
+	zoomPercent := int(liveConfig.ZoomPercent) + deltaPercent
+	if zoomPercent < MinZoomPercent { zoomPercent = MinZoomPercent }
+	if zoomPercent > MaxZoomPercent { zoomPercent = MaxZoomPercent }
+	liveConfig.ZoomPercent = uint(zoomPercent)
+	return liveConfig.ZoomPercent
+}
+
+// Change screen brightness within allowed range
+func SetBrightness(percent int) uint {
+	liveConfigMtx.Lock()
+	defer liveConfigMtx.Unlock()
+	if percent < 1 { percent = 1 }
+	if percent > 100 { percent = 100 }
+	liveConfig.BrightnessPercent = uint(percent)
+	return liveConfig.BrightnessPercent
+}
+
+// Turn night mode on or off
+func SetNightMode(on bool) {
+	liveConfigMtx.Lock()
+	defer liveConfigMtx.Unlock()
+	liveConfig.NightMode = on
 }
@@ -0,0 +1,83 @@
+package irnc
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+)
+
+type EventType string
+
+const (
+	EventSnapshotTaken EventType = "snapshot_taken"
+	EventRecordingStarted EventType = "recording_started"
+	EventRecordingStopped EventType = "recording_stopped"
+	EventCameraFailed EventType = "camera_failed"
+	EventCameraStateChanged EventType = "camera_state_changed"
+	EventCaptureDeleted EventType = "capture_deleted"
+	EventCaptureUpdated EventType = "capture_updated"
+	EventStorageLow EventType = "storage_low"
+	EventCaptureUploaded EventType = "capture_uploaded"
+	EventSequenceStarted EventType = "sequence_started"
+	EventSequenceStopped EventType = "sequence_stopped"
+)
+
+// Notable application happening, JSON-serializable for external consumers
+type Event struct {
+	Type EventType `json:"type"`
+	Time time.Time `json:"time"`
+	Camera string `json:"camera,omitempty"`
+	Prefix string `json:"prefix,omitempty"`
+	// folder of capture relative to capture root
+	Dir string `json:"dir,omitempty"`
+	State string `json:"state,omitempty"`
+	// name prefix of timelapse or burst the capture belongs to
+	Sequence string `json:"sequence,omitempty"`
+	Errors []string `json:"errors,omitempty"`
+}
+
+const eventSubscriberBufferSize = 16
+
+var eventSubscribers = make(map[chan Event]struct{})
+var eventSubscribersMtx sync.Mutex
+
+// Get channel with all events published until context is done
+func SubscribeEvents(ctx context.Context) <-chan Event {
+	eventCh := make(chan Event, eventSubscriberBufferSize)
+	eventSubscribersMtx.Lock()
+	eventSubscribers[eventCh] = struct{}{}
+	eventSubscribersMtx.Unlock()
+	go func() {
+		<-ctx.Done()
+		eventSubscribersMtx.Lock()
+		defer eventSubscribersMtx.Unlock()
+		delete(eventSubscribers, eventCh)
+		close(eventCh)
+	}()
+	return eventCh
+}
+
+// Deliver event to all subscribers (slow subscribers lose events instead of blocking publisher)
+func PublishEvent(event Event) {
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+	eventSubscribersMtx.Lock()
+	defer eventSubscribersMtx.Unlock()
+	for eventCh := range eventSubscribers {
+		select {
+			case eventCh<- event:
+			default:
+				log.Println("Event subscriber is congested, event dropped:", event.Type)
+		}
+	}
+}
+
+// Convert errors to strings for event payload
+func errorStrings(errs []error) (res []string) {
+	for _, err := range errs {
+		res = append(res, err.Error())
+	}
+	return
+}
@@ -0,0 +1,287 @@
+package irnc
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"sync"
+	"syscall"
+	"time"
+	"golang.org/x/sys/unix"
+)
+
+// Checksum list in export directory (sha256sum -c compatible)
+const exportChecksumsFileName = "SHA256SUMS"
+const exportCopyBufferSize = 1 << 20
+
+// State of current (or last finished) export
+type ExportProgress struct {
+	Active bool `json:"active"`
+	Volume string `json:"volume,omitempty"`
+	SetsDone int `json:"sets_done"`
+	SetsTotal int `json:"sets_total"`
+	BytesDone int64 `json:"bytes_done"`
+	BytesTotal int64 `json:"bytes_total"`
+	// file being copied
+	Current string `json:"current,omitempty"`
+	Errors []string `json:"errors,omitempty"`
+	Finished time.Time `json:"finished,omitempty"`
+}
+
+var exportProgress ExportProgress
+var exportProgressMtx sync.Mutex
+
+// Check that directory is mounted filesystem root (its device differs from parent's)
+func isMountPoint(dir string) bool {
+	var stat, parentStat syscall.Stat_t
+	if syscall.Stat(dir, &stat) != nil { return false }
+	if syscall.Stat(filepath.Dir(dir), &parentStat) != nil { return false }
+	return stat.Dev != parentStat.Dev
+}
+
+// Find removable volumes: mount points among "<MediaDir>/<label>" and "<MediaDir>/<user>/<label>", or every subdirectory of MediaDir when mount points aren't required
+func DetectExportVolumes(config ExportConfig) ([]string, error) {
+	entries, err := os.ReadDir(config.MediaDir)
+	if os.IsNotExist(err) { return nil, nil }
+	if err != nil { return nil, err }
+	var res []string
+	for _, entry := range entries {
+		if !entry.IsDir() { continue }
+		dir := filepath.Join(config.MediaDir, entry.Name())
+		if !config.MountPointsOnly || isMountPoint(dir) {
+			res = append(res, dir)
+			continue
+		}
+		// desktop automounters use per-user folders
+		userEntries, err := os.ReadDir(dir)
+		if err != nil { continue }
+		for _, userEntry := range userEntries {
+			userDir := filepath.Join(dir, userEntry.Name())
+			if userEntry.IsDir() && isMountPoint(userDir) {
+				res = append(res, userDir)
+			}
+		}
+	}
+	sort.Strings(res)
+	return res, nil
+}
+
+// Get removable media configuration
+func GetExportConfig() ExportConfig {
+	return getAppConfig().Export
+}
+
+// Get directory for captures on volume
+func exportRoot(config ExportConfig, volume string) string {
+	return filepath.Join(volume, config.DirName)
+}
+
+// Get files of capture set to export (captured files and existing sidecar)
+func exportFiles(root string, set CaptureSet) []string {
+	res := append([]string(nil), set.Files...)
+	metaName := CaptureMetaFileName(set.Prefix)
+	if _, err := os.Stat(filepath.Join(set.Directory(root), metaName)); err == nil {
+		res = append(res, metaName)
+	}
+	return res
+}
+
+// List capture sets which have files missing (or of different size) in export directory, newest first
+func NewCaptureSetsForExport(root, destRoot string) ([]CaptureSet, error) {
+	sets, err := ListCaptureSets(root)
+	if err != nil { return nil, err }
+	var res []CaptureSet
+	for _, set := range sets {
+		for _, name := range set.Files {
+			srcInfo, err := os.Stat(filepath.Join(set.Directory(root), name))
+			if err != nil { continue }
+			destInfo, err := os.Stat(filepath.Join(set.Directory(destRoot), name))
+			if err != nil || destInfo.Size() != srcInfo.Size() {
+				res = append(res, set)
+				break
+			}
+		}
+	}
+	return res, nil
+}
+
+// Compute SHA-256 of file
+func fileChecksum(filename string) (string, error) {
+	file, err := os.Open(filename)
+	if err != nil { return "", err }
+	defer file.Close()
+	hash := sha256.New()
+	_, err = io.CopyBuffer(hash, file, make([]byte, exportCopyBufferSize))
+	if err != nil { return "", err }
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// Copy file via temporary one, read copy back from device and compare checksums before giving it final name, return checksum
+func copyFileVerified(src, dst string, onBytes func(int64)) (string, error) {
+	srcFile, err := os.Open(src)
+	if err != nil { return "", err }
+	defer srcFile.Close()
+	tmpDst := dst + ".tmp"
+	dstFile, err := os.Create(tmpDst)
+	if err != nil { return "", err }
+	hash := sha256.New()
+	buf := make([]byte, exportCopyBufferSize)
+	for {
+		n, readErr := srcFile.Read(buf)
+		if n > 0 {
+			hash.Write(buf[:n])
+			_, err = dstFile.Write(buf[:n])
+			if err != nil { break }
+			onBytes(int64(n))
+		}
+		if readErr == io.EOF { break }
+		if readErr != nil {
+			err = readErr
+			break
+		}
+	}
+	if err == nil {
+		// data must reach the stick before it may be unplugged
+		err = dstFile.Sync()
+	}
+	if err == nil {
+		// read-back must come from the stick, not from page cache filled by writing
+		err = unix.Fadvise(int(dstFile.Fd()), 0, 0, unix.FADV_DONTNEED)
+	}
+	closeErr := dstFile.Close()
+	if err == nil { err = closeErr }
+	if err != nil {
+		os.Remove(tmpDst)
+		return "", err
+	}
+	srcChecksum := hex.EncodeToString(hash.Sum(nil))
+	dstChecksum, err := fileChecksum(tmpDst)
+	if err == nil && dstChecksum != srcChecksum {
+		err = errors.New(fmt.Sprintf("Checksum mismatch for %s", dst))
+	}
+	if err != nil {
+		os.Remove(tmpDst)
+		return "", err
+	}
+	return srcChecksum, os.Rename(tmpDst, dst)
+}
+
+// Append checksums of copied files to checksum list of export directory
+func appendExportChecksums(destRoot string, checksums map[string]string) error {
+	file, err := os.OpenFile(filepath.Join(destRoot, exportChecksumsFileName), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil { return err }
+	var names []string
+	for name := range checksums {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		_, err = fmt.Fprintf(file, "%s  %s\n", checksums[name], name)
+		if err != nil {
+			file.Close()
+			return err
+		}
+	}
+	err = file.Sync()
+	closeErr := file.Close()
+	if err == nil { err = closeErr }
+	return err
+}
+
+// Copy capture sets to export directory with verification, delete originals of verified sets if requested, report progress after every chunk
+func exportCaptureSets(root, destRoot string, sets []CaptureSet, deleteOriginals bool, onProgress func(ExportProgress)) (errs []error) {
+	progress := ExportProgress{Active: true, SetsTotal: len(sets)}
+	for _, set := range sets {
+		// sets waiting for export aren't deleted by retention
+		defer useCaptureSet(set.Dir, set.Prefix)()
+		for _, name := range exportFiles(root, set) {
+			if fileInfo, err := os.Stat(filepath.Join(set.Directory(root), name)); err == nil {
+				progress.BytesTotal += fileInfo.Size()
+			}
+		}
+	}
+	onProgress(progress)
+	for _, set := range sets {
+		setErr := func() error {
+			// unfinished recording would be copied truncated
+			if isBeingRecorded(set) { return errors.New("Capture set is being recorded") }
+			err := os.MkdirAll(set.Directory(destRoot), 0755)
+			if err != nil { return err }
+			checksums := make(map[string]string)
+			for _, name := range exportFiles(root, set) {
+				progress.Current = name
+				checksum, err := copyFileVerified(filepath.Join(set.Directory(root), name), filepath.Join(set.Directory(destRoot), name), func(n int64) {
+					progress.BytesDone += n
+					onProgress(progress)
+				})
+				if err != nil { return err }
+				// forward slashes keep list portable
+				checksums[path.Join(filepath.ToSlash(set.Dir), name)] = checksum
+			}
+			err = appendExportChecksums(destRoot, checksums)
+			if err != nil { return err }
+			if !deleteOriginals { return nil }
+			return DeleteCaptureSet(root, set)
+		}()
+		if setErr != nil {
+			err := errors.New(fmt.Sprintf("Capture set %s export error: %v", set.Prefix, setErr))
+			log.Println(err)
+			errs = append(errs, err)
+			progress.Errors = append(progress.Errors, err.Error())
+		}
+		progress.SetsDone++
+		onProgress(progress)
+	}
+	progress.Active = false
+	progress.Current = ""
+	progress.Finished = time.Now()
+	onProgress(progress)
+	return
+}
+
+// Start copying capture sets to removable volume in background (one export at a time)
+func StartExport(volume string, sets []CaptureSet, deleteOriginals bool) error {
+	exportProgressMtx.Lock()
+	defer exportProgressMtx.Unlock()
+	if exportProgress.Active {
+		return errors.New("Export is already in progress")
+	}
+	exportProgress = ExportProgress{Active: true, Volume: volume, SetsTotal: len(sets)}
+	root := CaptureRoot()
+	destRoot := exportRoot(getAppConfig().Export, volume)
+	go func() {
+		log.Printf("Export of %d capture sets to %s started", len(sets), destRoot)
+		errs := exportCaptureSets(root, destRoot, sets, deleteOriginals, func(progress ExportProgress) {
+			progress.Volume = volume
+			exportProgressMtx.Lock()
+			exportProgress = progress
+			exportProgressMtx.Unlock()
+		})
+		log.Printf("Export to %s finished with %d errors", destRoot, len(errs))
+	}()
+	return nil
+}
+
+// Start copying capture sets which are missing on volume
+func StartNewCapturesExport(volume string, deleteOriginals bool) error {
+	sets, err := NewCaptureSetsForExport(CaptureRoot(), exportRoot(getAppConfig().Export, volume))
+	if err != nil { return err }
+	if len(sets) == 0 { return errors.New("No new captures to export") }
+	return StartExport(volume, sets, deleteOriginals)
+}
+
+// Get progress of current or last export
+func GetExportProgress() ExportProgress {
+	exportProgressMtx.Lock()
+	defer exportProgressMtx.Unlock()
+	progress := exportProgress
+	progress.Errors = append([]string(nil), progress.Errors...)
+	return progress
+}
@@ -0,0 +1,108 @@
+package irnc
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Create capture files with given contents in temporary capture root
+func writeTestCaptures(t *testing.T, root string, files map[string]string) {
+	for name, content := range files {
+		filename := filepath.Join(root, name)
+		err := os.MkdirAll(filepath.Dir(filename), 0755)
+		if err == nil { err = os.WriteFile(filename, []byte(content), 0644) }
+		if err != nil { t.Fatal("Test capture creation error:", err) }
+	}
+}
+
+func TestExportCaptureSets(t *testing.T) {
+	root := t.TempDir()
+	// stands in for mounted stick
+	destRoot := filepath.Join(t.TempDir(), "irnc")
+	files := map[string]string{
+		"2021.03.01/2021.03.01_10.00.00_n.png": "n photo",
+		"2021.03.01/2021.03.01_10.00.00_ir.png": "ir photo",
+		"2021.03.01/2021.03.01_10.00.00_meta.json": `{"starred":true}`,
+		"2021.03.02/2021.03.02_11.00.00_n.h264": strings.Repeat("n video ", exportCopyBufferSize / 4),
+		"2021.03.02/2021.03.02_11.00.00_ir.h264": "ir video",
+	}
+	writeTestCaptures(t, root, files)
+
+	sets, err := NewCaptureSetsForExport(root, destRoot)
+	if err != nil { t.Fatal("New capture sets listing error:", err) }
+	if len(sets) != 2 { t.Fatal("2 new capture sets expected, got", sets) }
+
+	var last ExportProgress
+	progressUpdates := 0
+	errs := exportCaptureSets(root, destRoot, sets, false, func(progress ExportProgress) {
+		if progress.BytesDone < last.BytesDone { t.Error("Export progress went back") }
+		last = progress
+		progressUpdates++
+	})
+	if len(errs) > 0 { t.Fatal("Export errors:", errs) }
+	if last.Active || last.SetsDone != 2 || last.BytesDone != last.BytesTotal || progressUpdates < 4 {
+		t.Fatalf("Unexpected final progress %+v after %d updates", last, progressUpdates)
+	}
+	for name, content := range files {
+		data, err := os.ReadFile(filepath.Join(destRoot, name))
+		if err != nil || !bytes.Equal(data, []byte(content)) { t.Fatalf("Exported %s differs from original (%v)", name, err) }
+	}
+	checksums, err := os.ReadFile(filepath.Join(destRoot, exportChecksumsFileName))
+	if err != nil { t.Fatal("Checksums reading error:", err) }
+	if lines := strings.Split(strings.TrimSpace(string(checksums)), "\n"); len(lines) != len(files) {
+		t.Fatalf("%d checksums expected, got %q", len(files), checksums)
+	}
+	for name := range files {
+		checksum, _ := fileChecksum(filepath.Join(root, name))
+		if !strings.Contains(string(checksums), checksum + "  " + name + "\n") {
+			t.Fatalf("Checksum of %s is missing in %q", name, checksums)
+		}
+	}
+	leftovers, _ := filepath.Glob(filepath.Join(destRoot, "*", "*.tmp"))
+	if len(leftovers) > 0 { t.Fatal("Temporary files left:", leftovers) }
+
+	// already exported sets are not new
+	sets, err = NewCaptureSetsForExport(root, destRoot)
+	if err != nil || len(sets) != 0 { t.Fatal("No new capture sets expected, got", sets, err) }
+
+	// originals are deleted after verified copy on request
+	writeTestCaptures(t, root, map[string]string{"2021.03.03/2021.03.03_12.00.00_n.png": "new photo"})
+	sets, _ = NewCaptureSetsForExport(root, destRoot)
+	if len(sets) != 1 { t.Fatal("1 new capture set expected, got", sets) }
+	errs = exportCaptureSets(root, destRoot, sets, true, func(ExportProgress) {})
+	if len(errs) > 0 { t.Fatal("Export errors:", errs) }
+	if _, err := os.Stat(filepath.Join(destRoot, "2021.03.03/2021.03.03_12.00.00_n.png")); err != nil {
+		t.Fatal("Exported file is missing:", err)
+	}
+	if _, err := os.Stat(filepath.Join(root, "2021.03.03")); !os.IsNotExist(err) {
+		t.Fatal("Original folder is not deleted:", err)
+	}
+}
+
+func TestDetectExportVolumes(t *testing.T) {
+	mediaDir := t.TempDir()
+	for _, dir := range []string{"STICK", "CARD"} {
+		os.Mkdir(filepath.Join(mediaDir, dir), 0755)
+	}
+	os.WriteFile(filepath.Join(mediaDir, "not_a_volume"), nil, 0644)
+
+	config := ExportConfig{MediaDir: mediaDir, MountPointsOnly: false}
+	volumes, err := DetectExportVolumes(config)
+	if err != nil { t.Fatal("Volume detection error:", err) }
+	expected := []string{filepath.Join(mediaDir, "CARD"), filepath.Join(mediaDir, "STICK")}
+	if strings.Join(volumes, ",") != strings.Join(expected, ",") {
+		t.Fatalf("Volumes %v expected, got %v", expected, volumes)
+	}
+
+	// plain directories on the same filesystem aren't mount points
+	config.MountPointsOnly = true
+	volumes, err = DetectExportVolumes(config)
+	if err != nil || len(volumes) != 0 { t.Fatal("No volumes expected, got", volumes, err) }
+
+	config.MediaDir = filepath.Join(mediaDir, "missing")
+	volumes, err = DetectExportVolumes(config)
+	if err != nil || len(volumes) != 0 { t.Fatal("No volumes expected for missing media directory, got", volumes, err) }
+}
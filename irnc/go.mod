@@ -3,6 +3,12 @@ module irnc
 go 1.16
 
 require (
+	github.com/eclipse/paho.mqtt.golang v1.3.5
+	github.com/minio/minio-go/v7 v7.0.12
+	github.com/pion/webrtc/v3 v3.0.32
+	github.com/warthog618/gpiod v0.6.0
+	go.etcd.io/bbolt v1.3.6
+	golang.org/x/sys v0.0.0-20210630005230-0f9fa26af87c
 	fyne.io/fyne/v2 v2.1.0 // indirect
 	github.com/liyue201/goqr v0.0.0-20200803022322-df443203d4ea // indirect
 	github.com/thinkski/go-v4l2 v0.0.0-20200731060151-2f5aa97606b3 // indirect
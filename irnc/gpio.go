@@ -0,0 +1,261 @@
+package irnc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+	"github.com/warthog618/gpiod"
+)
+
+const gpioEdgeBufferSize = 64
+// quadrature transitions per encoder detent
+const encoderStepsPerDetent = 4
+
+// Level change of input line
+type GPIOEdge struct {
+	Line int
+	// line became active (pressed button for active low lines with pull-up)
+	Active bool
+	Time time.Time
+}
+
+// Source of input line level changes
+type GPIOBackend interface {
+	// Watch lines until context is done, returned channel is closed afterwards
+	Watch(ctx context.Context, lines []int) (<-chan GPIOEdge, error)
+}
+
+// Lines of GPIO character device (active low with pull-up)
+type ChardevGPIOBackend struct {
+	Chip string
+}
+
+// Watch lines of GPIO chip until context is done
+func (b *ChardevGPIOBackend) Watch(ctx context.Context, lines []int) (<-chan GPIOEdge, error) {
+	chip, err := gpiod.NewChip(b.Chip, gpiod.WithConsumer("irnc"))
+	if err != nil { return nil, errors.New(fmt.Sprintf("GPIO chip %s opening error: %v", b.Chip, err)) }
+	edgeCh := make(chan GPIOEdge, gpioEdgeBufferSize)
+	closed := false
+	var edgeChMtx sync.Mutex
+	handler := func(event gpiod.LineEvent) {
+		edgeChMtx.Lock()
+		defer edgeChMtx.Unlock()
+		if closed { return }
+		select {
+			case edgeCh<- GPIOEdge{Line: event.Offset, Active: event.Type == gpiod.LineEventRisingEdge, Time: time.Now()}:
+			default:
+				log.Println("GPIO input is congested, edge dropped on line", event.Offset)
+		}
+	}
+	requestedLines, err := chip.RequestLines(lines, gpiod.AsInput, gpiod.AsActiveLow, gpiod.WithPullUp, gpiod.WithBothEdges, gpiod.WithEventHandler(handler))
+	if err != nil {
+		chip.Close()
+		return nil, errors.New(fmt.Sprintf("GPIO lines %v request error: %v", lines, err))
+	}
+	go func() {
+		<-ctx.Done()
+		requestedLines.Close()
+		chip.Close()
+		edgeChMtx.Lock()
+		closed = true
+		close(edgeCh)
+		edgeChMtx.Unlock()
+	}()
+	return edgeCh, nil
+}
+
+// Backend for tests and machines without GPIO: edges are injected programmatically
+type FakeGPIOBackend struct {
+	edgeCh chan GPIOEdge
+	lines map[int]bool
+	edgeChMtx sync.Mutex
+}
+
+func NewFakeGPIOBackend() *FakeGPIOBackend {
+	return &FakeGPIOBackend{}
+}
+
+// Watch lines until context is done
+func (b *FakeGPIOBackend) Watch(ctx context.Context, lines []int) (<-chan GPIOEdge, error) {
+	b.edgeChMtx.Lock()
+	defer b.edgeChMtx.Unlock()
+	if b.edgeCh != nil {
+		return nil, errors.New("Fake GPIO backend is already watched")
+	}
+	edgeCh := make(chan GPIOEdge, gpioEdgeBufferSize)
+	b.edgeCh = edgeCh
+	b.lines = make(map[int]bool)
+	for _, line := range lines {
+		b.lines[line] = true
+	}
+	go func() {
+		<-ctx.Done()
+		b.edgeChMtx.Lock()
+		defer b.edgeChMtx.Unlock()
+		close(edgeCh)
+		b.edgeCh = nil
+	}()
+	return edgeCh, nil
+}
+
+// Deliver edge to watcher (edges of unwatched lines are ignored)
+func (b *FakeGPIOBackend) Inject(edge GPIOEdge) {
+	b.edgeChMtx.Lock()
+	defer b.edgeChMtx.Unlock()
+	if b.edgeCh == nil || !b.lines[edge.Line] { return }
+	if edge.Time.IsZero() {
+		edge.Time = time.Now()
+	}
+	b.edgeCh<- edge
+}
+
+// Turns raw edges into debounced button presses and encoder detents
+type gpioInput struct {
+	config GPIOConfig
+	// by button line
+	actions map[int]func()
+	// encoder detents, positive for clockwise rotation
+	onRotate func(detents int)
+	// last accepted edge time by button line
+	lastEdge map[int]time.Time
+	// current A/B levels as 2-bit number
+	encoderState int
+	encoderSteps int
+}
+
+// Direction of quadrature transition by (old state << 2 | new state), invalid transitions are ignored
+var quadratureSteps = [16]int{0, 1, -1, 0, -1, 0, 0, 1, 1, 0, 0, -1, 0, -1, 1, 0}
+
+func newGPIOInput(config GPIOConfig, actions map[int]func(), onRotate func(int)) *gpioInput {
+	return &gpioInput{
+		config: config,
+		actions: actions,
+		onRotate: onRotate,
+		lastEdge: make(map[int]time.Time),
+	}
+}
+
+// Get lines to watch
+func (in *gpioInput) lines() (res []int) {
+	for line := range in.actions {
+		res = append(res, line)
+	}
+	if in.encoderEnabled() {
+		res = append(res, in.config.EncoderALine, in.config.EncoderBLine)
+	}
+	return
+}
+
+func (in *gpioInput) encoderEnabled() bool {
+	return in.onRotate != nil && in.config.EncoderALine >= 0 && in.config.EncoderBLine >= 0
+}
+
+// Process single edge
+func (in *gpioInput) handle(edge GPIOEdge) {
+	if in.encoderEnabled() && (edge.Line == in.config.EncoderALine || edge.Line == in.config.EncoderBLine) {
+		in.handleEncoder(edge)
+		return
+	}
+	action, ok := in.actions[edge.Line]
+	if !ok { return }
+	// bounces of press and release follow accepted edge closely
+	if edge.Time.Sub(in.lastEdge[edge.Line]) < in.config.Debounce { return }
+	in.lastEdge[edge.Line] = edge.Time
+	if edge.Active { action() }
+}
+
+// Decode quadrature signal (contact bounce cancels itself out)
+func (in *gpioInput) handleEncoder(edge GPIOEdge) {
+	bit := 1
+	if edge.Line == in.config.EncoderALine { bit = 2 }
+	newState := in.encoderState &^ bit
+	if edge.Active { newState |= bit }
+	in.encoderSteps += quadratureSteps[in.encoderState << 2 | newState]
+	in.encoderState = newState
+	// detent is complete when both lines are back to idle
+	if newState != 0 { return }
+	detents := in.encoderSteps / encoderStepsPerDetent
+	in.encoderSteps = 0
+	if detents != 0 { in.onRotate(detents) }
+}
+
+// Feed edges from backend to input until context is done
+func runGPIOInput(ctx context.Context, backend GPIOBackend, in *gpioInput) error {
+	edgeCh, err := backend.Watch(ctx, in.lines())
+	if err != nil { return err }
+	go func() {
+		for edge := range edgeCh {
+			in.handle(edge)
+		}
+	}()
+	return nil
+}
+
+var gpioCancel context.CancelFunc
+
+// Register physical input, returns true if it only woke dimmed screen
+func wakeByInput() bool {
+	dimmed := BacklightDimmed()
+	NotifyUserActivity()
+	return dimmed
+}
+
+// Run action in background and log its error, input on dimmed screen only wakes it
+func gpioAction(name string, action func() error) func() {
+	return func() {
+		if wakeByInput() { return }
+		go func() {
+			log.Println("GPIO", name)
+			err := action()
+			if err != nil { log.Printf("GPIO %s error: %v", name, err) }
+		}()
+	}
+}
+
+// Start handling physical buttons and rotary encoder (if enabled)
+func startGPIO(config GPIOConfig, backend GPIOBackend) {
+	if config.Chip == "" { return }
+	actions := make(map[int]func())
+	for _, lineActionPair := range []struct{line int; action func()}{
+		{config.SnapshotLine, gpioAction("snapshot", func() error {
+			_, errs := StartSnapshot()
+			if len(errs) > 0 { return errors.New(fmt.Sprint(errs)) }
+			return nil
+		})},
+		{config.RecordLine, gpioAction("record toggle", ToggleRecording)},
+		{config.ExitLine, gpioAction("exit", func() error {
+			RequestExit()
+			return nil
+		})},
+		{config.PaletteLine, gpioAction("palette cycle", CycleIRColorScheme)},
+	} {
+		if lineActionPair.line >= 0 {
+			actions[lineActionPair.line] = lineActionPair.action
+		}
+	}
+	onRotate := func(detents int) {
+		if wakeByInput() { return }
+		zoomPercent := AdjustZoom(detents * int(config.ZoomStepPercent))
+		log.Printf("GPIO zoom %d%%", zoomPercent)
+	}
+	var ctx context.Context
+	ctx, gpioCancel = context.WithCancel(context.Background())
+	err := runGPIOInput(ctx, backend, newGPIOInput(config, actions, onRotate))
+	if err != nil {
+		log.Println("GPIO input error:", err)
+		gpioCancel()
+		gpioCancel = nil
+		return
+	}
+	log.Println("GPIO input started on", config.Chip)
+}
+
+// Stop handling physical inputs
+func stopGPIO() {
+	if gpioCancel == nil { return }
+	gpioCancel()
+	gpioCancel = nil
+}
@@ -0,0 +1,109 @@
+package irnc
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// Start input over fake backend, returned channels receive button presses (line numbers) and encoder detents
+func startFakeGPIOInput(t *testing.T, config GPIOConfig, buttonLines ...int) (*FakeGPIOBackend, <-chan int, <-chan int) {
+	pressCh := make(chan int, 16)
+	rotateCh := make(chan int, 16)
+	actions := make(map[int]func())
+	for _, line := range buttonLines {
+		line := line
+		actions[line] = func() { pressCh<- line }
+	}
+	backend := NewFakeGPIOBackend()
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	err := runGPIOInput(ctx, backend, newGPIOInput(config, actions, func(detents int) { rotateCh<- detents }))
+	if err != nil { t.Fatal("GPIO input start error:", err) }
+	return backend, pressCh, rotateCh
+}
+
+// Wait for single value or fail on timeout
+func receiveGPIOResult(t *testing.T, ch <-chan int) int {
+	select {
+		case v := <-ch:
+			return v
+		case <-time.After(time.Second):
+			t.Fatal("GPIO input result timeout")
+	}
+	return 0
+}
+
+// Fail if channel receives anything shortly
+func expectNoGPIOResult(t *testing.T, ch <-chan int) {
+	select {
+		case v := <-ch:
+			t.Fatal("Unexpected GPIO input result:", v)
+		case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestGPIOButtonDebounce(t *testing.T) {
+	config := GetHardcodedConfig().GPIO
+	config.Debounce = 30 * time.Millisecond
+	backend, pressCh, _ := startFakeGPIOInput(t, config, config.SnapshotLine, config.RecordLine)
+
+	start := time.Now()
+	at := func(ms int) time.Time { return start.Add(time.Duration(ms) * time.Millisecond) }
+	// bouncy press and release
+	for _, edge := range []GPIOEdge{
+		{config.SnapshotLine, true, at(0)},
+		{config.SnapshotLine, false, at(2)},
+		{config.SnapshotLine, true, at(4)},
+		{config.SnapshotLine, false, at(200)},
+		{config.SnapshotLine, true, at(203)},
+		{config.SnapshotLine, false, at(206)},
+	} {
+		backend.Inject(edge)
+	}
+	if line := receiveGPIOResult(t, pressCh); line != config.SnapshotLine {
+		t.Fatalf("Press on line %d expected, got %d", config.SnapshotLine, line)
+	}
+	expectNoGPIOResult(t, pressCh)
+
+	// second press after debounce period and press of other button are not suppressed
+	backend.Inject(GPIOEdge{config.SnapshotLine, true, at(400)})
+	backend.Inject(GPIOEdge{config.RecordLine, true, at(401)})
+	for _, expectedLine := range []int{config.SnapshotLine, config.RecordLine} {
+		if line := receiveGPIOResult(t, pressCh); line != expectedLine {
+			t.Fatalf("Press on line %d expected, got %d", expectedLine, line)
+		}
+	}
+
+	// unwatched line is ignored
+	backend.Inject(GPIOEdge{config.ExitLine, true, at(600)})
+	expectNoGPIOResult(t, pressCh)
+}
+
+func TestGPIOEncoder(t *testing.T) {
+	config := GetHardcodedConfig().GPIO
+	backend, _, rotateCh := startFakeGPIOInput(t, config)
+	a, b := config.EncoderALine, config.EncoderBLine
+
+	// full quadrature cycle (B leads) is one detent
+	for _, edge := range []GPIOEdge{{Line: b, Active: true}, {Line: a, Active: true}, {Line: b}, {Line: a}} {
+		backend.Inject(edge)
+	}
+	if detents := receiveGPIOResult(t, rotateCh); detents != 1 {
+		t.Fatal("1 detent expected, got", detents)
+	}
+
+	// reverse rotation with contact bounce on A
+	for _, edge := range []GPIOEdge{{Line: a, Active: true}, {Line: a}, {Line: a, Active: true}, {Line: b, Active: true}, {Line: a}, {Line: b}} {
+		backend.Inject(edge)
+	}
+	if detents := receiveGPIOResult(t, rotateCh); detents != -1 {
+		t.Fatal("-1 detent expected, got", detents)
+	}
+
+	// incomplete turn returning to idle position is not a detent
+	for _, edge := range []GPIOEdge{{Line: b, Active: true}, {Line: b}} {
+		backend.Inject(edge)
+	}
+	expectNoGPIOResult(t, rotateCh)
+}
@@ -0,0 +1,501 @@
+package irnc
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+// Location reported by receiver
+type GPSPosition struct {
+	Latitude float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+	// above mean sea level, 0 if unknown
+	AltitudeM float64 `json:"altitude_m,omitempty"`
+	// fix quality: "gps", "dgps", "rtk", "rtk_float", "estimated", "manual", "simulated"
+	Quality string `json:"quality"`
+	Satellites int `json:"satellites,omitempty"`
+	HDOP float64 `json:"hdop,omitempty"`
+	// UTC time of fix reported by receiver, zero until receiver reports date
+	Time time.Time `json:"time"`
+}
+
+type GPSState string
+
+const (
+	GPSDisabled GPSState = "disabled"
+	// receiver isn't connected or doesn't talk
+	GPSOffline GPSState = "offline"
+	GPSNoFix GPSState = "no_fix"
+	GPSFix GPSState = "fix"
+)
+
+type GPSStatus struct {
+	State GPSState `json:"state"`
+	// last valid fix, may be outdated unless state is "fix"
+	Position *GPSPosition `json:"position,omitempty"`
+}
+
+// Receiver state shared by location sources
+type gpsTracker struct {
+	maxFixAge time.Duration
+	connected bool
+	// last valid fix and when it was received
+	fix *GPSPosition
+	fixReceived time.Time
+	// last update had no fix
+	lost bool
+	mtx sync.Mutex
+}
+
+// Location source feeding tracker
+type gpsSource interface {
+	// connect and feed tracker until connection fails or context is done
+	run(ctx context.Context, t *gpsTracker) error
+	String() string
+}
+
+// NMEA receiver on serial device (or any readable file, e.g. FIFO with replayed log)
+type nmeaSerialSource struct {
+	device string
+	baudRate uint
+}
+
+// gpsd daemon reporting JSON
+type gpsdSource struct {
+	address string
+}
+
+// Accumulates NMEA sentences of receiver into fixes
+type nmeaDecoder struct {
+	// UTC date from last RMC sentence, advanced when time of day wraps past midnight
+	date time.Time
+	// time of last decoded sentence
+	last time.Time
+	// GGA is preferred source of fixes, RMC is used only for receivers without it
+	ggaSeen bool
+}
+
+var gpsTrackerInstance *gpsTracker
+var gpsTrackerMtx sync.Mutex
+var gpsCancel context.CancelFunc
+var gpsDone chan struct{}
+
+// NMEA GGA fix quality indicator names (0 is no fix)
+var nmeaQualities = map[string]string{"1": "gps", "2": "dgps", "3": "gps", "4": "rtk", "5": "rtk_float", "6": "estimated", "7": "manual", "8": "simulated"}
+// gpsd TPV status names (0 and 1 are plain fix)
+var gpsdQualities = map[int]string{2: "dgps", 3: "rtk", 4: "rtk_float", 5: "estimated", 6: "estimated", 8: "simulated"}
+
+var serialSpeeds = map[uint]uint32{
+	4800: syscall.B4800,
+	9600: syscall.B9600,
+	19200: syscall.B19200,
+	38400: syscall.B38400,
+	57600: syscall.B57600,
+	115200: syscall.B115200,
+}
+
+// Factory function for gpsTracker
+func newGPSTracker(maxFixAge time.Duration) *gpsTracker {
+	return &gpsTracker{maxFixAge: maxFixAge}
+}
+
+// Mark receiver as connected or disconnected
+func (t *gpsTracker) setConnected(connected bool) {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	t.connected = connected
+}
+
+// Store fix reported by receiver, nil means receiver has no fix
+func (t *gpsTracker) update(fix *GPSPosition) {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	t.connected = true
+	t.lost = fix == nil
+	if fix == nil { return }
+	fixCopy := *fix
+	t.fix = &fixCopy
+	t.fixReceived = time.Now()
+}
+
+// Get current fix, nil if there is none or it's outdated
+func (t *gpsTracker) position() *GPSPosition {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	if !t.connected || t.lost || t.fix == nil || time.Since(t.fixReceived) > t.maxFixAge { return nil }
+	fix := *t.fix
+	return &fix
+}
+
+// Get receiver state with last fix
+func (t *gpsTracker) status() GPSStatus {
+	current := t.position()
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	status := GPSStatus{State: GPSOffline}
+	if t.fix != nil {
+		fix := *t.fix
+		status.Position = &fix
+	}
+	switch {
+		case current != nil:
+			status.State = GPSFix
+		case t.connected:
+			status.State = GPSNoFix
+	}
+	return status
+}
+
+// Check "*hh" checksum of NMEA sentence and split it into fields
+func splitNMEASentence(line string) ([]string, error) {
+	line = strings.TrimSpace(line)
+	if !strings.HasPrefix(line, "$") { return nil, errors.New(fmt.Sprintf("Not a NMEA sentence: %q", line)) }
+	body := line[1:]
+	if i := strings.LastIndex(body, "*"); i >= 0 {
+		expected, err := strconv.ParseUint(body[i + 1:], 16, 8)
+		if err != nil { return nil, errors.New(fmt.Sprintf("Invalid NMEA checksum in %q", line)) }
+		body = body[:i]
+		var checksum byte
+		for j := 0; j < len(body); j++ {
+			checksum ^= body[j]
+		}
+		if uint64(checksum) != expected { return nil, errors.New(fmt.Sprintf("NMEA checksum mismatch in %q", line)) }
+	}
+	return strings.Split(body, ","), nil
+}
+
+// Parse NMEA coordinate "dddmm.mmmm" with hemisphere into degrees
+func parseNMEACoordinate(value, hemisphere string) (float64, error) {
+	i := strings.Index(value, ".")
+	if i < 0 { i = len(value) }
+	if i < 2 { return 0, errors.New(fmt.Sprintf("Invalid NMEA coordinate %q", value)) }
+	degrees, err := strconv.ParseFloat(value[:i - 2], 64)
+	if err != nil { return 0, errors.New(fmt.Sprintf("Invalid NMEA coordinate %q", value)) }
+	minutes, err := strconv.ParseFloat(value[i - 2:], 64)
+	if err != nil { return 0, errors.New(fmt.Sprintf("Invalid NMEA coordinate %q", value)) }
+	res := degrees + minutes / 60
+	switch hemisphere {
+		case "N", "E":
+			return res, nil
+		case "S", "W":
+			return -res, nil
+	}
+	return 0, errors.New(fmt.Sprintf("Invalid NMEA hemisphere %q", hemisphere))
+}
+
+// Parse NMEA time of day "hhmmss.ss" on given UTC date
+func parseNMEATime(value string, date time.Time) (time.Time, error) {
+	if len(value) < 6 { return time.Time{}, errors.New(fmt.Sprintf("Invalid NMEA time %q", value)) }
+	clock, err := time.Parse("150405", value[:6])
+	if err != nil { return time.Time{}, err }
+	var nanos int
+	if len(value) > 7 && value[6] == '.' {
+		fraction, err := strconv.ParseFloat(value[6:], 64)
+		if err == nil { nanos = int(fraction * float64(time.Second)) }
+	}
+	return time.Date(date.Year(), date.Month(), date.Day(), clock.Hour(), clock.Minute(), clock.Second(), nanos, time.UTC), nil
+}
+
+// Parse latitude and longitude fields of NMEA sentence
+func parseNMEAPosition(fields []string) (lat, lon float64, err error) {
+	lat, err = parseNMEACoordinate(fields[0], fields[1])
+	if err != nil { return }
+	lon, err = parseNMEACoordinate(fields[2], fields[3])
+	return
+}
+
+// Get UTC time of fix from NMEA time of day, zero while date is unknown (receivers report it in RMC only)
+func (d *nmeaDecoder) fixTime(value string) (time.Time, error) {
+	if d.date.IsZero() { return time.Time{}, nil }
+	t, err := parseNMEATime(value, d.date)
+	if err != nil { return time.Time{}, err }
+	// GGA after midnight comes before RMC with new date
+	if !d.last.IsZero() && d.last.Sub(t) > 12 * time.Hour {
+		d.date = d.date.AddDate(0, 0, 1)
+		t = t.AddDate(0, 0, 1)
+	}
+	d.last = t
+	return t, nil
+}
+
+// Decode NMEA sentence, return true with fix (nil if receiver has none) for sentences reporting it
+func (d *nmeaDecoder) decode(line string) (*GPSPosition, bool, error) {
+	fields, err := splitNMEASentence(line)
+	if err != nil { return nil, false, err }
+	if len(fields[0]) < 5 { return nil, false, nil }
+	// talker id ("GP", "GN", "GL", ...) doesn't matter
+	switch fields[0][len(fields[0]) - 3:] {
+		case "GGA":
+			// time, lat, N/S, lon, E/W, quality, satellites, HDOP, altitude, M, ...
+			if len(fields) < 10 { return nil, false, errors.New(fmt.Sprintf("Short NMEA GGA sentence %q", line)) }
+			d.ggaSeen = true
+			quality, valid := nmeaQualities[fields[6]]
+			if !valid { return nil, true, nil }
+			fix := &GPSPosition{Quality: quality}
+			fix.Latitude, fix.Longitude, err = parseNMEAPosition(fields[2:6])
+			if err != nil { return nil, false, err }
+			fix.Time, err = d.fixTime(fields[1])
+			if err != nil { return nil, false, err }
+			fix.Satellites, _ = strconv.Atoi(fields[7])
+			fix.HDOP, _ = strconv.ParseFloat(fields[8], 64)
+			fix.AltitudeM, _ = strconv.ParseFloat(fields[9], 64)
+			return fix, true, nil
+		case "RMC":
+			// time, status, lat, N/S, lon, E/W, speed, course, date, ...
+			if len(fields) < 10 { return nil, false, errors.New(fmt.Sprintf("Short NMEA RMC sentence %q", line)) }
+			date, err := time.Parse("020106", fields[9])
+			if err == nil { d.date = date }
+			if d.ggaSeen { return nil, false, nil }
+			if fields[2] != "A" { return nil, true, nil }
+			fix := &GPSPosition{Quality: "gps"}
+			fix.Latitude, fix.Longitude, err = parseNMEAPosition(fields[3:7])
+			if err != nil { return nil, false, err }
+			fix.Time, err = d.fixTime(fields[1])
+			if err != nil { return nil, false, err }
+			return fix, true, nil
+	}
+	return nil, false, nil
+}
+
+// Feed tracker with NMEA sentences until reading fails (corrupted sentences are skipped)
+func readNMEA(r io.Reader, t *gpsTracker) error {
+	decoder := &nmeaDecoder{}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.TrimSpace(line) == "" { continue }
+		fix, reported, err := decoder.decode(line)
+		if err != nil {
+			log.Println("NMEA decoding error:", err)
+			continue
+		}
+		if reported { t.update(fix) }
+	}
+	if err := scanner.Err(); err != nil { return err }
+	return io.EOF
+}
+
+// Switch serial device to raw mode with given speed
+func configureSerial(file *os.File, baudRate uint) error {
+	speed, ok := serialSpeeds[baudRate]
+	if !ok { return errors.New(fmt.Sprintf("Unsupported baud rate %d", baudRate)) }
+	termios := syscall.Termios{
+		Cflag: speed | syscall.CS8 | syscall.CREAD | syscall.CLOCAL,
+		Ispeed: speed,
+		Ospeed: speed,
+	}
+	termios.Cc[syscall.VMIN] = 1
+	conn, err := file.SyscallConn()
+	if err != nil { return err }
+	var errno syscall.Errno
+	err = conn.Control(func(fd uintptr) {
+		_, _, errno = syscall.Syscall(syscall.SYS_IOCTL, fd, syscall.TCSETS, uintptr(unsafe.Pointer(&termios)))
+	})
+	if err != nil { return err }
+	if errno != 0 { return errno }
+	return nil
+}
+
+// Close closer once context is done (unblocking its reading), returned function stops waiting
+func closeOnDone(ctx context.Context, closer io.Closer) func() {
+	stop := make(chan struct{})
+	go func() {
+		select {
+			case <-ctx.Done():
+				closer.Close()
+			case <-stop:
+		}
+	}()
+	return func() { close(stop) }
+}
+
+// Read NMEA from serial device
+func (s *nmeaSerialSource) run(ctx context.Context, t *gpsTracker) error {
+	file, err := os.OpenFile(s.device, os.O_RDONLY|syscall.O_NOCTTY, 0)
+	if err != nil { return err }
+	defer file.Close()
+	err = configureSerial(file, s.baudRate)
+	if err == syscall.ENOTTY {
+		log.Printf("%s is not a serial device, it's read as is", s.device)
+	} else if err != nil {
+		return err
+	}
+	defer closeOnDone(ctx, file)()
+	return readNMEA(file, t)
+}
+
+// Describe source for logs
+func (s *nmeaSerialSource) String() string {
+	return fmt.Sprintf("NMEA %s", s.device)
+}
+
+// Part of gpsd report used for fixes
+type gpsdReport struct {
+	Class string `json:"class"`
+	// TPV: 0/1 - no fix, 2 - 2D, 3 - 3D
+	Mode int `json:"mode"`
+	Status int `json:"status"`
+	Time time.Time `json:"time"`
+	Lat float64 `json:"lat"`
+	Lon float64 `json:"lon"`
+	// older gpsd reports "alt" only
+	Alt float64 `json:"alt"`
+	AltMSL float64 `json:"altMSL"`
+	// SKY
+	HDOP float64 `json:"hdop"`
+	Satellites []struct{
+		Used bool `json:"used"`
+	} `json:"satellites"`
+}
+
+// Feed tracker with gpsd reports until reading fails (SKY reports complete following TPV ones)
+func readGPSD(r io.Reader, t *gpsTracker) error {
+	var satellites int
+	var hdop float64
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		var report gpsdReport
+		err := json.Unmarshal(scanner.Bytes(), &report)
+		if err != nil {
+			log.Println("gpsd report decoding error:", err)
+			continue
+		}
+		switch report.Class {
+			case "SKY":
+				satellites, hdop = 0, report.HDOP
+				for _, satellite := range report.Satellites {
+					if satellite.Used { satellites++ }
+				}
+			case "TPV":
+				if report.Mode < 2 {
+					t.update(nil)
+					continue
+				}
+				quality, ok := gpsdQualities[report.Status]
+				if !ok { quality = "gps" }
+				fix := &GPSPosition{Latitude: report.Lat, Longitude: report.Lon, Quality: quality, Satellites: satellites, HDOP: hdop, Time: report.Time.UTC()}
+				if report.Mode == 3 {
+					fix.AltitudeM = report.AltMSL
+					if fix.AltitudeM == 0 { fix.AltitudeM = report.Alt }
+				}
+				t.update(fix)
+		}
+	}
+	if err := scanner.Err(); err != nil { return err }
+	return io.EOF
+}
+
+// Watch gpsd reports
+func (s *gpsdSource) run(ctx context.Context, t *gpsTracker) error {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", s.address)
+	if err != nil { return err }
+	defer conn.Close()
+	_, err = io.WriteString(conn, `?WATCH={"enable":true,"json":true};` + "\n")
+	if err != nil { return err }
+	defer closeOnDone(ctx, conn)()
+	return readGPSD(conn, t)
+}
+
+// Describe source for logs
+func (s *gpsdSource) String() string {
+	return fmt.Sprintf("gpsd %s", s.address)
+}
+
+// Keep reading source, reconnect after failures until context is done
+func runGPS(ctx context.Context, source gpsSource, t *gpsTracker, retryInterval time.Duration) {
+	lastErr := ""
+	for {
+		err := source.run(ctx, t)
+		t.setConnected(false)
+		if ctx.Err() != nil { return }
+		// unplugged receiver isn't reported on every retry
+		if err.Error() != lastErr {
+			log.Printf("%s error: %v", source, err)
+			lastErr = err.Error()
+		}
+		select {
+			case <-ctx.Done():
+				return
+			case <-time.After(retryInterval):
+		}
+	}
+}
+
+// Create location source from configuration
+func newGPSSource(config GPSConfig) (gpsSource, error) {
+	switch config.Source {
+		case "nmea":
+			return &nmeaSerialSource{device: config.Device, baudRate: config.BaudRate}, nil
+		case "gpsd":
+			return &gpsdSource{address: config.GPSDAddress}, nil
+	}
+	return nil, errors.New(fmt.Sprintf("Unknown GPS source %q", config.Source))
+}
+
+// Get running tracker, nil if GPS is disabled
+func getGPSTracker() *gpsTracker {
+	gpsTrackerMtx.Lock()
+	defer gpsTrackerMtx.Unlock()
+	return gpsTrackerInstance
+}
+
+// Get current position for captures, nil if there is no recent fix
+func CurrentPosition() *GPSPosition {
+	t := getGPSTracker()
+	if t == nil { return nil }
+	return t.position()
+}
+
+// Get receiver state with last fix
+func GetGPSStatus() GPSStatus {
+	t := getGPSTracker()
+	if t == nil { return GPSStatus{State: GPSDisabled} }
+	return t.status()
+}
+
+// Track position in background (if enabled)
+func startGPS(config GPSConfig) {
+	if config.Source == "" { return }
+	source, err := newGPSSource(config)
+	if err != nil {
+		log.Println("GPS configuration error:", err)
+		return
+	}
+	t := newGPSTracker(config.MaxFixAge)
+	gpsTrackerMtx.Lock()
+	gpsTrackerInstance = t
+	gpsTrackerMtx.Unlock()
+	var ctx context.Context
+	ctx, gpsCancel = context.WithCancel(context.Background())
+	gpsDone = make(chan struct{})
+	go func() {
+		defer close(gpsDone)
+		runGPS(ctx, source, t, config.RetryInterval)
+	}()
+	log.Println("GPS started:", source)
+}
+
+// Stop position tracking
+func stopGPS() {
+	if gpsCancel == nil { return }
+	gpsCancel()
+	<-gpsDone
+	gpsCancel = nil
+	gpsTrackerMtx.Lock()
+	gpsTrackerInstance = nil
+	gpsTrackerMtx.Unlock()
+}
@@ -0,0 +1,140 @@
+package irnc
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"math"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Complete NMEA sentence body with checksum
+func nmeaSentence(body string) string {
+	var checksum byte
+	for i := 0; i < len(body); i++ {
+		checksum ^= body[i]
+	}
+	return fmt.Sprintf("$%s*%02X", body, checksum)
+}
+
+// Wait until tracker has position
+func waitForPosition(t *testing.T, tracker *gpsTracker) *GPSPosition {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if position := tracker.position(); position != nil { return position }
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("No position received, status:", tracker.status())
+	return nil
+}
+
+func TestNMEAReplay(t *testing.T) {
+	// receiver acquiring fix, with line noise
+	log := strings.Join([]string{
+		nmeaSentence("GPRMC,095959.00,V,,,,,,,010321,,,N"),
+		nmeaSentence("GPGGA,095959.00,,,,,0,00,99.99,,,,,,"),
+		"$GPGGA,garbage*00",
+		nmeaSentence("GNRMC,100000.00,A,5003.00000,N,01430.00000,E,0.0,,010321,,,A"),
+		nmeaSentence("GNGGA,100000.50,5003.00000,N,01430.00000,E,2,08,0.9,245.3,M,45.0,M,,"),
+	}, "\r\n") + "\r\n"
+	filename := filepath.Join(t.TempDir(), "nmea.log")
+	err := os.WriteFile(filename, []byte(log), 0644)
+	if err != nil { t.Fatal(err) }
+
+	tracker := newGPSTracker(time.Minute)
+	source := &nmeaSerialSource{device: filename, baudRate: 9600}
+	err = source.run(context.Background(), tracker)
+	if err == nil || tracker.status().State != GPSFix { t.Fatalf("Fix expected after replay until end of log, got %+v (%v)", tracker.status(), err) }
+	position := tracker.position()
+	expectedTime := time.Date(2021, 3, 1, 10, 0, 0, int(500 * time.Millisecond), time.UTC)
+	if math.Abs(position.Latitude - 50.05) > 1e-9 || math.Abs(position.Longitude - 14.5) > 1e-9 || position.Quality != "dgps" ||
+		position.Satellites != 8 || position.HDOP != 0.9 || position.AltitudeM != 245.3 || !position.Time.Equal(expectedTime) {
+		t.Fatalf("Unexpected position %+v", position)
+	}
+
+	// lost fix isn't attached to captures, but is remembered
+	tracker.update(nil)
+	if tracker.position() != nil || tracker.status().State != GPSNoFix || tracker.status().Position == nil {
+		t.Fatalf("Unexpected status after fix loss %+v", tracker.status())
+	}
+
+	// receivers without GGA report fixes by RMC, southern and western hemispheres are negative
+	decoder := &nmeaDecoder{}
+	fix, reported, err := decoder.decode(nmeaSentence("GPRMC,235959,A,3351.00000,S,15112.00000,W,0.0,,311221,,,A"))
+	if err != nil || !reported || fix == nil { t.Fatal("RMC fix expected, got", fix, reported, err) }
+	if math.Abs(fix.Latitude + 33.85) > 1e-9 || math.Abs(fix.Longitude + 151.2) > 1e-9 || !fix.Time.Equal(time.Date(2021, 12, 31, 23, 59, 59, 0, time.UTC)) {
+		t.Fatalf("Unexpected RMC fix %+v", fix)
+	}
+	_, _, err = decoder.decode(strings.Replace(nmeaSentence("GPGGA,100000,5003.0,N,01430.0,E,1,05,1.0,0,M,,,,"), "5003.0", "5004.0", 1))
+	if err == nil { t.Fatal("Checksum mismatch isn't detected") }
+}
+
+func TestNMEAFixDate(t *testing.T) {
+	decoder := &nmeaDecoder{}
+	// date isn't guessed before first RMC
+	fix, _, err := decoder.decode(nmeaSentence("GPGGA,235958,5003.0,N,01430.0,E,1,05,1.0,0,M,,,,"))
+	if err != nil || fix == nil || !fix.Time.IsZero() { t.Fatal("Fix without time expected, got", fix, err) }
+	_, _, err = decoder.decode(nmeaSentence("GPRMC,235959,A,5003.0,N,01430.0,E,0.0,,311221,,,A"))
+	if err != nil { t.Fatal(err) }
+	fix, _, err = decoder.decode(nmeaSentence("GPGGA,235959,5003.0,N,01430.0,E,1,05,1.0,0,M,,,,"))
+	if err != nil || !fix.Time.Equal(time.Date(2021, 12, 31, 23, 59, 59, 0, time.UTC)) { t.Fatal("Unexpected fix time", fix, err) }
+	// GGA after midnight precedes RMC with new date
+	fix, _, err = decoder.decode(nmeaSentence("GPGGA,000000,5003.0,N,01430.0,E,1,05,1.0,0,M,,,,"))
+	if err != nil || !fix.Time.Equal(time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)) { t.Fatal("Date isn't rolled over", fix, err) }
+	_, _, err = decoder.decode(nmeaSentence("GPRMC,000000,A,5003.0,N,01430.0,E,0.0,,010122,,,A"))
+	if err != nil { t.Fatal(err) }
+	fix, _, err = decoder.decode(nmeaSentence("GPGGA,000001,5003.0,N,01430.0,E,1,05,1.0,0,M,,,,"))
+	if err != nil || !fix.Time.Equal(time.Date(2022, 1, 1, 0, 0, 1, 0, time.UTC)) { t.Fatal("Unexpected fix time after RMC", fix, err) }
+}
+
+func TestGPSDSource(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil { t.Fatal(err) }
+	defer listener.Close()
+	watchCh := make(chan string, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil { return }
+		defer conn.Close()
+		conn.Write([]byte(`{"class":"VERSION","release":"3.22","proto_major":3,"proto_minor":14}` + "\n"))
+		watch, _ := bufio.NewReader(conn).ReadString('\n')
+		watchCh <- watch
+		for _, report := range []string{
+			`{"class":"TPV","device":"/dev/ttyACM0","mode":1}`,
+			`{"class":"SKY","device":"/dev/ttyACM0","hdop":1.2,"satellites":[{"PRN":1,"used":true},{"PRN":2,"used":true},{"PRN":3,"used":false}]}`,
+			`{"class":"TPV","device":"/dev/ttyACM0","mode":3,"status":2,"time":"2021-03-01T10:00:00.000Z","lat":50.05,"lon":14.5,"altHAE":290.3,"altMSL":245.3}`,
+		} {
+			conn.Write([]byte(report + "\n"))
+		}
+		// connection stays open like real gpsd
+		time.Sleep(10 * time.Second)
+	}()
+
+	tracker := newGPSTracker(time.Minute)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		runGPS(ctx, &gpsdSource{address: listener.Addr().String()}, tracker, time.Second)
+		close(done)
+	}()
+	position := waitForPosition(t, tracker)
+	if !strings.HasPrefix(<-watchCh, `?WATCH={"enable":true,"json":true}`) { t.Fatal("gpsd watch isn't requested") }
+	if position.Latitude != 50.05 || position.Longitude != 14.5 || position.AltitudeM != 245.3 || position.Quality != "dgps" ||
+		position.Satellites != 2 || position.HDOP != 1.2 || !position.Time.Equal(time.Date(2021, 3, 1, 10, 0, 0, 0, time.UTC)) {
+		t.Fatalf("Unexpected position %+v", position)
+	}
+	// open connection doesn't delay stop
+	cancel()
+	select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Fatal("gpsd reading isn't stopped")
+	}
+	if tracker.status().State != GPSOffline { t.Fatal("Receiver expected to be offline after stop, got", tracker.status()) }
+}
@@ -2,6 +2,7 @@ package irnc
 
 import (
 	"image"
+	"image/color"
 	"reflect"
 	"unsafe"
 )
@@ -105,6 +106,29 @@ func SetupChannelDecoder(decoder VideoDecoder, nalCh <-chan []byte) <-chan Decod
 	return resCh
 }
 
+// Convert image to 4:2:0 YCbCr with even dimensions (the only layout accepted by common H264 decoders)
+func ToYCbCr420(img image.Image) *image.YCbCr {
+	if ycbcr, ok := img.(*image.YCbCr); ok && ycbcr.SubsampleRatio == image.YCbCrSubsampleRatio420 {
+		return ycbcr
+	}
+	bounds := img.Bounds()
+	width := bounds.Dx() &^ 1
+	height := bounds.Dy() &^ 1
+	res := image.NewYCbCr(image.Rect(0, 0, width, height), image.YCbCrSubsampleRatio420)
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			r, g, b, _ := img.At(bounds.Min.X + x, bounds.Min.Y + y).RGBA()
+			yy, cb, cr := color.RGBToYCbCr(uint8(r >> 8), uint8(g >> 8), uint8(b >> 8))
+			res.Y[res.YOffset(x, y)] = yy
+			if x % 2 == 0 && y % 2 == 0 {
+				res.Cb[res.COffset(x, y)] = cb
+				res.Cr[res.COffset(x, y)] = cr
+			}
+		}
+	}
+	return res
+}
+
 // Convert unsafe pointer from C to byte slice
 func CPtr2UIntSlice(buf unsafe.Pointer, size int) (res []uint8) {
 	sliceHeader := (*reflect.SliceHeader)(unsafe.Pointer(&res))
@@ -75,6 +75,11 @@ func (decoder *H264Decoder) Decode(nal []byte) (frame image.Image, err error) {
 	
 	frameWidth := int(decoder.decoderImpl.frame.width)
 	frameHeight := int(decoder.decoderImpl.frame.height)
+	if decoder.decoderImpl.frame.format == C.AV_PIX_FMT_GBRP {
+		// RGB stream (libx264rgb), planes are in G, B, R order
+		frame = decoder.gbrpFrameToRGBImage(frameWidth, frameHeight)
+		return
+	}
 	yStride := int(decoder.decoderImpl.frame.linesize[0])
 	cStride := int(decoder.decoderImpl.frame.linesize[1])
 
@@ -91,6 +96,29 @@ func (decoder *H264Decoder) Decode(nal []byte) (frame image.Image, err error) {
 	return
 }
 
+// Copy planar GBR frame to packed RGB image
+func (decoder *H264Decoder) gbrpFrameToRGBImage(frameWidth, frameHeight int) *RGBImage {
+	stride := int(decoder.decoderImpl.frame.linesize[0])
+	g := CPtr2UIntSlice(unsafe.Pointer(decoder.decoderImpl.frame.data[0]), stride*frameHeight)
+	b := CPtr2UIntSlice(unsafe.Pointer(decoder.decoderImpl.frame.data[1]), stride*frameHeight)
+	r := CPtr2UIntSlice(unsafe.Pointer(decoder.decoderImpl.frame.data[2]), stride*frameHeight)
+	data := make([]byte, frameWidth*frameHeight*3)
+	for y := 0; y < frameHeight; y++ {
+		for x := 0; x < frameWidth; x++ {
+			offset := (y*frameWidth + x)*3
+			planeOffset := y*stride + x
+			data[offset] = r[planeOffset]
+			data[offset + 1] = g[planeOffset]
+			data[offset + 2] = b[planeOffset]
+		}
+	}
+	return &RGBImage{
+		data: data,
+		dataWidth: uint(frameWidth),
+		rect: image.Rect(0, 0, frameWidth, frameHeight),
+	}
+}
+
 // Deallocate resources
 func (decoder *H264Decoder) Destroy() error {
 	C.avcodec_free_context(&decoder.decoderImpl.context)
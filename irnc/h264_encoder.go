@@ -5,6 +5,7 @@ package irnc
 #include <libavformat/avformat.h>
 #include <libavutil/avutil.h>
 #include <libavutil/avconfig.h>
+#include <libavutil/opt.h>
 
 typedef struct {
 	AVCodec *codec;
@@ -27,6 +28,8 @@ import (
 type H264Encoder struct {
 	encoderImpl C.h264encoder_t
 	bitrate, framerate uint
+	// no B-frames and minimal buffering for live streaming (browser-decodable profile for YUV input)
+	lowLatency bool
 }
 
 // Initialize encoder based on sample image format
@@ -62,6 +65,18 @@ func (encoder *H264Encoder) InitBySample(img image.Image) (header []byte, err er
 	encoder.encoderImpl.context.time_base = C.av_make_q(1, C.int(encoder.framerate))
 	encoder.encoderImpl.context.pix_fmt = pix_fmt
 	encoder.encoderImpl.context.flags |= C.AV_CODEC_FLAG_GLOBAL_HEADER
+	if encoder.lowLatency {
+		encoder.encoderImpl.context.max_b_frames = 0
+		encoder.encoderImpl.context.gop_size = C.int(encoder.framerate)
+		for _, opt := range [][2]string{{"tune", "zerolatency"}, {"preset", "ultrafast"}, {"profile", "baseline"}} {
+			if opt[0] == "profile" && pix_fmt != C.AV_PIX_FMT_YUV420P { continue }
+			optName := C.CString(opt[0])
+			optValue := C.CString(opt[1])
+			C.av_opt_set(encoder.encoderImpl.context.priv_data, optName, optValue, 0)
+			C.free(unsafe.Pointer(optName))
+			C.free(unsafe.Pointer(optValue))
+		}
+	}
 	encoder.encoderImpl.frame = C.av_frame_alloc()
 	if encoder.encoderImpl.frame == nil {
 		err = errors.New("Can't allocate frame for encoder")
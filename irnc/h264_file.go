@@ -0,0 +1,121 @@
+package irnc
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"image"
+	"io"
+	"log"
+	"os"
+)
+
+var annexBStartCode = []byte{0, 0, 1}
+// H264 files are read in chunks of that size, so long recordings aren't held in memory
+const h264FileReadSize = 256 << 10
+
+// Split Annex B byte stream into access units (parameter sets are joined with following slice), one slice per picture is assumed
+func SplitH264AccessUnits(data []byte) (res [][]byte) {
+	start := bytes.Index(data, annexBStartCode)
+	if start < 0 { return }
+	auStart := start
+	// 4-byte start code, like following ones
+	if auStart > 0 && data[auStart - 1] == 0 { auStart-- }
+	for start >= 0 {
+		next := bytes.Index(data[start + len(annexBStartCode):], annexBStartCode)
+		end := len(data)
+		if next >= 0 {
+			next += start + len(annexBStartCode)
+			end = next
+			// 4-byte start code belongs to next NAL
+			if end > 0 && data[end - 1] == 0 { end-- }
+		}
+		nalType := byte(0)
+		if start + len(annexBStartCode) < len(data) {
+			nalType = data[start + len(annexBStartCode)] & 0x1f
+		}
+		// coded slice of non-IDR or IDR picture ends access unit
+		if nalType == 1 || nalType == 5 {
+			res = append(res, data[auStart:end])
+			auStart = end
+		}
+		start = next
+	}
+	return
+}
+
+// Check whether Annex B data contains IDR slice, decoding can start from it
+func isH264Keyframe(data []byte) bool {
+	for start := bytes.Index(data, annexBStartCode); start >= 0; {
+		start += len(annexBStartCode)
+		if start < len(data) && data[start] & 0x1f == 5 { return true }
+		next := bytes.Index(data[start:], annexBStartCode)
+		if next < 0 { break }
+		start += next
+	}
+	return false
+}
+
+// Copy decoded image, so it survives reuse of decoder buffers
+func copyDecodedImage(img image.Image) image.Image {
+	ycbcr, ok := img.(*image.YCbCr)
+	if !ok { return img }
+	res := *ycbcr
+	res.Y = append([]uint8(nil), ycbcr.Y...)
+	res.Cb = append([]uint8(nil), ycbcr.Cb...)
+	res.Cr = append([]uint8(nil), ycbcr.Cr...)
+	return &res
+}
+
+// Read Annex B stream chunk by chunk and send its access units until stream end or context is done
+func sendH264AccessUnits(ctx context.Context, r io.Reader, auCh chan<- []byte) error {
+	reader := bufio.NewReaderSize(r, h264FileReadSize)
+	chunk := make([]byte, h264FileReadSize)
+	var pending []byte
+	for {
+		n, err := reader.Read(chunk)
+		pending = append(pending, chunk[:n]...)
+		eof := err == io.EOF
+		if err != nil && !eof { return err }
+		complete := SplitH264AccessUnits(pending)
+		// last access unit may continue in next chunk
+		if !eof && len(complete) > 0 { complete = complete[:len(complete) - 1] }
+		consumed := 0
+		for _, accessUnit := range complete {
+			select {
+				case <-ctx.Done():
+					return ctx.Err()
+				case auCh<- accessUnit:
+			}
+			// access units are slices of pending data
+			consumed = cap(pending) - cap(accessUnit) + len(accessUnit)
+		}
+		if eof { return nil }
+		// remainder goes to new buffer, so sent data can be freed once decoded
+		if consumed > 0 { pending = append([]byte(nil), pending[consumed:]...) }
+	}
+}
+
+// Decode H264 file frame by frame until file end or context is done, returned channel must be read until closed
+func DecodeH264File(ctx context.Context, filename string) (<-chan Decoded, error) {
+	file, err := os.Open(filename)
+	if err != nil { return nil, err }
+	nalCh := make(chan []byte)
+	go func() {
+		defer close(nalCh)
+		defer file.Close()
+		err := sendH264AccessUnits(ctx, file, nalCh)
+		if err != nil && ctx.Err() == nil { log.Println("H264 file reading error:", err) }
+	}()
+	resCh := make(chan Decoded)
+	go func() {
+		defer close(resCh)
+		for decoded := range SetupChannelDecoder(&H264Decoder{}, nalCh) {
+			if decoded.Error == nil {
+				decoded.Result = copyDecodedImage(decoded.Result)
+			}
+			resCh<- decoded
+		}
+	}()
+	return resCh, nil
+}
@@ -0,0 +1,57 @@
+package irnc
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"testing/iotest"
+)
+
+// Annex B NAL unit with given type and payload of non-zero bytes
+func testNAL(startCode []byte, nalType byte, size int) []byte {
+	nal := append(append([]byte(nil), startCode...), 0x60 | nalType)
+	for i := 0; i < size; i++ {
+		nal = append(nal, byte(1 + i % 251))
+	}
+	return nal
+}
+
+func TestSendH264AccessUnits(t *testing.T) {
+	short, long := annexBStartCode, append([]byte{0}, annexBStartCode...)
+	var expected [][]byte
+	var stream []byte
+	for i := 0; i < 12; i++ {
+		var au []byte
+		if i % 4 == 0 {
+			// parameter sets are joined with IDR slice
+			au = append(testNAL(long, 7, 10), testNAL(short, 8, 4)...)
+			au = append(au, testNAL(long, 5, h264FileReadSize / 3 + i)...)
+		} else {
+			au = testNAL([][]byte{short, long}[i % 2], 1, h264FileReadSize / 5 + i * 1000)
+		}
+		expected = append(expected, au)
+		stream = append(stream, au...)
+	}
+	if split := SplitH264AccessUnits(stream); len(split) != len(expected) || !bytes.Equal(split[0], expected[0]) {
+		t.Fatal("Unexpected split of whole stream:", len(split))
+	}
+
+	auCh := make(chan []byte)
+	errCh := make(chan error, 1)
+	go func() {
+		// reads of odd sizes split access units between chunks
+		errCh<- sendH264AccessUnits(context.Background(), iotest.HalfReader(bytes.NewReader(stream)), auCh)
+		close(auCh)
+	}()
+	i := 0
+	for au := range auCh {
+		if i >= len(expected) || !bytes.Equal(au, expected[i]) { t.Fatalf("Access unit %d differs (%d bytes)", i, len(au)) }
+		i++
+	}
+	if err := <-errCh; err != nil || i != len(expected) { t.Fatalf("%d access units expected, got %d (%v)", len(expected), i, err) }
+
+	// stopped reader doesn't block on unread channel
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := sendH264AccessUnits(ctx, bytes.NewReader(stream), make(chan []byte)); err == nil { t.Fatal("Cancelled reading succeeded") }
+}
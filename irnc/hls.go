@@ -0,0 +1,206 @@
+package irnc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// guarded by hlsMtx, HTTP handler runs concurrently with start and stop
+var hlsConfig HLSConfig
+var hlsCancel context.CancelFunc
+var hlsMtx sync.Mutex
+
+// Recording conversions outlive camera restarts (which stop HLS), they are cancelled on shutdown only
+var hlsConversionsCtx, hlsConversionsCancel = context.WithCancel(context.Background())
+var hlsConversionsWg sync.WaitGroup
+
+// Arguments for ffmpeg reading raw H264 (which has no timestamps) at given framerate
+func hlsInputArgs(input string, framerate uint) []string {
+	return []string{"-hide_banner", "-loglevel", "error", "-fflags", "+genpts", "-f", "h264", "-framerate", fmt.Sprintf("%d", framerate), "-i", input}
+}
+
+// Feed camera H264 stream to ffmpeg producing rolling live playlist, restart ffmpeg until context is done
+func runLiveHLS(ctx context.Context, cam Camera, camID string, config HLSConfig, framerate uint) {
+	playlist := filepath.Join(config.Dir, fmt.Sprintf("live_%s.m3u8", camID))
+	args := hlsInputArgs("pipe:0", framerate)
+	args = append(args,
+		"-c:v", "copy", "-f", "hls",
+		"-hls_time", fmt.Sprintf("%d", uint(config.SegmentDuration / time.Second)),
+		"-hls_list_size", fmt.Sprintf("%d", config.LiveSegments),
+		"-hls_flags", "delete_segments+omit_endlist",
+		"-hls_segment_filename", filepath.Join(config.Dir, fmt.Sprintf("live_%s_%%05d.ts", camID)),
+		playlist,
+	)
+	for ctx.Err() == nil {
+		streamCtx, streamCancel := context.WithCancel(ctx)
+		stream, err := cam.StreamH264(streamCtx)
+		if err == nil {
+			cmd := exec.CommandContext(streamCtx, "ffmpeg", args...)
+			var stdin io.WriteCloser
+			stdin, err = cmd.StdinPipe()
+			if err == nil { err = cmd.Start() }
+			if err == nil {
+				for data := range stream {
+					_, err = stdin.Write(data)
+					if err != nil { break }
+				}
+				stdin.Close()
+				err = cmd.Wait()
+			}
+		}
+		streamCancel()
+		if ctx.Err() != nil { return }
+		log.Printf("Live HLS for %s stopped: %v, restarting", camID, err)
+		time.Sleep(GeneralExternalsExecutionTimeout)
+	}
+}
+
+// Get HLS directory of application configuration, empty without configuration
+func configuredHLSDir() string {
+	config := getAppConfig()
+	if config == nil { return "" }
+	return config.HLS.Dir
+}
+
+// Get existing VOD playlists and segments of capture set in HLS directory
+func hlsFilesOf(dir, prefix string) (res []string) {
+	if dir == "" { return }
+	for _, pattern := range []string{"_n.m3u8", "_n_*.ts", "_ir.m3u8", "_ir_*.ts"} {
+		names, _ := filepath.Glob(filepath.Join(dir, prefix + pattern))
+		res = append(res, names...)
+	}
+	return
+}
+
+// Remove VOD playlist and segments produced from recorded file
+func removeHLSOutput(dir, filename string) {
+	base := filepath.Base(filename)
+	base = base[:len(base) - len(filepath.Ext(base))]
+	names, _ := filepath.Glob(filepath.Join(dir, base + "_*.ts"))
+	for _, name := range append(names, filepath.Join(dir, base + ".m3u8")) {
+		err := os.Remove(name)
+		if err != nil && !os.IsNotExist(err) { log.Println("HLS file removal error:", err) }
+	}
+}
+
+// Convert recorded H264 file to VOD playlist; streams not decodable by browsers (RGB IR video) are transcoded, partial output of failed conversion is removed
+func convertRecordingToHLS(ctx context.Context, filename string, transcode bool, config HLSConfig, framerate uint) error {
+	base := filepath.Base(filename)
+	base = base[:len(base) - len(filepath.Ext(base))]
+	args := hlsInputArgs(filename, framerate)
+	if transcode {
+		args = append(args, "-c:v", "libx264", "-preset", "veryfast", "-pix_fmt", "yuv420p")
+	} else {
+		args = append(args, "-c:v", "copy")
+	}
+	args = append(args,
+		"-f", "hls",
+		"-hls_time", fmt.Sprintf("%d", uint(config.SegmentDuration / time.Second)),
+		"-hls_playlist_type", "vod",
+		"-hls_segment_filename", filepath.Join(config.Dir, fmt.Sprintf("%s_%%03d.ts", base)),
+		filepath.Join(config.Dir, fmt.Sprintf("%s.m3u8", base)),
+	)
+	output, err := exec.CommandContext(ctx, "ffmpeg", args...).CombinedOutput()
+	if err != nil {
+		removeHLSOutput(config.Dir, filename)
+		return errors.New(fmt.Sprintf("ffmpeg failed: %v: %s", err, output))
+	}
+	return nil
+}
+
+// Produce VOD playlists for every finished recording session and assembled sequence, conversion in progress is finished after context is done
+func runRecordingsHLS(ctx context.Context, config HLSConfig, framerate uint) {
+	for event := range SubscribeEvents(ctx) {
+		if event.Type != EventRecordingStopped && !(event.Type == EventSequenceStopped && event.Prefix != "") { continue }
+		hlsConversionsWg.Add(1)
+		endUse := useCaptureSet(event.Dir, event.Prefix)
+		for _, fileTranscodePair := range []struct{suffix string; transcode bool}{{"_n.h264", false}, {"_ir.h264", true}} {
+			filename := filepath.Join(CaptureRoot(), event.Dir, event.Prefix + fileTranscodePair.suffix)
+			if _, err := os.Stat(filename); err != nil { continue }
+			err := convertRecordingToHLS(hlsConversionsCtx, filename, fileTranscodePair.transcode, config, framerate)
+			if err == nil {
+				log.Println("HLS playlist created for", filename)
+			} else {
+				log.Println("HLS conversion error for", filename, err)
+			}
+		}
+		endUse()
+		hlsConversionsWg.Done()
+	}
+}
+
+// Start HLS segmenting in background (if enabled)
+func startHLS(config HLSConfig, framerate uint) {
+	if !config.LiveEnabled && !config.RecordingsEnabled { return }
+	err := os.MkdirAll(config.Dir, 0755)
+	if err != nil {
+		log.Println("HLS directory creation error:", err)
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	hlsMtx.Lock()
+	hlsConfig, hlsCancel = config, cancel
+	hlsMtx.Unlock()
+	if config.LiveEnabled {
+		oldLiveFiles, _ := filepath.Glob(filepath.Join(config.Dir, "live_*"))
+		for _, oldLiveFile := range oldLiveFiles {
+			os.Remove(oldLiveFile)
+		}
+		nCam, irCam := Cameras()
+		go runLiveHLS(ctx, nCam, "n", config, framerate)
+		go runLiveHLS(ctx, irCam, "ir", config, framerate)
+	}
+	if config.RecordingsEnabled {
+		go runRecordingsHLS(ctx, config, framerate)
+	}
+}
+
+// Stop HLS segmenting, running recording conversion is finished (see stopHLSConversions)
+func stopHLS() {
+	hlsMtx.Lock()
+	defer hlsMtx.Unlock()
+	if hlsCancel == nil { return }
+	hlsCancel()
+	hlsCancel = nil
+}
+
+// Kill running recording conversions on shutdown and wait until their partial output is removed
+func stopHLSConversions() {
+	hlsConversionsCancel()
+	hlsConversionsWg.Wait()
+}
+
+// Get directory of HLS files, empty if HLS isn't running
+func hlsServedDir() string {
+	hlsMtx.Lock()
+	defer hlsMtx.Unlock()
+	if hlsCancel == nil { return "" }
+	return hlsConfig.Dir
+}
+
+// GET /hls/<file> serves playlists and segments from HLS directory
+func handleHLS(w http.ResponseWriter, r *http.Request) {
+	dir := hlsServedDir()
+	if dir == "" {
+		writeErrors(w, http.StatusNotFound, errors.New("HLS is disabled"))
+		return
+	}
+	switch filepath.Ext(r.URL.Path) {
+		case ".m3u8":
+			w.Header().Set("Content-Type", "application/vnd.apple.mpegurl")
+			// live playlist changes with every segment
+			w.Header().Set("Cache-Control", "no-cache")
+		case ".ts":
+			w.Header().Set("Content-Type", "video/mp2t")
+	}
+	http.StripPrefix("/hls/", http.FileServer(http.Dir(dir))).ServeHTTP(w, r)
+}
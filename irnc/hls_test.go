@@ -0,0 +1,137 @@
+package irnc
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Request HLS file through API handler
+func getHLS(path string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	NewAPIHandler("").ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+	return w
+}
+
+func TestHLSHandler(t *testing.T) {
+	if w := getHLS("/hls/live_n.m3u8"); w.Code != http.StatusNotFound { t.Fatal("Disabled HLS responds with", w.Code) }
+
+	root := t.TempDir()
+	dir := filepath.Join(root, "hls")
+	// only recordings playlists, so no live ffmpeg is started
+	startHLS(HLSConfig{RecordingsEnabled: true, Dir: dir, SegmentDuration: 2 * time.Second}, 30)
+	t.Cleanup(stopHLS)
+	writeTestCaptures(t, root, map[string]string{
+		"hls/2021.03.01_10.00.00_n.m3u8": "#EXTM3U\n",
+		"hls/2021.03.01_10.00.00_n_000.ts": "segment",
+		"secret.txt": "outside of HLS directory",
+	})
+
+	w := getHLS("/hls/2021.03.01_10.00.00_n.m3u8")
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "application/vnd.apple.mpegurl" || w.Header().Get("Cache-Control") != "no-cache" || w.Body.String() != "#EXTM3U\n" {
+		t.Fatalf("Unexpected playlist response %d %v %q", w.Code, w.Header(), w.Body)
+	}
+	w = getHLS("/hls/2021.03.01_10.00.00_n_000.ts")
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "video/mp2t" || w.Body.String() != "segment" {
+		t.Fatalf("Unexpected segment response %d %v %q", w.Code, w.Header(), w.Body)
+	}
+	if w = getHLS("/hls/missing.ts"); w.Code != http.StatusNotFound { t.Fatal("Missing segment responds with", w.Code) }
+	if w = getHLS("/hls/../secret.txt"); w.Code == http.StatusOK { t.Fatal("File outside of HLS directory is served") }
+	if w = getHLS("/hls/%2e%2e/secret.txt"); w.Code == http.StatusOK { t.Fatal("File outside of HLS directory is served") }
+	if _, err := os.Stat(dir); err != nil { t.Fatal("HLS directory isn't created:", err) }
+
+	stopHLS()
+	if w = getHLS("/hls/2021.03.01_10.00.00_n.m3u8"); w.Code != http.StatusNotFound { t.Fatal("Stopped HLS responds with", w.Code) }
+}
+
+func TestHLSHandlerDuringRestart(t *testing.T) {
+	dir := t.TempDir()
+	config := HLSConfig{RecordingsEnabled: true, Dir: dir, SegmentDuration: 2 * time.Second}
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 50; i++ {
+			startHLS(config, 30)
+			stopHLS()
+		}
+	}()
+	// served while configuration is replaced, race detector catches unguarded access
+	for i := 0; i < 50; i++ {
+		if w := getHLS("/hls/live_n.m3u8"); w.Code != http.StatusNotFound { t.Fatal("Missing playlist responds with", w.Code) }
+	}
+	wg.Wait()
+}
+
+// Put fake ffmpeg writing playlist (its last argument) after delay first in PATH until test ends
+func installFakeFFmpeg(t *testing.T, delay string) {
+	binDir := t.TempDir()
+	script := "#!/bin/sh\nsleep " + delay + "\nfor last; do :; done\necho '#EXTM3U' > \"$last\"\n"
+	err := ioutil.WriteFile(filepath.Join(binDir, "ffmpeg"), []byte(script), 0755)
+	if err != nil { t.Fatal(err) }
+	prevPath := os.Getenv("PATH")
+	os.Setenv("PATH", binDir + string(os.PathListSeparator) + prevPath)
+	t.Cleanup(func() { os.Setenv("PATH", prevPath) })
+}
+
+func TestRecordingConversionOutlivesHLSStop(t *testing.T) {
+	config := setupSequenceTest(t)
+	installFakeFFmpeg(t, "0.3")
+	config.HLS = HLSConfig{RecordingsEnabled: true, Dir: filepath.Join(config.Storage.Root, "hls"), SegmentDuration: 2 * time.Second}
+	writeTestCaptures(t, config.Storage.Root, map[string]string{"2021.03.01/2021.03.01_10.00.00_n.h264": "n video"})
+	startHLS(config.HLS, 30)
+	t.Cleanup(stopHLS)
+	// subscription of recordings conversion is set up in background
+	time.Sleep(100 * time.Millisecond)
+	PublishEvent(Event{Type: EventRecordingStopped, Prefix: "2021.03.01_10.00.00", Dir: "2021.03.01"})
+	time.Sleep(100 * time.Millisecond)
+	// camera restart stops HLS while ffmpeg runs
+	stopHLS()
+	playlist := filepath.Join(config.HLS.Dir, "2021.03.01_10.00.00_n.m3u8")
+	for deadline := time.Now().Add(2 * time.Second); time.Now().Before(deadline); time.Sleep(20 * time.Millisecond) {
+		if _, err := os.Stat(playlist); err == nil { return }
+	}
+	t.Fatal("Conversion is killed by HLS stop")
+}
+
+func TestFailedConversionOutputRemoved(t *testing.T) {
+	dir := t.TempDir()
+	writeTestCaptures(t, dir, map[string]string{
+		"2021.03.01_10.00.00_n.m3u8": "#EXTM3U\n",
+		"2021.03.01_10.00.00_n_000.ts": "segment",
+		"2021.03.01_10.00.00_ir_000.ts": "other camera",
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err := convertRecordingToHLS(ctx, "2021.03.01/2021.03.01_10.00.00_n.h264", false, HLSConfig{Dir: dir, SegmentDuration: 2 * time.Second}, 30)
+	if err == nil { t.Fatal("Cancelled conversion succeeded") }
+	if left := hlsFilesOf(dir, "2021.03.01_10.00.00"); len(left) != 1 || filepath.Base(left[0]) != "2021.03.01_10.00.00_ir_000.ts" {
+		t.Fatal("Truncated playlist isn't removed, left:", left)
+	}
+}
+
+func TestCaptureSetHLSFiles(t *testing.T) {
+	config := setupSequenceTest(t)
+	config.HLS.Dir = t.TempDir()
+	writeTestCaptures(t, config.Storage.Root, map[string]string{"2021.03.01/2021.03.01_10.00.00_n.h264": "n video"})
+	writeTestCaptures(t, config.HLS.Dir, map[string]string{
+		"2021.03.01_10.00.00_n.m3u8": "#EXTM3U\n",
+		"2021.03.01_10.00.00_n_000.ts": "segment",
+		"2021.03.01_10.00.00_1_n.m3u8": "#EXTM3U\n",
+	})
+	// VOD output counts to size of its set
+	sets, err := statCaptureSets(config.Storage.Root)
+	if err != nil || len(sets) != 1 || sets[0].sizeBytes != int64(len("n video") + len("#EXTM3U\n") + len("segment")) {
+		t.Fatalf("Unexpected sets %+v (%v)", sets, err)
+	}
+	err = DeleteCaptureSet(config.Storage.Root, sets[0].set)
+	if err != nil { t.Fatal(err) }
+	left, _ := filepath.Glob(filepath.Join(config.HLS.Dir, "*"))
+	if len(left) != 1 || filepath.Base(left[0]) != "2021.03.01_10.00.00_1_n.m3u8" { t.Fatal("VOD output isn't deleted with its set, left:", left) }
+}
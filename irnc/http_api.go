@@ -0,0 +1,296 @@
+package irnc
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var apiServer *http.Server
+
+type apiError struct {
+	Errors []string `json:"errors"`
+}
+
+// Write value as JSON response
+func writeJSON(w http.ResponseWriter, status int, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	err := json.NewEncoder(w).Encode(value)
+	if err != nil { log.Println("API response writing error:", err) }
+}
+
+// Write errors as JSON response
+func writeErrors(w http.ResponseWriter, status int, errs ...error) {
+	writeJSON(w, status, apiError{Errors: errorStrings(errs)})
+}
+
+// Restrict handler to listed HTTP methods
+func allowMethods(handler http.HandlerFunc, methods ...string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		for _, method := range methods {
+			if r.Method == method {
+				handler(w, r)
+				return
+			}
+		}
+		w.Header().Set("Allow", strings.Join(methods, ", "))
+		writeErrors(w, http.StatusMethodNotAllowed, errors.New(fmt.Sprintf("Method %s is not allowed", r.Method)))
+	}
+}
+
+// Require bearer token (header or "token" query parameter for plain downloads) if configured
+func requireToken(token string, handler http.Handler) http.Handler {
+	if token == "" { return handler }
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		provided := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if provided == "" {
+			provided = r.URL.Query().Get("token")
+		}
+		if subtle.ConstantTimeCompare([]byte(provided), []byte(token)) != 1 {
+			writeErrors(w, http.StatusUnauthorized, errors.New("Invalid token"))
+			return
+		}
+		handler.ServeHTTP(w, r)
+	})
+}
+
+// POST /snapshot
+func handleSnapshot(w http.ResponseWriter, r *http.Request) {
+	prefix, errs := TakeSnapshot()
+	if len(errs) > 0 {
+		writeErrors(w, http.StatusInternalServerError, errs...)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"prefix": prefix})
+}
+
+// POST /recording/start, optional "duration" query parameter in seconds
+func handleRecordingStart(w http.ResponseWriter, r *http.Request) {
+	videoDuration := GetLiveConfig().VideoDuration()
+	if durationParam := r.URL.Query().Get("duration"); durationParam != "" {
+		seconds, err := strconv.ParseUint(durationParam, 10, 32)
+		if err != nil || seconds == 0 {
+			writeErrors(w, http.StatusBadRequest, errors.New(fmt.Sprintf("Invalid duration %q", durationParam)))
+			return
+		}
+		videoDuration = time.Duration(seconds) * time.Second
+	}
+	_, err := StartRecording(videoDuration)
+	if err != nil {
+		writeErrors(w, http.StatusConflict, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, GetRecordingStatus())
+}
+
+// POST /recording/stop
+func handleRecordingStop(w http.ResponseWriter, r *http.Request) {
+	err := StopRecording()
+	if err != nil {
+		writeErrors(w, http.StatusConflict, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, GetRecordingStatus())
+}
+
+// Build sequence request from parameters: mode, interval, duration, count, video, start
+func parseSequenceRequest(values url.Values) (req SequenceRequest, errs []error) {
+	var err error
+	req.Mode = SequenceMode(values.Get("mode"))
+	if value := values.Get("interval"); value != "" {
+		req.IntervalSec, err = strconv.ParseFloat(value, 64)
+		if err != nil { errs = append(errs, errors.New(fmt.Sprintf("Invalid interval %q", value))) }
+	}
+	for name, dst := range map[string]*uint{"duration": &req.DurationSec, "count": &req.Count} {
+		if value := values.Get(name); value != "" {
+			parsed, err := strconv.ParseUint(value, 10, 32)
+			if err != nil { errs = append(errs, errors.New(fmt.Sprintf("Invalid %s %q", name, value))) }
+			*dst = uint(parsed)
+		}
+	}
+	req.Video = values.Get("video") == "true"
+	if value := values.Get("start"); value != "" {
+		req.StartAt, err = parseQueryTime(value)
+		if err != nil { errs = append(errs, err) }
+	}
+	errs = append(errs, req.Verify()...)
+	return
+}
+
+// POST /sequence/start (see parseSequenceRequest)
+func handleSequenceStart(w http.ResponseWriter, r *http.Request) {
+	req, errs := parseSequenceRequest(r.URL.Query())
+	if len(errs) > 0 {
+		writeErrors(w, http.StatusBadRequest, errs...)
+		return
+	}
+	_, err := StartSequence(req)
+	if err != nil {
+		writeErrors(w, http.StatusConflict, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, GetSequenceStatus())
+}
+
+// POST /sequence/stop
+func handleSequenceStop(w http.ResponseWriter, r *http.Request) {
+	err := StopSequence()
+	if err != nil {
+		writeErrors(w, http.StatusConflict, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, GetSequenceStatus())
+}
+
+// GET /status
+func handleStatus(w http.ResponseWriter, r *http.Request) {
+	nCam, irCam := Cameras()
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"cameras": map[string]CameraStatus{nCam.Name(): GetCameraStatus(nCam), irCam.Name(): GetCameraStatus(irCam)},
+		"recording": GetRecordingStatus(),
+		"sequence": GetSequenceStatus(),
+		"gps": GetGPSStatus(),
+	})
+}
+
+// GET/PUT /config
+func handleConfig(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodPut {
+		lc := GetLiveConfig()
+		err := json.NewDecoder(r.Body).Decode(&lc)
+		if err != nil {
+			writeErrors(w, http.StatusBadRequest, err)
+			return
+		}
+		errs := SetLiveConfig(lc)
+		if len(errs) > 0 {
+			writeErrors(w, http.StatusBadRequest, errs...)
+			return
+		}
+	}
+	writeJSON(w, http.StatusOK, GetLiveConfig())
+}
+
+// Parse time as RFC 3339, capture timestamp or date (local time for the latter)
+func parseQueryTime(value string) (time.Time, error) {
+	for _, layout := range []string{time.RFC3339, timestampFormat, dayFolderFormat} {
+		if t, err := time.ParseInLocation(layout, value, time.Local); err == nil { return t, nil }
+	}
+	return time.Time{}, errors.New(fmt.Sprintf("Invalid time %q", value))
+}
+
+// Build catalog query from parameters: from, to, tag (repeatable), text, starred, kind, offset, limit
+func parseCatalogQuery(values url.Values) (q CatalogQuery, errs []error) {
+	var err error
+	if value := values.Get("from"); value != "" {
+		q.From, err = parseQueryTime(value)
+		if err != nil { errs = append(errs, err) }
+	}
+	if value := values.Get("to"); value != "" {
+		q.To, err = parseQueryTime(value)
+		if err != nil { errs = append(errs, err) }
+	}
+	q.Tags = values["tag"]
+	q.Text = values.Get("text")
+	q.StarredOnly = values.Get("starred") == "true"
+	q.Kind = values.Get("kind")
+	for name, dst := range map[string]*int{"offset": &q.Offset, "limit": &q.Limit} {
+		if value := values.Get(name); value != "" {
+			*dst, err = strconv.Atoi(value)
+			if err != nil { errs = append(errs, errors.New(fmt.Sprintf("Invalid %s %q", name, value))) }
+		}
+	}
+	errs = append(errs, q.Verify()...)
+	return
+}
+
+// GET /captures searches capture sets (see parseCatalogQuery), GET /captures/[<dir>/]<file> downloads file
+func handleCaptures(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimPrefix(r.URL.Path, "/captures")
+	path = strings.TrimPrefix(path, "/")
+	if path == "" {
+		q, errs := parseCatalogQuery(r.URL.Query())
+		if len(errs) > 0 {
+			writeErrors(w, http.StatusBadRequest, errs...)
+			return
+		}
+		entries, err := QueryCaptures(q)
+		if err != nil {
+			writeErrors(w, http.StatusInternalServerError, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, entries)
+		return
+	}
+	dir, name := "", path
+	if i := strings.Index(path, "/"); i >= 0 {
+		dir, name = path[:i], path[i + 1:]
+	}
+	validDir := dir == "" || (dir == filepath.Base(dir) && dir != "." && dir != "..")
+	if !validDir || name != filepath.Base(name) || !IsCaptureFileName(name) {
+		writeErrors(w, http.StatusNotFound, errors.New(fmt.Sprintf("Unknown capture file %q", path)))
+		return
+	}
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name))
+	http.ServeFile(w, r, filepath.Join(CaptureRoot(), dir, name))
+}
+
+// POST /catalog/rebuild
+func handleCatalogRebuild(w http.ResponseWriter, r *http.Request) {
+	count, err := RebuildCatalog()
+	if err != nil {
+		writeErrors(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]int{"capture_sets": count})
+}
+
+// Create handler for remote control API
+func NewAPIHandler(token string) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/snapshot", allowMethods(handleSnapshot, http.MethodPost))
+	mux.HandleFunc("/recording/start", allowMethods(handleRecordingStart, http.MethodPost))
+	mux.HandleFunc("/recording/stop", allowMethods(handleRecordingStop, http.MethodPost))
+	mux.HandleFunc("/sequence/start", allowMethods(handleSequenceStart, http.MethodPost))
+	mux.HandleFunc("/sequence/stop", allowMethods(handleSequenceStop, http.MethodPost))
+	mux.HandleFunc("/status", allowMethods(handleStatus, http.MethodGet))
+	mux.HandleFunc("/config", allowMethods(handleConfig, http.MethodGet, http.MethodPut))
+	mux.HandleFunc("/captures", allowMethods(handleCaptures, http.MethodGet))
+	mux.HandleFunc("/captures/", allowMethods(handleCaptures, http.MethodGet))
+	mux.HandleFunc("/catalog/rebuild", allowMethods(handleCatalogRebuild, http.MethodPost))
+	mux.HandleFunc("/hls/", allowMethods(handleHLS, http.MethodGet))
+	mux.HandleFunc("/webrtc/", allowMethods(handleWebRTCViewer, http.MethodGet))
+	mux.HandleFunc("/webrtc/offer", allowMethods(handleWebRTCOffer, http.MethodPost))
+	return requireToken(token, mux)
+}
+
+// Start remote control API server in background (if enabled)
+func startAPIServer(config APIConfig) {
+	if config.Address == "" { return }
+	apiServer = &http.Server{Addr: config.Address, Handler: NewAPIHandler(config.Token)}
+	go func(server *http.Server) {
+		log.Println("API listening on", server.Addr)
+		err := server.ListenAndServe()
+		if err != nil && err != http.ErrServerClosed { log.Println("API server error:", err) }
+	}(apiServer)
+}
+
+// Stop remote control API server
+func stopAPIServer() {
+	if apiServer == nil { return }
+	ctx, cancel := context.WithTimeout(context.Background(), GeneralExternalsExecutionTimeout)
+	defer cancel()
+	err := apiServer.Shutdown(ctx)
+	if err != nil { log.Println("API server shutdown error:", err) }
+	apiServer = nil
+}
@@ -0,0 +1,94 @@
+package irnc
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// Send GET request through API handler, with optional Authorization header
+func getAPI(handler http.Handler, path, authorization string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodGet, path, nil)
+	if authorization != "" { r.Header.Set("Authorization", authorization) }
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	return w
+}
+
+func TestRequireToken(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusNoContent) })
+	tests := []struct {
+		name string
+		path string
+		authorization string
+		expected int
+	}{
+		{"missing", "/status", "", http.StatusUnauthorized},
+		{"wrong header", "/status", "Bearer wrong", http.StatusUnauthorized},
+		{"header without scheme", "/status", "secret", http.StatusNoContent},
+		{"header", "/status", "Bearer secret", http.StatusNoContent},
+		{"wrong query", "/status?token=wrong", "", http.StatusUnauthorized},
+		{"query", "/status?token=secret", "", http.StatusNoContent},
+		{"prefix of token", "/status?token=secre", "", http.StatusUnauthorized},
+		// header takes precedence over query parameter
+		{"wrong header with query", "/status?token=secret", "Bearer wrong", http.StatusUnauthorized},
+		{"header with wrong query", "/status?token=wrong", "Bearer secret", http.StatusNoContent},
+	}
+	handler := requireToken("secret", ok)
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			w := getAPI(handler, test.path, test.authorization)
+			if w.Code != test.expected { t.Fatalf("Status %d expected, got %d", test.expected, w.Code) }
+			if w.Code == http.StatusUnauthorized {
+				var res apiError
+				if err := json.NewDecoder(w.Body).Decode(&res); err != nil || len(res.Errors) != 1 { t.Fatal("Error response expected, got", res, err) }
+			}
+		})
+	}
+	if w := getAPI(requireToken("", ok), "/status", ""); w.Code != http.StatusNoContent { t.Fatal("Disabled token is required, status", w.Code) }
+}
+
+func TestCapturesDownload(t *testing.T) {
+	config := setupSequenceTest(t)
+	writeTestCaptures(t, config.Storage.Root, map[string]string{
+		"2021.03.01/2021.03.01_10.00.00_n.png": "n photo",
+		"2021.03.01/nested/2021.03.01_11.00.00_n.png": "nested photo",
+		"2021.03.02_10.00.00_ir.png": "legacy photo",
+		"2021.03.01/notes.txt": "not a capture",
+	})
+	// handler is called directly, ServeMux would redirect dot segments before validation
+	handler := http.HandlerFunc(handleCaptures)
+	tests := []struct {
+		path string
+		expected int
+		body string
+	}{
+		{"/captures/2021.03.01/2021.03.01_10.00.00_n.png", http.StatusOK, "n photo"},
+		{"/captures/2021.03.02_10.00.00_ir.png", http.StatusOK, "legacy photo"},
+		{"/captures/2021.03.01/2021.03.01_12.00.00_n.png", http.StatusNotFound, ""},
+		{"/captures/2021.03.01/notes.txt", http.StatusNotFound, ""},
+		{"/captures/2021.03.01/nested/2021.03.01_11.00.00_n.png", http.StatusNotFound, ""},
+		{"/captures/../2021.03.01_10.00.00_n.png", http.StatusNotFound, ""},
+		{"/captures/%2e%2e/2021.03.01_10.00.00_n.png", http.StatusNotFound, ""},
+		{"/captures/./2021.03.02_10.00.00_ir.png", http.StatusNotFound, ""},
+		{"/captures/2021.03.01/..%2f2021.03.02_10.00.00_ir.png", http.StatusNotFound, ""},
+		{"/captures/2021.03.01%2f..%2f2021.03.02_10.00.00_ir.png", http.StatusNotFound, ""},
+	}
+	for _, test := range tests {
+		t.Run(test.path, func(t *testing.T) {
+			w := getAPI(handler, test.path, "")
+			if w.Code != test.expected { t.Fatalf("Status %d expected, got %d", test.expected, w.Code) }
+			if test.body != "" && w.Body.String() != test.body { t.Fatalf("Body %q expected, got %q", test.body, w.Body) }
+		})
+	}
+
+	for _, path := range []string{"/captures/../2021.03.02_10.00.00_ir.png", "/captures/2021.03.01/../2021.03.02_10.00.00_ir.png"} {
+		if w := getAPI(NewAPIHandler(""), path, ""); w.Code == http.StatusOK { t.Fatal("File is served for", path) }
+	}
+	w := getAPI(handler, "/captures", "")
+	var entries []CatalogEntry
+	if err := json.NewDecoder(w.Body).Decode(&entries); w.Code != http.StatusOK || err != nil || len(entries) != 2 {
+		t.Fatal("Capture sets search failed:", w.Code, entries, err)
+	}
+}
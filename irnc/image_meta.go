@@ -0,0 +1,411 @@
+package irnc
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+// PNG signature followed by IHDR chunk, metadata chunks go right after them
+const pngHeaderSize = 8 + 4 + 4 + 13 + 4
+// iTXt keyword of XMP packet (recognized by exiftool, GIMP, darktable, etc)
+const pngXMPKeyword = "XML:com.adobe.xmp"
+// identifiers of APP1 segments in JPEG
+const jpegEXIFHeader = "Exif\x00\x00"
+const jpegXMPHeader = "http://ns.adobe.com/xap/1.0/\x00"
+// JPEG segment length is 16-bit and includes itself
+const maxJPEGSegmentPayload = 65535 - 2
+// namespace of own fields (thermal rendering, mounting) which aren't covered by EXIF schema
+const irncXMPNamespace = "http://ns.irnc/1.0/"
+const imageSoftware = "IRNC"
+const exifTimeFormat = "2006:01:02 15:04:05"
+
+// Data about capture embedded into saved images
+type ImageMetadata struct {
+	Time time.Time
+	// nil if there was no recent fix
+	Position *GPSPosition
+	// camera manufacturer and model
+	Make, Model string
+	// mounting rotation of camera; frames are rotated by device already (seek_viewer, bcm2835 rotate control), so orientation of saved image is always normal
+	RotationDegree int
+	// nil for non-thermal cameras
+	Thermal *ThermalImageInfo
+}
+
+// Rendering of thermal image (seek_viewer delivers colormapped frames, so temperatures are unknown)
+type ThermalImageInfo struct {
+	PaletteNumber uint
+	Palette string
+}
+
+// TIFF field types used by EXIF
+const (
+	tiffByte = 1
+	tiffASCII = 2
+	tiffShort = 3
+	tiffLong = 4
+	tiffRational = 5
+	tiffUndefined = 7
+)
+
+// EXIF/TIFF tags
+const (
+	tagGPSVersionID = 0x0000
+	tagGPSLatitudeRef = 0x0001
+	tagGPSLatitude = 0x0002
+	tagGPSLongitudeRef = 0x0003
+	tagGPSLongitude = 0x0004
+	tagGPSAltitudeRef = 0x0005
+	tagGPSAltitude = 0x0006
+	tagGPSTimeStamp = 0x0007
+	tagGPSSatellites = 0x0008
+	tagGPSDOP = 0x000B
+	tagGPSMapDatum = 0x0012
+	tagGPSDateStamp = 0x001D
+	tagImageWidth = 0x0100
+	tagImageLength = 0x0101
+	tagBitsPerSample = 0x0102
+	tagCompression = 0x0103
+	tagPhotometricInterpretation = 0x0106
+	tagMake = 0x010F
+	tagModel = 0x0110
+	tagStripOffsets = 0x0111
+	tagOrientation = 0x0112
+	tagSamplesPerPixel = 0x0115
+	tagRowsPerStrip = 0x0116
+	tagStripByteCounts = 0x0117
+	tagXResolution = 0x011A
+	tagYResolution = 0x011B
+	tagPlanarConfiguration = 0x011C
+	tagResolutionUnit = 0x0128
+	tagSoftware = 0x0131
+	tagDateTime = 0x0132
+	tagXMLPacket = 0x02BC
+	tagExifIFDPointer = 0x8769
+	tagGPSIFDPointer = 0x8825
+	tagExifVersion = 0x9000
+	tagDateTimeOriginal = 0x9003
+	tagOffsetTimeOriginal = 0x9011
+)
+
+// Entry of TIFF image file directory, value is encoded big-endian
+type tiffField struct {
+	tag, fieldType uint16
+	count uint32
+	value []byte
+}
+
+// NUL-terminated ASCII field
+func asciiField(tag uint16, value string) tiffField {
+	return tiffField{tag, tiffASCII, uint32(len(value) + 1), append([]byte(value), 0)}
+}
+
+func byteField(tag uint16, values ...byte) tiffField {
+	return tiffField{tag, tiffByte, uint32(len(values)), values}
+}
+
+func shortField(tag uint16, values ...uint16) tiffField {
+	buf := make([]byte, 2 * len(values))
+	for i, value := range values {
+		binary.BigEndian.PutUint16(buf[2 * i:], value)
+	}
+	return tiffField{tag, tiffShort, uint32(len(values)), buf}
+}
+
+func longField(tag uint16, value uint32) tiffField {
+	buf := make([]byte, 4)
+	binary.BigEndian.PutUint32(buf, value)
+	return tiffField{tag, tiffLong, 1, buf}
+}
+
+// Field of numerator/denominator pairs
+func rationalField(tag uint16, values ...[2]uint32) tiffField {
+	buf := make([]byte, 8 * len(values))
+	for i, value := range values {
+		binary.BigEndian.PutUint32(buf[8 * i:], value[0])
+		binary.BigEndian.PutUint32(buf[8 * i + 4:], value[1])
+	}
+	return tiffField{tag, tiffRational, uint32(len(values)), buf}
+}
+
+// Size of IFD including values which don't fit into entries
+func ifdSize(fields []tiffField) int {
+	size := 2 + 12 * len(fields) + 4
+	for _, field := range fields {
+		if len(field.value) > 4 { size += len(field.value) + len(field.value) % 2 }
+	}
+	return size
+}
+
+// Append IFD located at offset (relative to TIFF header) followed by its values, there is no next IFD
+func writeIFD(buf *bytes.Buffer, offset int, fields []tiffField) {
+	sort.Slice(fields, func(i, j int) bool { return fields[i].tag < fields[j].tag })
+	var values bytes.Buffer
+	valuesOffset := offset + 2 + 12 * len(fields) + 4
+	binary.Write(buf, binary.BigEndian, uint16(len(fields)))
+	for _, field := range fields {
+		binary.Write(buf, binary.BigEndian, field.tag)
+		binary.Write(buf, binary.BigEndian, field.fieldType)
+		binary.Write(buf, binary.BigEndian, field.count)
+		if len(field.value) <= 4 {
+			inline := make([]byte, 4)
+			copy(inline, field.value)
+			buf.Write(inline)
+			continue
+		}
+		binary.Write(buf, binary.BigEndian, uint32(valuesOffset + values.Len()))
+		values.Write(field.value)
+		if len(field.value) % 2 == 1 { values.WriteByte(0) }
+	}
+	binary.Write(buf, binary.BigEndian, uint32(0))
+	buf.Write(values.Bytes())
+}
+
+// Degrees, minutes and seconds (in thousandths) of absolute coordinate value
+func exifCoordinate(value float64) [][2]uint32 {
+	value = math.Abs(value)
+	degrees := math.Floor(value)
+	minutes := math.Floor((value - degrees) * 60)
+	seconds := ((value - degrees) * 60 - minutes) * 60
+	return [][2]uint32{{uint32(degrees), 1}, {uint32(minutes), 1}, {uint32(math.Round(seconds * 1000)), 1000}}
+}
+
+// GPS IFD fields of position
+func gpsFields(p *GPSPosition) []tiffField {
+	latitudeRef, longitudeRef := "N", "E"
+	if p.Latitude < 0 { latitudeRef = "S" }
+	if p.Longitude < 0 { longitudeRef = "W" }
+	fixTime := p.Time.UTC()
+	fields := []tiffField{
+		byteField(tagGPSVersionID, 2, 3, 0, 0),
+		asciiField(tagGPSLatitudeRef, latitudeRef),
+		rationalField(tagGPSLatitude, exifCoordinate(p.Latitude)...),
+		asciiField(tagGPSLongitudeRef, longitudeRef),
+		rationalField(tagGPSLongitude, exifCoordinate(p.Longitude)...),
+		asciiField(tagGPSMapDatum, "WGS-84"),
+	}
+	if !p.Time.IsZero() {
+		fields = append(fields,
+			rationalField(tagGPSTimeStamp, [2]uint32{uint32(fixTime.Hour()), 1}, [2]uint32{uint32(fixTime.Minute()), 1},
+				[2]uint32{uint32(fixTime.Second() * 1000 + fixTime.Nanosecond() / int(time.Millisecond)), 1000}),
+			asciiField(tagGPSDateStamp, fixTime.Format("2006:01:02")),
+		)
+	}
+	if p.AltitudeM != 0 {
+		var altitudeRef byte
+		if p.AltitudeM < 0 { altitudeRef = 1 }
+		fields = append(fields,
+			byteField(tagGPSAltitudeRef, altitudeRef),
+			rationalField(tagGPSAltitude, [2]uint32{uint32(math.Round(math.Abs(p.AltitudeM) * 10)), 10}),
+		)
+	}
+	if p.Satellites > 0 { fields = append(fields, asciiField(tagGPSSatellites, fmt.Sprintf("%d", p.Satellites))) }
+	if p.HDOP > 0 { fields = append(fields, rationalField(tagGPSDOP, [2]uint32{uint32(math.Round(p.HDOP * 100)), 100})) }
+	return fields
+}
+
+// Build big-endian TIFF structure: IFD0 with image fields, camera, time and orientation, EXIF and GPS IFDs, then pixel data (pointed to by StripOffsets field of image fields)
+func buildTIFF(meta ImageMetadata, imageFields []tiffField, pixels []byte) []byte {
+	ifd0 := append([]tiffField{
+		shortField(tagOrientation, 1),
+		asciiField(tagSoftware, imageSoftware),
+		longField(tagExifIFDPointer, 0),
+	}, imageFields...)
+	if meta.Make != "" { ifd0 = append(ifd0, asciiField(tagMake, meta.Make)) }
+	if meta.Model != "" { ifd0 = append(ifd0, asciiField(tagModel, meta.Model)) }
+	exifIFD := []tiffField{{tagExifVersion, tiffUndefined, 4, []byte("0232")}}
+	if !meta.Time.IsZero() {
+		ifd0 = append(ifd0, asciiField(tagDateTime, meta.Time.Format(exifTimeFormat)))
+		exifIFD = append(exifIFD,
+			asciiField(tagDateTimeOriginal, meta.Time.Format(exifTimeFormat)),
+			asciiField(tagOffsetTimeOriginal, meta.Time.Format("-07:00")),
+		)
+	}
+	var gpsIFD []tiffField
+	if meta.Position != nil {
+		gpsIFD = gpsFields(meta.Position)
+		ifd0 = append(ifd0, longField(tagGPSIFDPointer, 0))
+	}
+	// pointers are inline, so their values don't affect layout
+	exifOffset := 8 + ifdSize(ifd0)
+	gpsOffset := exifOffset + ifdSize(exifIFD)
+	pixelsOffset := gpsOffset
+	if gpsIFD != nil { pixelsOffset += ifdSize(gpsIFD) }
+	for i, field := range ifd0 {
+		switch field.tag {
+			case tagExifIFDPointer:
+				ifd0[i] = longField(tagExifIFDPointer, uint32(exifOffset))
+			case tagGPSIFDPointer:
+				ifd0[i] = longField(tagGPSIFDPointer, uint32(gpsOffset))
+			case tagStripOffsets:
+				ifd0[i] = longField(tagStripOffsets, uint32(pixelsOffset))
+		}
+	}
+	var buf bytes.Buffer
+	buf.WriteString("MM\x00\x2a")
+	binary.Write(&buf, binary.BigEndian, uint32(8))
+	writeIFD(&buf, 8, ifd0)
+	writeIFD(&buf, exifOffset, exifIFD)
+	if gpsIFD != nil { writeIFD(&buf, gpsOffset, gpsIFD) }
+	buf.Write(pixels)
+	return buf.Bytes()
+}
+
+// Build TIFF structure of EXIF (camera, time, orientation and GPS position) without image
+func buildEXIF(meta ImageMetadata) []byte {
+	return buildTIFF(meta, nil, nil)
+}
+
+// Format coordinate for XMP as "DDD,MM.mmmmmmR" with reference letter
+func xmpCoordinate(value float64, positive, negative string) string {
+	ref := positive
+	if value < 0 {
+		ref = negative
+		value = -value
+	}
+	degrees := math.Floor(value)
+	return fmt.Sprintf("%d,%.6f%s", int(degrees), (value - degrees) * 60, ref)
+}
+
+// XMP property with escaped value
+func xmpProperty(name, value string) string {
+	var escaped bytes.Buffer
+	xml.EscapeText(&escaped, []byte(value))
+	return fmt.Sprintf(`%s="%s"`, name, strings.ReplaceAll(escaped.String(), `"`, "&#34;"))
+}
+
+// Build XMP packet with capture time, camera, GPS position (EXIF schema), mounting and thermal rendering (own schema)
+func buildXMP(meta ImageMetadata) string {
+	props := []string{xmpProperty("xmp:CreatorTool", imageSoftware), `tiff:Orientation="1"`}
+	if !meta.Time.IsZero() {
+		props = append(props, xmpProperty("xmp:CreateDate", meta.Time.Format(time.RFC3339)))
+	}
+	if meta.Make != "" { props = append(props, xmpProperty("tiff:Make", meta.Make)) }
+	if meta.Model != "" { props = append(props, xmpProperty("tiff:Model", meta.Model)) }
+	if p := meta.Position; p != nil {
+		props = append(props,
+			fmt.Sprintf(`exif:GPSLatitude="%s"`, xmpCoordinate(p.Latitude, "N", "S")),
+			fmt.Sprintf(`exif:GPSLongitude="%s"`, xmpCoordinate(p.Longitude, "E", "W")),
+			`exif:GPSMapDatum="WGS-84"`,
+		)
+		if !p.Time.IsZero() {
+			props = append(props, fmt.Sprintf(`exif:GPSTimeStamp="%s"`, p.Time.UTC().Format(time.RFC3339)))
+		}
+		if p.AltitudeM != 0 {
+			altitudeRef := 0
+			if p.AltitudeM < 0 { altitudeRef = 1 }
+			props = append(props,
+				fmt.Sprintf(`exif:GPSAltitude="%d/10"`, int64(math.Round(math.Abs(p.AltitudeM) * 10))),
+				fmt.Sprintf(`exif:GPSAltitudeRef="%d"`, altitudeRef),
+			)
+		}
+		if p.Satellites > 0 { props = append(props, fmt.Sprintf(`exif:GPSSatellites="%d"`, p.Satellites)) }
+		if p.HDOP > 0 { props = append(props, fmt.Sprintf(`exif:GPSDOP="%d/100"`, int64(math.Round(p.HDOP * 100)))) }
+	}
+	if meta.RotationDegree != 0 {
+		props = append(props, fmt.Sprintf(`irnc:MountRotation="%d"`, meta.RotationDegree))
+	}
+	if t := meta.Thermal; t != nil {
+		props = append(props, fmt.Sprintf(`irnc:PaletteNumber="%d"`, t.PaletteNumber), xmpProperty("irnc:Palette", t.Palette))
+	}
+	return `<?xpacket begin="` + "\ufeff" + `" id="W5M0MpCehiHzreSzNTczkc9d"?>` +
+		`<x:xmpmeta xmlns:x="adobe:ns:meta/"><rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#">` +
+		`<rdf:Description rdf:about="" xmlns:xmp="http://ns.adobe.com/xap/1.0/" xmlns:tiff="http://ns.adobe.com/tiff/1.0/" ` +
+		`xmlns:exif="http://ns.adobe.com/exif/1.0/" xmlns:irnc="` + irncXMPNamespace + `" ` +
+		strings.Join(props, " ") + `/></rdf:RDF></x:xmpmeta><?xpacket end="w"?>`
+}
+
+// Write PNG chunk with length and CRC
+func writePNGChunk(w io.Writer, chunkType string, data []byte) error {
+	header := make([]byte, 8)
+	binary.BigEndian.PutUint32(header, uint32(len(data)))
+	copy(header[4:], chunkType)
+	crc := crc32.NewIEEE()
+	crc.Write(header[4:])
+	crc.Write(data)
+	trailer := make([]byte, 4)
+	binary.BigEndian.PutUint32(trailer, crc.Sum32())
+	for _, part := range [][]byte{header, data, trailer} {
+		_, err := w.Write(part)
+		if err != nil { return err }
+	}
+	return nil
+}
+
+// Standard PNG text chunks (Latin-1 keyword and text)
+func pngTextChunks(meta ImageMetadata) [][]byte {
+	texts := [][2]string{{"Software", imageSoftware}}
+	if !meta.Time.IsZero() { texts = append(texts, [2]string{"Creation Time", meta.Time.Format(time.RFC1123Z)}) }
+	if source := strings.TrimSpace(meta.Make + " " + meta.Model); source != "" { texts = append(texts, [2]string{"Source", source}) }
+	var chunks [][]byte
+	for _, text := range texts {
+		chunks = append(chunks, []byte(text[0] + "\x00" + text[1]))
+	}
+	return chunks
+}
+
+// Encode image as PNG with metadata in tEXt, eXIf and iTXt (XMP packet) chunks
+func encodePNG(w io.Writer, img image.Image, compression png.CompressionLevel, meta ImageMetadata) error {
+	var buf bytes.Buffer
+	encoder := png.Encoder{CompressionLevel: compression}
+	err := encoder.Encode(&buf, img)
+	if err != nil { return err }
+	encoded := buf.Bytes()
+	if len(encoded) < pngHeaderSize || string(encoded[12:16]) != "IHDR" { return errors.New("Unexpected PNG encoder output") }
+	_, err = w.Write(encoded[:pngHeaderSize])
+	if err != nil { return err }
+	for _, text := range pngTextChunks(meta) {
+		err = writePNGChunk(w, "tEXt", text)
+		if err != nil { return err }
+	}
+	err = writePNGChunk(w, "eXIf", buildEXIF(meta))
+	if err != nil { return err }
+	// keyword, no compression, empty language and translated keyword
+	itxt := append([]byte(pngXMPKeyword), 0, 0, 0, 0, 0)
+	err = writePNGChunk(w, "iTXt", append(itxt, buildXMP(meta)...))
+	if err != nil { return err }
+	_, err = w.Write(encoded[pngHeaderSize:])
+	return err
+}
+
+// Write JPEG marker segment with length
+func writeJPEGSegment(w io.Writer, marker byte, payload []byte) error {
+	if len(payload) > maxJPEGSegmentPayload { return errors.New(fmt.Sprintf("JPEG segment payload too long: %d bytes", len(payload))) }
+	header := []byte{0xFF, marker, 0, 0}
+	binary.BigEndian.PutUint16(header[2:], uint16(len(payload) + 2))
+	_, err := w.Write(header)
+	if err != nil { return err }
+	_, err = w.Write(payload)
+	return err
+}
+
+// Encode image as JPEG with EXIF and XMP packet in APP1 segments
+func encodeJPEG(w io.Writer, img image.Image, quality int, meta ImageMetadata) error {
+	var buf bytes.Buffer
+	err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: quality})
+	if err != nil { return err }
+	encoded := buf.Bytes()
+	if len(encoded) < 2 || encoded[0] != 0xFF || encoded[1] != 0xD8 { return errors.New("Unexpected JPEG encoder output") }
+	// EXIF goes right after SOI (there is no JFIF segment)
+	_, err = w.Write(encoded[:2])
+	if err != nil { return err }
+	err = writeJPEGSegment(w, 0xE1, append([]byte(jpegEXIFHeader), buildEXIF(meta)...))
+	if err != nil { return err }
+	err = writeJPEGSegment(w, 0xE1, append([]byte(jpegXMPHeader), buildXMP(meta)...))
+	if err != nil { return err }
+	_, err = w.Write(encoded[2:])
+	return err
+}
+
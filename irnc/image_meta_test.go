@@ -0,0 +1,131 @@
+package irnc
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"testing"
+	"time"
+)
+
+var testImageMetadata = ImageMetadata{
+	Time: time.Date(2021, 3, 1, 11, 0, 0, 0, time.FixedZone("CET", 3600)),
+	Position: &GPSPosition{Latitude: 50.05, Longitude: -14.5, AltitudeM: 245.3, Quality: "gps", Satellites: 7, HDOP: 1.25, Time: time.Date(2021, 3, 1, 10, 0, 0, 0, time.UTC)},
+	Make: "Seek Thermal",
+	Model: "CompactPRO",
+	RotationDegree: 90,
+	Thermal: &ThermalImageInfo{PaletteNumber: 11, Palette: "hot"},
+}
+
+// Values of big-endian TIFF IFD at offset by tag
+func readTestIFD(t *testing.T, tiff []byte, offset uint32) map[uint16][]byte {
+	t.Helper()
+	typeSizes := map[uint16]uint32{tiffByte: 1, tiffASCII: 1, tiffShort: 2, tiffLong: 4, tiffRational: 8, tiffUndefined: 1}
+	res := make(map[uint16][]byte)
+	count := binary.BigEndian.Uint16(tiff[offset:])
+	for i := uint32(0); i < uint32(count); i++ {
+		entry := tiff[offset + 2 + 12 * i:]
+		tag, fieldType, valueCount := binary.BigEndian.Uint16(entry), binary.BigEndian.Uint16(entry[2:]), binary.BigEndian.Uint32(entry[4:])
+		size := typeSizes[fieldType] * valueCount
+		if size <= 4 {
+			res[tag] = entry[8:8 + size]
+		} else {
+			valueOffset := binary.BigEndian.Uint32(entry[8:])
+			res[tag] = tiff[valueOffset:valueOffset + size]
+		}
+	}
+	return res
+}
+
+// Check EXIF content written for testImageMetadata
+func checkTestEXIF(t *testing.T, tiff []byte) {
+	t.Helper()
+	if string(tiff[:4]) != "MM\x00\x2a" { t.Fatalf("Unexpected TIFF header %q", tiff[:4]) }
+	ifd0 := readTestIFD(t, tiff, binary.BigEndian.Uint32(tiff[4:]))
+	for tag, expected := range map[uint16]string{tagMake: "Seek Thermal\x00", tagModel: "CompactPRO\x00", tagDateTime: "2021:03:01 11:00:00\x00", tagOrientation: "\x00\x01"} {
+		if string(ifd0[tag]) != expected { t.Fatalf("Tag %#x is %q instead of %q", tag, ifd0[tag], expected) }
+	}
+	exifIFD := readTestIFD(t, tiff, binary.BigEndian.Uint32(ifd0[tagExifIFDPointer]))
+	if string(exifIFD[tagOffsetTimeOriginal]) != "+01:00\x00" { t.Fatalf("Unexpected time offset %q", exifIFD[tagOffsetTimeOriginal]) }
+	gpsIFD := readTestIFD(t, tiff, binary.BigEndian.Uint32(ifd0[tagGPSIFDPointer]))
+	if string(gpsIFD[tagGPSLatitudeRef]) != "N\x00" || string(gpsIFD[tagGPSLongitudeRef]) != "W\x00" || string(gpsIFD[tagGPSDateStamp]) != "2021:03:01\x00" {
+		t.Fatalf("Unexpected GPS references %q %q %q", gpsIFD[tagGPSLatitudeRef], gpsIFD[tagGPSLongitudeRef], gpsIFD[tagGPSDateStamp])
+	}
+	var longitude [6]uint32
+	for i := range longitude {
+		longitude[i] = binary.BigEndian.Uint32(gpsIFD[tagGPSLongitude][4 * i:])
+	}
+	if longitude != [6]uint32{14, 1, 30, 1, 0, 1000} { t.Fatal("Unexpected GPS longitude", longitude) }
+	if binary.BigEndian.Uint32(gpsIFD[tagGPSAltitude]) != 2453 || gpsIFD[tagGPSAltitudeRef][0] != 0 { t.Fatal("Unexpected GPS altitude", gpsIFD[tagGPSAltitude]) }
+}
+
+// Check XMP content written for testImageMetadata
+func checkTestXMP(t *testing.T, encoded []byte) {
+	t.Helper()
+	for _, expected := range []string{
+		`xmp:CreateDate="2021-03-01T11:00:00+01:00"`,
+		`tiff:Model="CompactPRO"`,
+		`exif:GPSLatitude="50,3.000000N"`,
+		`exif:GPSLongitude="14,30.000000W"`,
+		`exif:GPSAltitude="2453/10"`,
+		`exif:GPSTimeStamp="2021-03-01T10:00:00Z"`,
+		`irnc:MountRotation="90"`,
+		`irnc:Palette="hot"`,
+		`irnc:PaletteNumber="11"`,
+	} {
+		if !bytes.Contains(encoded, []byte(expected)) { t.Fatalf("%s is missing", expected) }
+	}
+}
+
+func TestEncodePNGMetadata(t *testing.T) {
+	var buf bytes.Buffer
+	err := encodePNG(&buf, image.NewGray(image.Rect(0, 0, 4, 4)), png.DefaultCompression, testImageMetadata)
+	if err != nil { t.Fatal("PNG encoding error:", err) }
+	encoded := buf.Bytes()
+	_, err = png.Decode(bytes.NewReader(encoded))
+	if err != nil { t.Fatal("PNG with metadata is invalid:", err) }
+
+	// chunks following IHDR
+	chunks := make(map[string][]byte)
+	for offset := pngHeaderSize; offset < len(encoded); {
+		length := int(binary.BigEndian.Uint32(encoded[offset:]))
+		chunkType := string(encoded[offset + 4:offset + 8])
+		data := encoded[offset + 8:offset + 8 + length]
+		if chunkType == "tEXt" {
+			chunkType += ":" + string(bytes.SplitN(data, []byte{0}, 2)[0])
+		}
+		chunks[chunkType] = data
+		offset += 12 + length
+	}
+	if string(chunks["tEXt:Source"]) != "Source\x00Seek Thermal CompactPRO" { t.Fatalf("Unexpected source text %q", chunks["tEXt:Source"]) }
+	if string(chunks["tEXt:Creation Time"]) != "Creation Time\x00Mon, 01 Mar 2021 11:00:00 +0100" { t.Fatalf("Unexpected creation time %q", chunks["tEXt:Creation Time"]) }
+	if !bytes.HasPrefix(chunks["iTXt"], []byte(pngXMPKeyword + "\x00")) { t.Fatal("XMP packet is missing") }
+	checkTestEXIF(t, chunks["eXIf"])
+	checkTestXMP(t, chunks["iTXt"])
+}
+
+func TestEncodeJPEGMetadata(t *testing.T) {
+	img := image.NewYCbCr(image.Rect(0, 0, 16, 16), image.YCbCrSubsampleRatio420)
+	var buf bytes.Buffer
+	err := encodeJPEG(&buf, img, 90, testImageMetadata)
+	if err != nil { t.Fatal("JPEG encoding error:", err) }
+	encoded := buf.Bytes()
+	decoded, err := jpeg.Decode(bytes.NewReader(encoded))
+	if err != nil { t.Fatal("JPEG with metadata is invalid:", err) }
+	if decoded.Bounds() != img.Bounds() { t.Fatal("Unexpected decoded JPEG size", decoded.Bounds()) }
+
+	// APP1 segments following SOI
+	var exif, xmp []byte
+	for offset := 2; encoded[offset] == 0xFF && encoded[offset + 1] == 0xE1; {
+		length := int(binary.BigEndian.Uint16(encoded[offset + 2:]))
+		payload := encoded[offset + 4:offset + 2 + length]
+		if bytes.HasPrefix(payload, []byte(jpegEXIFHeader)) { exif = payload[len(jpegEXIFHeader):] }
+		if bytes.HasPrefix(payload, []byte(jpegXMPHeader)) { xmp = payload[len(jpegXMPHeader):] }
+		offset += 2 + length
+	}
+	if exif == nil || xmp == nil { t.Fatal("EXIF or XMP segment is missing") }
+	checkTestEXIF(t, exif)
+	checkTestXMP(t, xmp)
+}
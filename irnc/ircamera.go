@@ -12,9 +12,19 @@ import (
 	"time"
 )
 
+const MaxIRColorSchemeNumber = 21
+
+// OpenCV colormaps applied by seek_viewer, indexed by color scheme number
+var irColorSchemeNames = [MaxIRColorSchemeNumber + 1]string{
+	"autumn", "bone", "jet", "winter", "rainbow", "ocean", "summer", "spring", "cool", "hsv", "pink",
+	"hot", "parula", "magma", "inferno", "plasma", "viridis", "cividis", "twilight", "twilight_shifted", "turbo", "deepgreen",
+}
+
 type IRCamera struct {
 	colorSchemeNumber uint
 	seekRedirectActive bool
+	viewerCmd *exec.Cmd
+	viewerCtx context.Context
 	V4L2Camera
 }
 
@@ -28,25 +38,29 @@ func GetIRCameraFromConfig(config *Config) *IRCamera {
 		seekRedirectActive: false,
 		V4L2Camera: V4L2Camera {
 			bitrate: camConfig.Bitrate,
+			cameraMake: camConfig.PhysicalConfig.Make,
+			cameraModel: camConfig.PhysicalConfig.Model,
 			decoder: &RawRGBVideoDecoder{deviceDisposition.Width, deviceDisposition.Height},
 			deviceNumber: camConfig.V4L2DeviceNumber,
 			disposition: deviceDisposition,
 			frameReceivers: make(map[string]frameReceivingCommunicationPack),
 			framerate: config.PreviewFramerate,
 			lastImageCh: make(chan image.Image),
+			name: "IRCam",
 			previewWidth: config.PreviewWidth,
 			previewHeight: config.PreviewHeight,
 			previewPixelDensity: camConfig.PreviewPixelDensity,
 			recordWidth: camConfig.RecordWidth,
 			recordHeight: camConfig.RecordHeight,
+			snapshotConfig: camConfig.Snapshot,
 		},
 	}
 }
 
 // Do basic consistency checks for configuration values (camera/tool-specific)
 func (irc *IRCamera) VerifyConfiguration() (res []error) {
-	if irc.colorSchemeNumber > 21 {
-		res = append(res, errors.New("Color scheme number must be between 0 and 21"))
+	if irc.colorSchemeNumber > MaxIRColorSchemeNumber {
+		res = append(res, errors.New(fmt.Sprintf("Color scheme number must be between 0 and %d", MaxIRColorSchemeNumber)))
 	}
 	
 	res = append(res, irc.V4L2Camera.VerifyConfiguration()...)
@@ -67,15 +81,19 @@ func (irc *IRCamera) setupIRV4L2(ctx context.Context) bool {
 		log.Println("Seek_viewer start error:", err)
 		return false
 	}
-	deviceReady := make(chan bool)
+	// buffered so readiness reported before select below isn't lost
+	deviceReady := make(chan bool, 1)
 	startupTimeout := GeneralExternalsExecutionTimeout
 	go func() {
+		// keep reading after device is opened so viewer never blocks on full stdout pipe
 		viewerOutputScanner := bufio.NewScanner(viewerStdout)
 		for viewerOutputScanner.Scan() {
 			line := viewerOutputScanner.Text()
 			if line == "Opened v4l2 device" {
-				deviceReady<- true
-				break
+				select {
+					case deviceReady<- true:
+					default:
+				}
 			}
 		}
 	}()
@@ -83,23 +101,89 @@ func (irc *IRCamera) setupIRV4L2(ctx context.Context) bool {
 		case ready := <-deviceReady:
 			if ready {
 				irc.seekRedirectActive = true
+				irc.viewerCmd = viewerCmd
+				irc.viewerCtx = ctx
 				return true
 			}
 		case <-ctx.Done():
 		case <-time.After(startupTimeout):
 	}
 	log.Println("Failed to start seek_viewer")
-	err = viewerCmd.Process.Signal(syscall.SIGINT)
-	if err != nil { log.Println("Failed seek_viewer kill error:", err) }
+	// reaped here, supervisor retries start and each attempt would leave a zombie holding the device
+	stopViewer(viewerCmd)
 	return false
 }
 
+// Interrupt seek_viewer and wait for its exit, it's killed when it ignores interrupt
+func stopViewer(viewerCmd *exec.Cmd) {
+	err := viewerCmd.Process.Signal(syscall.SIGINT)
+	if err != nil { log.Println("Seek_viewer interrupt error:", err) }
+	exited := make(chan struct{})
+	go func() {
+		viewerCmd.Wait()
+		close(exited)
+	}()
+	select {
+		case <-exited:
+		case <-time.After(GeneralExternalsExecutionTimeout):
+			log.Println("Seek_viewer ignores interrupt, killing it")
+			err = viewerCmd.Process.Kill()
+			if err != nil { log.Println("Seek_viewer kill error:", err) }
+			<-exited
+	}
+}
+
 // Configure and open camera device
-func (irc *IRCamera) Start(ctx context.Context) {
+func (irc *IRCamera) Start(ctx context.Context) error {
 	// seek_viewer tends to segfault itself out of existence on my device which is suboptimal
-	// restart in loop until ^ fixed; delete loop afterwards
-	for !irc.setupIRV4L2(ctx) { }
-	irc.V4L2Camera.Start(ctx)
+	// supervisor restarts camera (with backoff) until ^ fixed
+	if !irc.setupIRV4L2(ctx) {
+		return errors.New("Failed to start seek_viewer")
+	}
+	return irc.V4L2Camera.Start(ctx)
+}
+
+// Change palette of IR camera output, running seek_viewer is restarted with new colormap
+func (irc *IRCamera) SetColorScheme(colorSchemeNumber uint) error {
+	if colorSchemeNumber > MaxIRColorSchemeNumber {
+		return errors.New(fmt.Sprintf("Color scheme number must be between 0 and %d", MaxIRColorSchemeNumber))
+	}
+	irc.stateMtx.Lock()
+	irc.colorSchemeNumber = colorSchemeNumber
+	viewerCmd, ctx := irc.viewerCmd, irc.viewerCtx
+	if viewerCmd == nil {
+		// not started yet, new colormap will be used on start
+		irc.stateMtx.Unlock()
+		return nil
+	}
+	irc.viewerCmd = nil
+	irc.seekRedirectActive = false
+	irc.stateMtx.Unlock()
+	
+	stopViewer(viewerCmd)
+	if !irc.setupIRV4L2(ctx) {
+		return errors.New("Failed to restart seek_viewer with new color scheme")
+	}
+	log.Println("IR color scheme changed to", colorSchemeNumber)
+	return nil
+}
+
+// Wait until device, decoder and seek_viewer (killed by start context) are released
+func (irc *IRCamera) Wait() {
+	irc.V4L2Camera.Wait()
+	irc.stateMtx.Lock()
+	viewerCmd := irc.viewerCmd
+	irc.viewerCmd = nil
+	irc.seekRedirectActive = false
+	irc.stateMtx.Unlock()
+	if viewerCmd != nil {
+		viewerCmd.Wait()
+	}
+}
+
+// Get H264 stream encoded from raw camera images
+func (irc *IRCamera) StreamH264(ctx context.Context) (<-chan []byte, error) {
+	return irc.StreamEncodedImages(ctx), nil
 }
 
 // Take a photo and save it as png by seek_snapshot call
@@ -110,14 +194,15 @@ func (irc *IRCamera) savePngBySeekSnapshot(filename string) error {
 	return exec.CommandContext(cmdCtx, "seek_snapshot", "-t", "seekpro", "-c", fmt.Sprintf("%d", irc.colorSchemeNumber), "-r", fmt.Sprintf("%d", irc.disposition.RotationDegree), "-o", filename).Run()
 }
 
-// Take a photo and save it to file with given name prefix
-func (irc *IRCamera) SaveSnapshot(namePrefix string) error {
-	filename := fmt.Sprintf("%s_ir.png", namePrefix)
+// Take a photo to be saved to file with given name prefix
+func (irc *IRCamera) GrabSnapshot(namePrefix string, meta ImageMetadata, preview bool) (*Snapshot, error) {
+	filename := irc.snapshotFileName(namePrefix, "ir")
 	log.Println("IR snapshot in", filename)
-	// alt: err := irc.savePngBySeekSnapshot(filename)
-	err := irc.SavePngPhotoFromV4L2(filename)
-	if err == nil { log.Println("IR snapshot saved") }
-	return err
+	irc.stateMtx.Lock()
+	meta.Thermal = &ThermalImageInfo{PaletteNumber: irc.colorSchemeNumber, Palette: irColorSchemeNames[irc.colorSchemeNumber]}
+	irc.stateMtx.Unlock()
+	// alt (saves png directly): irc.savePngBySeekSnapshot(filename)
+	return irc.GrabSnapshotFromV4L2(filename, meta, preview)
 }
 
 // Record video to avi file by seek_viewer call
@@ -132,12 +217,17 @@ func (irc *IRCamera) saveAviBySeekViewer(filename string, videoDuration time.Dur
 	return cmd.Process.Signal(syscall.SIGINT)
 }
 
+// Name of video file for given name prefix
+func (irc *IRCamera) VideoFileName(namePrefix string) string {
+	return fmt.Sprintf("%s_ir.h264", namePrefix)
+}
+
 // Record video to file with given name prefix
-func (irc *IRCamera) SaveVideo(namePrefix string, videoDuration time.Duration) error {
-	filename := fmt.Sprintf("%s_ir.h264", namePrefix)
+func (irc *IRCamera) SaveVideo(ctx context.Context, namePrefix string, videoDuration time.Duration) error {
+	filename := irc.VideoFileName(namePrefix)
 	log.Println("IR video in", filename)
 	// alt: err := irc.saveAviBySeekViewer(filename, videoDuration)
-	err := irc.SaveH264VideoFromV4L2(filename, videoDuration)
+	err := irc.SaveH264VideoFromV4L2(ctx, filename, videoDuration)
 	if err == nil {	log.Println("IR video saved") }
 	return err
 }
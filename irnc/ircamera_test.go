@@ -0,0 +1,16 @@
+package irnc
+
+import (
+	"os/exec"
+	"testing"
+	"time"
+)
+
+func TestStopViewer(t *testing.T) {
+	viewerCmd := exec.Command("sleep", "60")
+	if err := viewerCmd.Start(); err != nil { t.Skip("Process can't be started:", err) }
+	started := time.Now()
+	stopViewer(viewerCmd)
+	// reaped, no zombie left behind
+	if viewerCmd.ProcessState == nil || time.Since(started) > GeneralExternalsExecutionTimeout { t.Fatal("Viewer isn't reaped after interrupt") }
+}
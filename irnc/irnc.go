@@ -2,11 +2,6 @@ package irnc
 
 import (
 	"context"
-	"fmt"
-	"fyne.io/fyne/v2"
-	"fyne.io/fyne/v2/app"
-	"fyne.io/fyne/v2/container"
-	"fyne.io/fyne/v2/layout"
 	"io"
 	"log"
 	"os"
@@ -14,24 +9,40 @@ import (
 	"time"
 )
 
+// Format of capture prefixes and log names
+const timestampFormat = "2006.01.02_15.04.05"
+
 func nowAsString() string {
-	return time.Now().Format("2006.01.02_15.04.05")
+	return time.Now().Format(timestampFormat)
 }
 
+var appConfig *Config
 var logFile *os.File
 var nCam, irCam Camera
+var nSupervisor, irSupervisor *CameraSupervisor
 var camReleaseFunc func()
 var camInitMtx sync.Mutex
+// guards configuration, cameras and supervisors which are replaced on cameras restart
+var camerasMtx sync.RWMutex
+// serializes cameras restart and release on shutdown
+var camRestartMtx sync.Mutex
+var exitRequestedCh = make(chan struct{})
+var exitRequestOnce sync.Once
 
 // Prepare to work: initialize hardware, open log
 func Init() {
 	camInitMtx.Lock()
-	logFile, err := os.OpenFile(fmt.Sprintf("%s.log", nowAsString()), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0666)
+	// settings problems are reported to stdout only, since log location is a setting too
+	config := loadConfig()
+	appConfig = config
+	
+	var err error
+	logFile, err = openLogFile(config.Storage)
 	if err != nil { log.Panic("Log file opening error:", err) }
 	logMW := io.MultiWriter(os.Stdout, logFile)
 	log.SetOutput(logMW)
-	
-	config := GetHardcodedConfig()
+	// captures used to be saved to working directory
+	migrateLegacyCaptures(".", config.Storage)
 	nCam = GetNCameraFromConfig(config)
 	irCam = GetIRCameraFromConfig(config)
 	
@@ -44,88 +55,147 @@ func Init() {
 		log.Panic("IRCam configuration errors:", errs)
 	}
 	
-	var ctx context.Context
-	ctx, camReleaseFunc = context.WithCancel(context.Background())
-	go nCam.Start(ctx)
-	go irCam.Start(ctx)
+	errs = SetLiveConfig(config.Live)
+	if len(errs) > 0 {
+		log.Panic("Live configuration errors:", errs)
+	}
+	
+	camerasMtx.Lock()
+	startCameras(config)
+	camerasMtx.Unlock()
+	startHLS(config.HLS, config.PreviewFramerate)
+	startAPIServer(config.API)
+	startMQTT(config.MQTT)
+	startGPIO(config.GPIO, &ChardevGPIOBackend{Chip: config.GPIO.Chip})
+	startBacklight(config.Backlight)
+	startGPS(config.GPS)
+	startCatalog(config.Catalog, config.Storage.Root)
+	startRetention(config.Storage)
+	startS3Sync(config.S3, config.Storage.Root)
 }
 
-// Prepare to die: deallocate resources, close log
+// Prepare to die: refuse new captures, finalize recordings, stop remote APIs, release cameras, close log
 func Finish() {
 	defer camInitMtx.Unlock()
-	camReleaseFunc()
+	log.Println("Shutting down")
+	stopGPIO()
+	stopBacklight()
+	stopCaptures()
+	stopGPS()
+	stopRetention()
+	stopS3Sync()
+	stopCatalog()
+	stopAPIServer()
+	stopMQTT()
+	stopHLS()
+	stopHLSConversions()
+	closeWebRTCPeers()
+	camRestartMtx.Lock()
+	releaseCameras()
+	camRestartMtx.Unlock()
+	log.Println("Shutdown complete")
+	log.SetOutput(os.Stdout)
 	logFile.Sync()
 	logFile.Close()
 }
 
-// warning: non GC-managed memory bleeds constantly (approx. 1Mb in 6min)
-// logic/camera/decoder/etc removal doesn't eliminate memleak
-// seems to bleed faster when GUI updates frequently
-// originating from Fyne communication with Raspbian?
+// Run supervisors for current cameras until release (camerasMtx must be held)
+func startCameras(config *Config) {
+	var ctx context.Context
+	ctx, camReleaseFunc = context.WithCancel(context.Background())
+	nSupervisor = NewCameraSupervisor(nCam, config.Supervisor)
+	irSupervisor = NewCameraSupervisor(irCam, config.Supervisor)
+	go nSupervisor.Run(ctx)
+	go irSupervisor.Run(ctx)
+}
 
-// Run GUI, show main window
-func RunGUI() {
-	app := app.New()
-	w := app.NewWindow("IRNC")
-	
-	buttonSize := float32(100)
-	buttonPaddingSize := float32(10)
-	photoButton := NewSquareIconStickyButton(buttonSize, buttonPaddingSize, rscPhotoPng, func(wg *sync.WaitGroup) {
-		timestamp := nowAsString()
-		wg.Add(1)
-		go func() {
-			err := nCam.SaveSnapshot(timestamp)
-			if err != nil { log.Println("NCam snapshot saving error:", err) }
-			wg.Done()
-		}()
-		go func() {
-			err := irCam.SaveSnapshot(timestamp)
-			if err != nil { log.Println("IRCam snapshot saving error:", err) }
-			wg.Done()
-		}()
-	})
-	recordButton := NewSquareIconStickyButton(buttonSize, buttonPaddingSize, rscVideoPng, func(wg *sync.WaitGroup) {
-		timestamp := nowAsString()
-		wg.Add(1)
-		go func() {
-			err := nCam.SaveVideo(timestamp, RecordedVideoSize)
-			if err != nil { log.Println("NCam video saving error:", err) }
-			wg.Done()
-		}()
-		go func() {
-			err := irCam.SaveVideo(timestamp, RecordedVideoSize)
-			if err != nil { log.Println("IRCam video saving error:", err) }
-			wg.Done()
-		}()
-	})
-	exitButton := NewSquareIconStickyButton(buttonSize, buttonPaddingSize, rscExitPng, func(*sync.WaitGroup) {
-		os.Exit(0)
-	})
-	buttons := container.New(layout.NewVBoxLayout(), layout.NewSpacer(), photoButton, layout.NewSpacer(), recordButton, layout.NewSpacer(), exitButton, layout.NewSpacer())
-	
-	minPreviewSize := fyne.Size{Width: 100, Height: 100}
-	nImageWidget := NewUpdateableImage(minPreviewSize)
-	irImageWidget := NewUpdateableImage(minPreviewSize)
-	w.SetContent(container.New(&irncLayout{}, irImageWidget, buttons, nImageWidget))
-	
-	config := GetHardcodedConfig()
-	for _, cameraWidgetPair := range [][]interface{}{{nCam, nImageWidget}, {irCam, irImageWidget}} {
-		go func(camWidgetPair []interface{}) {
-			camera := camWidgetPair[0].(Camera)
-			widget := camWidgetPair[1].(*UpdateableImage)
-			
-			for {
-				preview, err := camera.Preview()
-				if err == nil {
-					widget.Update(preview)
-				} else {
-					log.Println("Preview image retrieval error:", err)
-				}
-				// warning: sleep-less cycle prevents other widgets update which is suboptimal. runtime.Gosched() is not sufficient.
-				time.Sleep(time.Second / time.Duration(config.PreviewFramerate))
-			}
-		}(cameraWidgetPair)
+// Stop current cameras and wait until they are released
+func releaseCameras() {
+	camerasMtx.RLock()
+	release, supervisors := camReleaseFunc, []*CameraSupervisor{nSupervisor, irSupervisor}
+	camerasMtx.RUnlock()
+	release()
+	for _, supervisor := range supervisors {
+		supervisor.Wait()
 	}
-	w.SetFullScreen(true)
-	w.ShowAndRun()
+}
+
+// Replace cameras by ones built from configuration, captures are refused meanwhile
+func restartCameras(config *Config) error {
+	camRestartMtx.Lock()
+	defer camRestartMtx.Unlock()
+	err := pauseCaptures()
+	if err != nil { return err }
+	defer resumeCaptures()
+	log.Println("Restarting cameras")
+	stopHLS()
+	closeWebRTCPeers()
+	releaseCameras()
+	camerasMtx.Lock()
+	appConfig = config
+	nCam = GetNCameraFromConfig(config)
+	irCam = GetIRCameraFromConfig(config)
+	startCameras(config)
+	camerasMtx.Unlock()
+	startHLS(config.HLS, config.PreviewFramerate)
+	return nil
+}
+
+// Get current configuration
+func getAppConfig() *Config {
+	camerasMtx.RLock()
+	defer camerasMtx.RUnlock()
+	return appConfig
+}
+
+// Replace configuration which doesn't require cameras restart
+func setAppConfig(config *Config) {
+	camerasMtx.Lock()
+	defer camerasMtx.Unlock()
+	appConfig = config
+}
+
+// Replace configuration by its copy changed by update
+func updateAppConfig(update func(config *Config)) {
+	camerasMtx.Lock()
+	defer camerasMtx.Unlock()
+	config := *appConfig
+	update(&config)
+	appConfig = &config
+}
+
+// Get initialized normal/nightvision and infrared cameras (they are replaced on settings change, so don't keep them for long)
+func Cameras() (Camera, Camera) {
+	camerasMtx.RLock()
+	defer camerasMtx.RUnlock()
+	return nCam, irCam
+}
+
+// Get status of camera supervised since initialization
+func GetCameraStatus(cam Camera) CameraStatus {
+	camerasMtx.RLock()
+	supervisors := []*CameraSupervisor{nSupervisor, irSupervisor}
+	camerasMtx.RUnlock()
+	for _, supervisor := range supervisors {
+		if supervisor != nil && supervisor.cam == cam { return supervisor.Status() }
+	}
+	return CameraStatus{State: CameraStopped}
+}
+
+// Get framerate of recorded videos
+func RecordingFramerate() uint {
+	return getAppConfig().PreviewFramerate
+}
+
+// Ask application to shut down (for inputs which are not aware of GUI), repeated requests are ignored
+func RequestExit() {
+	exitRequestOnce.Do(func() {
+		log.Println("Exit requested")
+		close(exitRequestedCh)
+	})
+}
+
+// Get channel closed when exit is requested
+func ExitRequested() <-chan struct{} {
+	return exitRequestedCh
 }
@@ -0,0 +1,172 @@
+package irnc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+const mqttQoS = 1
+const mqttStatusOnline = "online"
+const mqttStatusOffline = "offline"
+
+// Command received from MQTT command topic
+type MQTTCommand struct {
+	// "snapshot", "record", "stop", "palette", "timelapse", "burst" or "stop_sequence"
+	Command string `json:"command"`
+	// recording duration for "record", live config value is used if omitted; timelapse duration for "timelapse", 0 runs until stopped
+	DurationSec uint `json:"duration_sec,omitempty"`
+	// color scheme number for "palette"
+	Palette uint `json:"palette,omitempty"`
+	// time between pairs for "timelapse"
+	IntervalSec float64 `json:"interval_sec,omitempty"`
+	// number of pairs for "burst"
+	Count uint `json:"count,omitempty"`
+	// assemble "timelapse" or "burst" frames into videos
+	Video bool `json:"video,omitempty"`
+	// delayed start of "timelapse" or "burst"
+	StartAt time.Time `json:"start_at,omitempty"`
+}
+
+var mqttClient mqtt.Client
+var mqttConfig MQTTConfig
+var mqttCancel context.CancelFunc
+var mqttConnectDone chan struct{}
+
+// Execute command received from broker
+func executeMQTTCommand(cmd MQTTCommand) error {
+	switch cmd.Command {
+		case "snapshot":
+			// result is published with snapshot_taken event
+			_, errs := StartSnapshot()
+			if len(errs) > 0 { return errs[0] }
+			return nil
+		case "record":
+			videoDuration := GetLiveConfig().VideoDuration()
+			if cmd.DurationSec > 0 {
+				videoDuration = time.Duration(cmd.DurationSec) * time.Second
+			}
+			_, err := StartRecording(videoDuration)
+			return err
+		case "stop":
+			return StopRecording()
+		case "palette":
+			return SetIRColorScheme(cmd.Palette)
+		case "timelapse", "burst":
+			// progress is published with sequence_started, snapshot_taken and sequence_stopped events
+			_, err := StartSequence(SequenceRequest{Mode: SequenceMode(cmd.Command), IntervalSec: cmd.IntervalSec, DurationSec: cmd.DurationSec, Count: cmd.Count, Video: cmd.Video, StartAt: cmd.StartAt})
+			return err
+		case "stop_sequence":
+			return StopSequence()
+		default:
+			return errors.New(fmt.Sprintf("Unknown command %q", cmd.Command))
+	}
+}
+
+// Handle message from command topic
+func handleMQTTCommandMessage(client mqtt.Client, msg mqtt.Message) {
+	var cmd MQTTCommand
+	err := json.Unmarshal(msg.Payload(), &cmd)
+	if err != nil {
+		log.Println("MQTT command parsing error:", err)
+		return
+	}
+	log.Println("MQTT command:", cmd.Command)
+	// commands may take a while, don't block client message routing
+	go func() {
+		err := executeMQTTCommand(cmd)
+		if err != nil { log.Printf("MQTT command %q error: %v", cmd.Command, err) }
+	}()
+}
+
+// Create broker client, lost connection is reestablished in background with exponential backoff (see connectMQTT for first one)
+func newMQTTClient(config MQTTConfig) mqtt.Client {
+	opts := mqtt.NewClientOptions()
+	opts.AddBroker(config.Broker)
+	opts.SetClientID(config.ClientID)
+	opts.SetUsername(config.Username)
+	opts.SetPassword(config.Password)
+	opts.SetWill(config.StatusTopic, mqttStatusOffline, mqttQoS, true)
+	opts.SetAutoReconnect(true)
+	opts.SetConnectTimeout(GeneralExternalsExecutionTimeout)
+	opts.SetMaxReconnectInterval(config.ReconnectMaxInterval)
+	opts.SetOnConnectHandler(func(client mqtt.Client) {
+		log.Println("MQTT connected to", config.Broker)
+		client.Publish(config.StatusTopic, mqttQoS, true, mqttStatusOnline)
+		// subscriptions are lost with clean session so renew them on every (re)connect
+		if config.CommandTopic != "" {
+			token := client.Subscribe(config.CommandTopic, mqttQoS, handleMQTTCommandMessage)
+			if token.Wait() && token.Error() != nil { log.Println("MQTT subscription error:", token.Error()) }
+		}
+	})
+	opts.SetConnectionLostHandler(func(client mqtt.Client, err error) {
+		log.Println("MQTT connection lost:", err)
+	})
+	return mqtt.NewClient(opts)
+}
+
+// Connect to broker, failed attempts are retried with interval doubled up to maximum (like client's reconnects) until context is done
+func connectMQTT(ctx context.Context, client mqtt.Client, config MQTTConfig) {
+	interval := config.ReconnectMinInterval
+	if interval <= 0 { interval = time.Second }
+	for {
+		token := client.Connect()
+		token.Wait()
+		if token.Error() == nil { return }
+		log.Printf("MQTT connection error: %v, retrying in %v", token.Error(), interval)
+		select {
+			case <-ctx.Done():
+				return
+			case <-time.After(interval):
+		}
+		interval *= 2
+		if interval > config.ReconnectMaxInterval { interval = config.ReconnectMaxInterval }
+	}
+}
+
+// Publish event as JSON to its topic
+func publishMQTTEvent(client mqtt.Client, config MQTTConfig, event Event) {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		log.Println("MQTT event serialization error:", err)
+		return
+	}
+	// client queues messages while reconnecting, so no waiting for token here
+	client.Publish(fmt.Sprintf("%s/%s", config.EventTopicPrefix, event.Type), mqttQoS, false, payload)
+}
+
+// Connect to broker and forward events to it in background (if enabled)
+func startMQTT(config MQTTConfig) {
+	if config.Broker == "" { return }
+	mqttConfig = config
+	mqttClient = newMQTTClient(config)
+	var ctx context.Context
+	ctx, mqttCancel = context.WithCancel(context.Background())
+	mqttConnectDone = make(chan struct{})
+	go func(client mqtt.Client) {
+		defer close(mqttConnectDone)
+		connectMQTT(ctx, client, config)
+	}(mqttClient)
+	go func(client mqtt.Client, eventCh <-chan Event) {
+		for event := range eventCh {
+			publishMQTTEvent(client, config, event)
+		}
+	}(mqttClient, SubscribeEvents(ctx))
+}
+
+// Announce going offline and disconnect from broker
+func stopMQTT() {
+	if mqttClient == nil { return }
+	mqttCancel()
+	<-mqttConnectDone
+	if mqttClient.IsConnected() {
+		token := mqttClient.Publish(mqttConfig.StatusTopic, mqttQoS, true, mqttStatusOffline)
+		token.WaitTimeout(GeneralExternalsExecutionTimeout)
+	}
+	mqttClient.Disconnect(uint(time.Second / time.Millisecond))
+	mqttClient = nil
+}
@@ -0,0 +1,125 @@
+package irnc
+
+import (
+	"encoding/json"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"sync"
+	"testing"
+	"time"
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+// TCP proxy to broker which can drop client connections without MQTT disconnect, returns its broker URL
+func startMQTTProxy(t *testing.T, broker string) (string, func()) {
+	brokerURL, err := url.Parse(broker)
+	if err != nil { t.Fatal(err) }
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil { t.Fatal(err) }
+	var conns []net.Conn
+	var connsMtx sync.Mutex
+	go func() {
+		for {
+			clientConn, err := listener.Accept()
+			if err != nil { return }
+			brokerConn, err := net.Dial("tcp", brokerURL.Host)
+			if err != nil {
+				clientConn.Close()
+				continue
+			}
+			connsMtx.Lock()
+			conns = append(conns, clientConn, brokerConn)
+			connsMtx.Unlock()
+			go io.Copy(brokerConn, clientConn)
+			go io.Copy(clientConn, brokerConn)
+		}
+	}()
+	dropConns := func() {
+		connsMtx.Lock()
+		defer connsMtx.Unlock()
+		for _, conn := range conns {
+			conn.Close()
+		}
+		conns = nil
+	}
+	t.Cleanup(func() {
+		listener.Close()
+		dropConns()
+	})
+	return "tcp://" + listener.Addr().String(), dropConns
+}
+
+// Requires running broker, e.g. IRNC_TEST_MQTT_BROKER=tcp://localhost:1883 with local Mosquitto
+func TestMQTTEventsAndStatus(t *testing.T) {
+	broker := os.Getenv("IRNC_TEST_MQTT_BROKER")
+	if broker == "" {
+		t.Skip("IRNC_TEST_MQTT_BROKER is not set")
+	}
+	setupSequenceTest(t)
+	proxyBroker, dropConns := startMQTTProxy(t, broker)
+	config := GetHardcodedConfig().MQTT
+	config.Broker = proxyBroker
+	config.ClientID = "irnc-test"
+	config.EventTopicPrefix = "irnc-test/events"
+	config.StatusTopic = "irnc-test/status"
+	config.CommandTopic = "irnc-test/commands"
+
+	received := make(chan mqtt.Message, 16)
+	observerOpts := mqtt.NewClientOptions().AddBroker(broker).SetClientID("irnc-test-observer")
+	observer := mqtt.NewClient(observerOpts)
+	if token := observer.Connect(); token.Wait() && token.Error() != nil {
+		t.Fatal("Observer connection error:", token.Error())
+	}
+	defer observer.Disconnect(100)
+	token := observer.Subscribe("irnc-test/#", mqttQoS, func(client mqtt.Client, msg mqtt.Message) {
+		received<- msg
+	})
+	if token.Wait() && token.Error() != nil {
+		t.Fatal("Observer subscription error:", token.Error())
+	}
+
+	startMQTT(config)
+	defer stopMQTT()
+	// messages of other topics or with other payload (retained status of previous run) are skipped
+	waitForMessage := func(topic, payload string) mqtt.Message {
+		timeout := time.After(5 * time.Second)
+		for {
+			select {
+				case msg := <-received:
+					if msg.Topic() == topic && (payload == "" || string(msg.Payload()) == payload) { return msg }
+				case <-timeout:
+					t.Fatal("No message in topic", topic, payload)
+			}
+		}
+	}
+
+	waitForMessage(config.StatusTopic, mqttStatusOnline)
+	PublishEvent(Event{Type: EventCameraFailed, Camera: "IRCam"})
+	eventMsg := waitForMessage("irnc-test/events/camera_failed", "")
+	var event Event
+	err := json.Unmarshal(eventMsg.Payload(), &event)
+	if err != nil {
+		t.Fatal("Event payload parsing error:", err)
+	}
+	if event.Type != EventCameraFailed || event.Camera != "IRCam" {
+		t.Fatalf("Unexpected event %+v", event)
+	}
+
+	token = observer.Publish(config.CommandTopic, mqttQoS, false, `{"command":"snapshot"}`)
+	if token.Wait() && token.Error() != nil {
+		t.Fatal("Command publishing error:", token.Error())
+	}
+	eventMsg = waitForMessage("irnc-test/events/snapshot_taken", "")
+	err = json.Unmarshal(eventMsg.Payload(), &event)
+	if err != nil || len(event.Errors) > 0 || event.Prefix == "" {
+		t.Fatalf("Snapshot by command failed: %+v (%v)", event, err)
+	}
+
+	// broker publishes last will when connection breaks without disconnect
+	dropConns()
+	waitForMessage(config.StatusTopic, mqttStatusOffline)
+	// client reconnects by itself
+	waitForMessage(config.StatusTopic, mqttStatusOnline)
+}
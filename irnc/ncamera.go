@@ -2,6 +2,7 @@ package irnc
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"image"
 	"log"
@@ -20,28 +21,40 @@ func GetNCameraFromConfig(config *Config) *NCamera {
 	return &NCamera{
 		V4L2Camera: V4L2Camera {
 			bitrate: camConfig.Bitrate,
+			cameraMake: camConfig.PhysicalConfig.Make,
+			cameraModel: camConfig.PhysicalConfig.Model,
 			decoder: &H264Decoder{},
 			deviceNumber: camConfig.V4L2DeviceNumber,
 			disposition: CreateCameraDisposition(camConfig.PhysicalConfig),
 			frameReceivers: make(map[string]frameReceivingCommunicationPack),
 			framerate: config.PreviewFramerate,
 			lastImageCh: make(chan image.Image),
+			name: "NCam",
 			previewWidth: config.PreviewWidth,
 			previewHeight: config.PreviewHeight,
 			previewPixelDensity: camConfig.PreviewPixelDensity,
 			recordWidth: camConfig.RecordWidth,
 			recordHeight: camConfig.RecordHeight,
+			snapshotConfig: camConfig.Snapshot,
+			newStillDecoder: func() VideoDecoder { return &H264Decoder{} },
+			stillRequestCh: make(chan chan stillResult),
 		},
 	}
 }
 
-func (nc *NCamera) Start(ctx context.Context) {
+// Configure and open camera device
+func (nc *NCamera) Start(ctx context.Context) error {
 	nc.stateMtx.Lock()
 	cmdCtx, _ := context.WithTimeout(ctx, GeneralExternalsExecutionTimeout)
 	err := exec.CommandContext(cmdCtx, "v4l2-ctl", "-d", fmt.Sprintf("%d", nc.deviceNumber), fmt.Sprintf("--set-ctrl=rotate=%d", nc.disposition.RotationDegree), "-p", fmt.Sprintf("%d", nc.framerate)).Run()
 	nc.stateMtx.Unlock()
-	if err != nil { log.Panic("NCamera configuration error:", err) }
-	nc.V4L2Camera.Start(ctx)
+	if err != nil { return errors.New(fmt.Sprintf("NCamera configuration error: %v", err)) }
+	return nc.V4L2Camera.Start(ctx)
+}
+
+// Get native H264 stream of camera hardware encoder
+func (nc *NCamera) StreamH264(ctx context.Context) (<-chan []byte, error) {
+	return nc.StreamDeviceFrames(ctx), nil
 }
 
 // Take a photo and save it as png file using raspistill call
@@ -52,14 +65,12 @@ func (nc *NCamera) savePngByRaspistill(filename string) error {
 	return exec.CommandContext(cmdCtx, "raspistill", "-n", "-rot", fmt.Sprintf("%d", nc.disposition.RotationDegree), "-e", "png", "-o", filename).Run()
 }
 
-// Take a photo and save it to file with given name prefix
-func (nc *NCamera) SaveSnapshot(namePrefix string) error {
-	filename := fmt.Sprintf("%s_n.png", namePrefix)
+// Take a photo to be saved to file with given name prefix
+func (nc *NCamera) GrabSnapshot(namePrefix string, meta ImageMetadata, preview bool) (*Snapshot, error) {
+	filename := nc.snapshotFileName(namePrefix, "n")
 	log.Println("N snapshot in", filename)
-	// alt: err := nc.savePngByRaspistill(filename)
-	err := nc.SavePngPhotoFromV4L2(filename)
-	if err == nil { log.Println("N shapshot saved") }
-	return err
+	// alt (saves png directly): nc.savePngByRaspistill(filename)
+	return nc.GrabSnapshotFromV4L2(filename, meta, preview)
 }
 
 // Record video to h264 file via raspivid call
@@ -70,12 +81,17 @@ func (nc *NCamera) saveH264ByRaspivid(filename string, videoDuration time.Durati
 	return exec.CommandContext(cmdCtx, "raspivid", "-n", "-rot", fmt.Sprintf("%d", nc.disposition.RotationDegree), "-t", fmt.Sprintf("%d", videoDuration.Milliseconds()), "-o", filename).Run()
 }
 
+// Name of video file for given name prefix
+func (nc *NCamera) VideoFileName(namePrefix string) string {
+	return fmt.Sprintf("%s_n.h264", namePrefix)
+}
+
 // Record video to file with given name prefix
-func (nc *NCamera) SaveVideo(namePrefix string, videoDuration time.Duration) error {
-	filename := fmt.Sprintf("%s_n.h264", namePrefix)
+func (nc *NCamera) SaveVideo(ctx context.Context, namePrefix string, videoDuration time.Duration) error {
+	filename := nc.VideoFileName(namePrefix)
 	log.Println("N video in", filename)
 	// alt: err := nc.saveH264ByRaspivid(filename, videoDuration)
-	err := nc.SaveH264VideoFromV4L2(filename, videoDuration)
+	err := nc.SaveH264VideoFromV4L2(ctx, filename, videoDuration)
 	if err == nil { log.Println("N video saved") }
 	return err
 }
@@ -0,0 +1,493 @@
+package irnc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+// Minimal part size of S3 multipart upload (except last part)
+const s3MinPartSize = 5 << 20
+// Bandwidth limiter granularity
+const throttledReadSize = 32 << 10
+// Recording state check period while uploads are paused
+const s3PauseCheckInterval = time.Second
+
+// Capture set waiting for upload with progress of its files
+type s3QueueItem struct {
+	Dir string `json:"dir"`
+	Prefix string `json:"prefix"`
+	// names of completely uploaded files
+	Uploaded []string `json:"uploaded,omitempty"`
+	// multipart uploads in progress by file name
+	UploadIDs map[string]string `json:"upload_ids,omitempty"`
+	// files changed after they were uploaded (sidecar edits), uploaded again
+	Changed []string `json:"changed,omitempty"`
+	// only these files are uploaded (set queued again for changed sidecar), nil for whole set
+	Only []string `json:"only,omitempty"`
+}
+
+// Check that item refers to the same capture set
+func (item s3QueueItem) sameSet(other s3QueueItem) bool {
+	return item.Dir == other.Dir && item.Prefix == other.Prefix
+}
+
+// Limits rate of data passed through all readers sharing limiter
+type bandwidthLimiter struct {
+	bytesPerSec uint64
+	// moment when data passed so far fits into limit
+	next time.Time
+	mtx sync.Mutex
+}
+
+// Wait until passing n more bytes keeps rate within limit
+func (l *bandwidthLimiter) wait(ctx context.Context, n int) error {
+	if l.bytesPerSec == 0 || n == 0 { return nil }
+	l.mtx.Lock()
+	now := time.Now()
+	if l.next.Before(now) { l.next = now }
+	l.next = l.next.Add(time.Duration(float64(n) / float64(l.bytesPerSec) * float64(time.Second)))
+	delay := l.next.Sub(now)
+	l.mtx.Unlock()
+	select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+			return nil
+	}
+}
+
+// Reader slowed down by bandwidth limiter
+type throttledReader struct {
+	ctx context.Context
+	reader io.Reader
+	limiter *bandwidthLimiter
+}
+
+// Read small chunk and wait for its share of bandwidth
+func (r *throttledReader) Read(p []byte) (int, error) {
+	if len(p) > throttledReadSize { p = p[:throttledReadSize] }
+	n, err := r.reader.Read(p)
+	if waitErr := r.limiter.wait(r.ctx, n); waitErr != nil { return n, waitErr }
+	return n, err
+}
+
+// Uploads finished capture sets to S3-compatible bucket one by one
+type s3Sync struct {
+	config S3Config
+	root string
+	client *minio.Core
+	limiter *bandwidthLimiter
+	queue []s3QueueItem
+	queueMtx sync.Mutex
+	wakeCh chan struct{}
+}
+
+// Factory function for s3Sync, pending uploads are loaded from queue file
+func newS3Sync(config S3Config, root string, client *minio.Core) *s3Sync {
+	s := &s3Sync{
+		config: config,
+		root: root,
+		client: client,
+		limiter: &bandwidthLimiter{bytesPerSec: config.BandwidthLimit},
+		wakeCh: make(chan struct{}, 1),
+	}
+	err := s.loadQueue()
+	if err != nil { log.Println("S3 queue loading error, pending uploads are lost:", err) }
+	return s
+}
+
+// Read queue file, missing file means empty queue
+func (s *s3Sync) loadQueue() error {
+	data, err := os.ReadFile(s.config.QueueFile)
+	if os.IsNotExist(err) { return nil }
+	if err != nil { return err }
+	s.queueMtx.Lock()
+	defer s.queueMtx.Unlock()
+	return json.Unmarshal(data, &s.queue)
+}
+
+// Write queue file atomically (caller holds queueMtx)
+func (s *s3Sync) saveQueue() {
+	data, err := json.MarshalIndent(s.queue, "", "\t")
+	if err == nil {
+		tmpFilename := s.config.QueueFile + ".tmp"
+		err = os.WriteFile(tmpFilename, data, 0644)
+		if err == nil { err = os.Rename(tmpFilename, s.config.QueueFile) }
+	}
+	if err != nil { log.Println("S3 queue saving error:", err) }
+}
+
+// Check that file is among given names
+func containsName(names []string, name string) bool {
+	for _, n := range names {
+		if n == name { return true }
+	}
+	return false
+}
+
+// Wake worker waiting for queued capture sets
+func (s *s3Sync) wake() {
+	select {
+		case s.wakeCh<- struct{}{}:
+		default:
+	}
+}
+
+// Add capture set to queue (unless it's already there) and wake worker
+func (s *s3Sync) enqueue(dir, prefix string) {
+	item := s3QueueItem{Dir: dir, Prefix: prefix}
+	s.queueMtx.Lock()
+	for i, queued := range s.queue {
+		if queued.sameSet(item) {
+			// sidecar was edited before set was finished, so whole set goes
+			if queued.Only != nil {
+				s.queue[i].Only = nil
+				s.saveQueue()
+			}
+			s.queueMtx.Unlock()
+			s.wake()
+			return
+		}
+	}
+	s.queue = append(s.queue, item)
+	s.saveQueue()
+	s.queueMtx.Unlock()
+	s.wake()
+}
+
+// Queue file of capture set changed after set was queued or uploaded, so it's uploaded again
+func (s *s3Sync) enqueueChanged(dir, prefix, name string) {
+	item := s3QueueItem{Dir: dir, Prefix: prefix, Only: []string{name}}
+	s.queueMtx.Lock()
+	found := false
+	for i, queued := range s.queue {
+		if !queued.sameSet(item) { continue }
+		found = true
+		if !containsName(queued.Changed, name) { s.queue[i].Changed = append(queued.Changed, name) }
+		if queued.Only != nil && !containsName(queued.Only, name) { s.queue[i].Only = append(queued.Only, name) }
+		break
+	}
+	if !found { s.queue = append(s.queue, item) }
+	s.saveQueue()
+	s.queueMtx.Unlock()
+	s.wake()
+}
+
+// Move changed files of queued set back to pending ones and get refreshed item (pending files survive interrupted upload)
+func (s *s3Sync) takeChanged(item s3QueueItem) s3QueueItem {
+	s.queueMtx.Lock()
+	defer s.queueMtx.Unlock()
+	for i, queued := range s.queue {
+		if !queued.sameSet(item) { continue }
+		if len(queued.Changed) == 0 { return queued }
+		changed := make(map[string]bool)
+		for _, name := range queued.Changed {
+			changed[name] = true
+		}
+		var uploaded []string
+		for _, name := range queued.Uploaded {
+			if !changed[name] { uploaded = append(uploaded, name) }
+		}
+		queued.Uploaded, queued.Changed = uploaded, nil
+		s.queue[i] = queued
+		s.saveQueue()
+		return queued
+	}
+	return item
+}
+
+// Get oldest queued capture set
+func (s *s3Sync) next() (s3QueueItem, bool) {
+	s.queueMtx.Lock()
+	defer s.queueMtx.Unlock()
+	if len(s.queue) == 0 { return s3QueueItem{}, false }
+	return s.queue[0], true
+}
+
+// Persist upload progress of queued capture set, changes queued meanwhile are kept
+func (s *s3Sync) update(item s3QueueItem) {
+	s.queueMtx.Lock()
+	defer s.queueMtx.Unlock()
+	for i, queued := range s.queue {
+		if queued.sameSet(item) {
+			s.queue[i].Uploaded, s.queue[i].UploadIDs = item.Uploaded, item.UploadIDs
+			s.saveQueue()
+			return
+		}
+	}
+}
+
+// Remove finished capture set from queue, set changed or extended during upload is kept
+func (s *s3Sync) remove(item s3QueueItem) bool {
+	s.queueMtx.Lock()
+	defer s.queueMtx.Unlock()
+	for i, queued := range s.queue {
+		if queued.sameSet(item) {
+			if len(queued.Changed) > 0 || (queued.Only == nil) != (item.Only == nil) { return false }
+			s.queue = append(s.queue[:i], s.queue[i + 1:]...)
+			s.saveQueue()
+			return true
+		}
+	}
+	return true
+}
+
+// Check whether capture set waits for upload
+func (s *s3Sync) isQueued(dir, prefix string) bool {
+	s.queueMtx.Lock()
+	defer s.queueMtx.Unlock()
+	for _, queued := range s.queue {
+		if queued.Dir == dir && queued.Prefix == prefix { return true }
+	}
+	return false
+}
+
+// Get number of capture sets waiting for upload
+func (s *s3Sync) queueLength() int {
+	s.queueMtx.Lock()
+	defer s.queueMtx.Unlock()
+	return len(s.queue)
+}
+
+// Block while recording is in progress (if configured)
+func (s *s3Sync) waitWhileRecording(ctx context.Context) error {
+	paused := false
+	for s.config.PauseWhileRecording && isRecording() {
+		if !paused {
+			log.Println("S3 sync paused during recording")
+			paused = true
+		}
+		select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(s3PauseCheckInterval):
+		}
+	}
+	return nil
+}
+
+// Get object key of capture file
+func (s *s3Sync) objectKey(dir, name string) string {
+	return path.Join(s.config.KeyPrefix, filepath.ToSlash(dir), name)
+}
+
+// Upload all files of capture set (captured files and sidecars), already uploaded ones are skipped unless they were changed; returns whether any file of set is uploaded
+func (s *s3Sync) uploadSet(ctx context.Context, item s3QueueItem) (bool, error) {
+	item = s.takeChanged(item)
+	dir := filepath.Join(s.root, item.Dir)
+	filenames, err := filepath.Glob(filepath.Join(dir, item.Prefix + "_*"))
+	if err != nil { return false, err }
+	sort.Strings(filenames)
+	uploaded := make(map[string]bool)
+	for _, name := range item.Uploaded {
+		uploaded[name] = true
+	}
+	for _, filename := range filenames {
+		name := filepath.Base(filename)
+		// unfinished atomic writes
+		if uploaded[name] || strings.HasSuffix(name, ".tmp") { continue }
+		if item.Only != nil && !containsName(item.Only, name) { continue }
+		err = s.waitWhileRecording(ctx)
+		if err != nil { return false, err }
+		err = s.uploadFile(ctx, &item, name)
+		// deleted meanwhile
+		if os.IsNotExist(err) { continue }
+		if err != nil { return false, errors.New(fmt.Sprintf("%s upload error: %v", name, err)) }
+		item.Uploaded = append(item.Uploaded, name)
+		s.update(item)
+	}
+	return len(item.Uploaded) > 0, nil
+}
+
+// Get parts of interrupted multipart upload which can be kept (consecutive from first one and of expected size)
+func (s *s3Sync) uploadedParts(ctx context.Context, key, uploadID string, size int64) ([]minio.CompletePart, error) {
+	result, err := s.client.ListObjectParts(ctx, s.config.Bucket, key, uploadID, 0, 10000)
+	if err != nil { return nil, err }
+	sort.Slice(result.ObjectParts, func(i, j int) bool { return result.ObjectParts[i].PartNumber < result.ObjectParts[j].PartNumber })
+	var res []minio.CompletePart
+	for _, part := range result.ObjectParts {
+		number := len(res) + 1
+		expectedSize := size - int64(number - 1) * int64(s.config.PartSize)
+		if expectedSize > int64(s.config.PartSize) { expectedSize = int64(s.config.PartSize) }
+		if part.PartNumber != number || part.Size != expectedSize { break }
+		res = append(res, minio.CompletePart{PartNumber: part.PartNumber, ETag: part.ETag})
+	}
+	return res, nil
+}
+
+// Upload single file, large files are uploaded in parts and upload is resumed if it was interrupted
+func (s *s3Sync) uploadFile(ctx context.Context, item *s3QueueItem, name string) error {
+	file, err := os.Open(filepath.Join(s.root, item.Dir, name))
+	if err != nil { return err }
+	defer file.Close()
+	fileInfo, err := file.Stat()
+	if err != nil { return err }
+	size := fileInfo.Size()
+	key := s.objectKey(item.Dir, name)
+	partSize := int64(s.config.PartSize)
+	if size <= partSize {
+		_, err = s.client.PutObject(ctx, s.config.Bucket, key, &throttledReader{ctx, file, s.limiter}, size, "", "", minio.PutObjectOptions{})
+		return err
+	}
+
+	uploadID := item.UploadIDs[name]
+	var parts []minio.CompletePart
+	if uploadID != "" {
+		parts, err = s.uploadedParts(ctx, key, uploadID, size)
+		if err != nil {
+			log.Printf("S3 upload of %s can't be resumed, starting over: %v", key, err)
+			uploadID = ""
+		} else {
+			log.Printf("S3 upload of %s resumed after %d parts", key, len(parts))
+		}
+	}
+	if uploadID == "" {
+		uploadID, err = s.client.NewMultipartUpload(ctx, s.config.Bucket, key, minio.PutObjectOptions{})
+		if err != nil { return err }
+		if item.UploadIDs == nil { item.UploadIDs = make(map[string]string) }
+		item.UploadIDs[name] = uploadID
+		s.update(*item)
+	}
+	partCount := int((size + partSize - 1) / partSize)
+	for number := len(parts) + 1; number <= partCount; number++ {
+		err = s.waitWhileRecording(ctx)
+		if err != nil { return err }
+		offset := int64(number - 1) * partSize
+		length := size - offset
+		if length > partSize { length = partSize }
+		section := io.NewSectionReader(file, offset, length)
+		part, err := s.client.PutObjectPart(ctx, s.config.Bucket, key, uploadID, number, &throttledReader{ctx, section, s.limiter}, length, "", "", nil)
+		if err != nil { return err }
+		parts = append(parts, minio.CompletePart{PartNumber: number, ETag: part.ETag})
+	}
+	_, err = s.client.CompleteMultipartUpload(ctx, s.config.Bucket, key, uploadID, parts, minio.PutObjectOptions{})
+	if err != nil { return err }
+	delete(item.UploadIDs, name)
+	return nil
+}
+
+// Upload queued capture sets until context is done, failed uploads are retried after pause
+func (s *s3Sync) run(ctx context.Context) {
+	for {
+		item, ok := s.next()
+		if !ok {
+			select {
+				case <-ctx.Done():
+					return
+				case <-s.wakeCh:
+			}
+			continue
+		}
+		uploaded, err := s.uploadSet(ctx, item)
+		if ctx.Err() != nil { return }
+		if err != nil {
+			log.Printf("S3 sync of %s error, retry in %v: %v", item.Prefix, s.config.RetryInterval, err)
+			select {
+				case <-ctx.Done():
+					return
+				case <-time.After(s.config.RetryInterval):
+			}
+			continue
+		}
+		// changed during upload, goes again
+		if !s.remove(item) { continue }
+		if !uploaded {
+			log.Println("Capture set", item.Prefix, "is deleted before upload")
+			continue
+		}
+		log.Println("S3 sync of", item.Prefix, "finished")
+		PublishEvent(Event{Type: EventCaptureUploaded, Prefix: item.Prefix, Dir: item.Dir})
+	}
+}
+
+// Check whether recording is in progress
+func isRecording() bool {
+	recordingMtx.Lock()
+	defer recordingMtx.Unlock()
+	return recording != nil
+}
+
+// Create client of S3-compatible service
+func newS3Client(config S3Config) (*minio.Core, error) {
+	return minio.NewCore(config.Endpoint, &minio.Options{
+		Creds: credentials.NewStaticV4(config.AccessKey, config.SecretKey, ""),
+		Secure: config.UseTLS,
+		Region: config.Region,
+	})
+}
+
+var s3SyncCancel context.CancelFunc
+var s3SyncDone chan struct{}
+var activeS3Sync *s3Sync
+var activeS3SyncMtx sync.Mutex
+
+// Get running S3 sync, nil if it's disabled
+func getS3Sync() *s3Sync {
+	activeS3SyncMtx.Lock()
+	defer activeS3SyncMtx.Unlock()
+	return activeS3Sync
+}
+
+// Start uploading finished captures in background (if enabled)
+func startS3Sync(config S3Config, root string) {
+	if config.Endpoint == "" { return }
+	if config.PartSize < s3MinPartSize {
+		log.Printf("S3 part size must be at least %d bytes, sync is disabled", s3MinPartSize)
+		return
+	}
+	client, err := newS3Client(config)
+	if err != nil {
+		log.Println("S3 client creation error:", err)
+		return
+	}
+	s := newS3Sync(config, root, client)
+	activeS3SyncMtx.Lock()
+	activeS3Sync = s
+	activeS3SyncMtx.Unlock()
+	var ctx context.Context
+	ctx, s3SyncCancel = context.WithCancel(context.Background())
+	s3SyncDone = make(chan struct{})
+	// subscribed before worker start, so no capture is missed
+	eventCh := SubscribeEvents(ctx)
+	go func() {
+		for event := range eventCh {
+			// sequence frames come as snapshots, stop event carries prefix of assembled videos if there are some
+			if event.Type == EventSnapshotTaken || event.Type == EventRecordingStopped || (event.Type == EventSequenceStopped && event.Prefix != "") {
+				s.enqueue(event.Dir, event.Prefix)
+			}
+			// edited sidecar of set which may be uploaded already
+			if event.Type == EventCaptureUpdated {
+				s.enqueueChanged(event.Dir, event.Prefix, CaptureMetaFileName(event.Prefix))
+			}
+		}
+	}()
+	go func() {
+		defer close(s3SyncDone)
+		s.run(ctx)
+	}()
+	log.Printf("S3 sync to %s/%s started, %d capture sets pending", config.Endpoint, config.Bucket, s.queueLength())
+}
+
+// Stop uploads, interrupted ones are resumed on next start
+func stopS3Sync() {
+	if s3SyncCancel == nil { return }
+	s3SyncCancel()
+	<-s3SyncDone
+	s3SyncCancel = nil
+	activeS3SyncMtx.Lock()
+	activeS3Sync = nil
+	activeS3SyncMtx.Unlock()
+}
@@ -0,0 +1,181 @@
+package irnc
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+	"github.com/minio/minio-go/v7"
+)
+
+func TestS3QueuePersistence(t *testing.T) {
+	config := GetHardcodedConfig().S3
+	config.QueueFile = filepath.Join(t.TempDir(), "s3_queue.json")
+	s := newS3Sync(config, t.TempDir(), nil)
+	s.enqueue("2021.03.01", "2021.03.01_10.00.00")
+	s.enqueue("2021.03.01", "2021.03.01_11.00.00")
+	s.enqueue("2021.03.01", "2021.03.01_10.00.00")
+	s.update(s3QueueItem{Dir: "2021.03.01", Prefix: "2021.03.01_11.00.00", Uploaded: []string{"2021.03.01_11.00.00_n.png"}, UploadIDs: map[string]string{"2021.03.01_11.00.00_n.h264": "upload-id"}})
+	s.remove(s3QueueItem{Dir: "2021.03.01", Prefix: "2021.03.01_10.00.00"})
+
+	// queue survives restart
+	restarted := newS3Sync(config, s.root, nil)
+	if restarted.queueLength() != 1 { t.Fatal("1 queued capture set expected, got", restarted.queue) }
+	item, _ := restarted.next()
+	if item.Prefix != "2021.03.01_11.00.00" || len(item.Uploaded) != 1 || item.UploadIDs["2021.03.01_11.00.00_n.h264"] != "upload-id" {
+		t.Fatalf("Queued capture set progress is lost: %+v", item)
+	}
+}
+
+func TestBandwidthLimiter(t *testing.T) {
+	limiter := &bandwidthLimiter{bytesPerSec: 256 << 10}
+	start := time.Now()
+	n, err := io.Copy(io.Discard, &throttledReader{context.Background(), bytes.NewReader(make([]byte, 128 << 10)), limiter})
+	if err != nil || n != 128 << 10 { t.Fatal("Throttled reading error:", n, err) }
+	if elapsed := time.Since(start); elapsed < 400 * time.Millisecond || elapsed > 2 * time.Second {
+		t.Fatal("128 KiB at 256 KiB/s expected to take 0.5s, took", elapsed)
+	}
+}
+
+func TestS3QueueChangedFiles(t *testing.T) {
+	config := GetHardcodedConfig().S3
+	config.QueueFile = filepath.Join(t.TempDir(), "s3_queue.json")
+	s := newS3Sync(config, t.TempDir(), nil)
+	meta := CaptureMetaFileName("2021.03.01_10.00.00")
+
+	// sidecar of uploaded set goes alone
+	s.enqueueChanged("2021.03.01", "2021.03.01_10.00.00", meta)
+	item, _ := s.next()
+	if len(item.Only) != 1 || item.Only[0] != meta { t.Fatalf("Only sidecar upload expected, got %+v", item) }
+	// set finished after sidecar edit goes whole
+	s.enqueue("2021.03.01", "2021.03.01_10.00.00")
+	if item, _ = s.next(); item.Only != nil || s.queueLength() != 1 { t.Fatalf("Whole set upload expected, got %+v", item) }
+	if s.remove(s3QueueItem{Dir: "2021.03.01", Prefix: "2021.03.01_10.00.00", Only: []string{meta}}) {
+		t.Fatal("Set extended during upload is removed")
+	}
+
+	// sidecar edited during upload stays pending
+	item = s.takeChanged(item)
+	item.Uploaded = []string{"2021.03.01_10.00.00_n.png", meta}
+	s.enqueueChanged("2021.03.01", "2021.03.01_10.00.00", meta)
+	s.update(item)
+	if s.remove(item) { t.Fatal("Set changed during upload is removed") }
+	item = s.takeChanged(item)
+	if len(item.Uploaded) != 1 || item.Uploaded[0] != "2021.03.01_10.00.00_n.png" || len(item.Changed) > 0 {
+		t.Fatalf("Changed sidecar isn't pending again: %+v", item)
+	}
+	// pending sidecar survives restart
+	restarted := newS3Sync(config, s.root, nil)
+	if item, _ = restarted.next(); len(item.Uploaded) != 1 { t.Fatalf("Changed sidecar is lost on restart: %+v", item) }
+	item.Uploaded = append(item.Uploaded, meta)
+	restarted.update(item)
+	if !restarted.remove(item) || restarted.queueLength() != 0 { t.Fatal("Finished set isn't removed") }
+}
+
+func TestS3SyncDeletedSet(t *testing.T) {
+	config := GetHardcodedConfig().S3
+	config.QueueFile = filepath.Join(t.TempDir(), "s3_queue.json")
+	// no files, so client isn't needed
+	s := newS3Sync(config, t.TempDir(), nil)
+	s.enqueue("2021.03.01", "2021.03.01_10.00.00")
+	ctx, cancel := context.WithCancel(context.Background())
+	eventCh := SubscribeEvents(ctx)
+	done := make(chan struct{})
+	go func() {
+		s.run(ctx)
+		close(done)
+	}()
+	for deadline := time.Now().Add(time.Second); s.queueLength() > 0 && time.Now().Before(deadline); {
+		time.Sleep(10 * time.Millisecond)
+	}
+	cancel()
+	<-done
+	if s.queueLength() > 0 { t.Fatal("Deleted set stays in queue") }
+	for event := range eventCh {
+		if event.Type == EventCaptureUploaded { t.Fatal("Upload of deleted set is reported") }
+	}
+}
+
+// Requires running MinIO, e.g. IRNC_TEST_S3_ENDPOINT=localhost:9000 with "minio server" default credentials
+func TestS3SyncMinIO(t *testing.T) {
+	endpoint := os.Getenv("IRNC_TEST_S3_ENDPOINT")
+	if endpoint == "" {
+		t.Skip("IRNC_TEST_S3_ENDPOINT is not set")
+	}
+	config := GetHardcodedConfig().S3
+	config.Endpoint = endpoint
+	config.UseTLS = false
+	config.AccessKey, config.SecretKey = "minioadmin", "minioadmin"
+	if accessKey := os.Getenv("IRNC_TEST_S3_ACCESS_KEY"); accessKey != "" {
+		config.AccessKey, config.SecretKey = accessKey, os.Getenv("IRNC_TEST_S3_SECRET_KEY")
+	}
+	config.Bucket = "irnc-test"
+	config.KeyPrefix = "test-" + nowAsString()
+	config.QueueFile = filepath.Join(t.TempDir(), "s3_queue.json")
+	config.PartSize = s3MinPartSize
+	config.BandwidthLimit = 0
+	config.RetryInterval = 100 * time.Millisecond
+	client, err := newS3Client(config)
+	if err != nil { t.Fatal("S3 client creation error:", err) }
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	if exists, err := client.BucketExists(ctx, config.Bucket); err != nil || !exists {
+		err = client.MakeBucket(ctx, config.Bucket, minio.MakeBucketOptions{})
+		if err != nil { t.Fatal("Bucket creation error:", err) }
+	}
+
+	root := t.TempDir()
+	video := make([]byte, 2 * s3MinPartSize + 12345)
+	for i := range video {
+		video[i] = byte(i * 7)
+	}
+	files := map[string][]byte{
+		"2021.03.01/2021.03.01_10.00.00_n.png": []byte("n photo"),
+		"2021.03.01/2021.03.01_10.00.00_meta.json": []byte(`{"starred":true}`),
+		"2021.03.01/2021.03.01_11.00.00_n.h264": video,
+	}
+	for name, content := range files {
+		os.MkdirAll(filepath.Join(root, filepath.Dir(name)), 0755)
+		if err := os.WriteFile(filepath.Join(root, name), content, 0644); err != nil { t.Fatal(err) }
+	}
+
+	// upload interrupted after first part in previous run
+	s := newS3Sync(config, root, client)
+	videoKey := s.objectKey("2021.03.01", "2021.03.01_11.00.00_n.h264")
+	uploadID, err := client.NewMultipartUpload(ctx, config.Bucket, videoKey, minio.PutObjectOptions{})
+	if err != nil { t.Fatal("Multipart upload creation error:", err) }
+	_, err = client.PutObjectPart(ctx, config.Bucket, videoKey, uploadID, 1, bytes.NewReader(video[:s3MinPartSize]), s3MinPartSize, "", "", nil)
+	if err != nil { t.Fatal("Part upload error:", err) }
+	s.enqueue("2021.03.01", "2021.03.01_11.00.00")
+	s.update(s3QueueItem{Dir: "2021.03.01", Prefix: "2021.03.01_11.00.00", UploadIDs: map[string]string{"2021.03.01_11.00.00_n.h264": uploadID}})
+
+	s = newS3Sync(config, root, client)
+	s.enqueue("2021.03.01", "2021.03.01_10.00.00")
+	runCtx, stop := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		s.run(runCtx)
+		close(done)
+	}()
+	for s.queueLength() > 0 && ctx.Err() == nil {
+		time.Sleep(50 * time.Millisecond)
+	}
+	stop()
+	<-done
+	if s.queueLength() > 0 { t.Fatal("Queue is not drained:", s.queue) }
+
+	for name, content := range files {
+		object, err := client.Client.GetObject(ctx, config.Bucket, s.objectKey(filepath.Dir(name), filepath.Base(name)), minio.GetObjectOptions{})
+		if err != nil { t.Fatal("Object retrieval error:", err) }
+		data, err := io.ReadAll(object)
+		object.Close()
+		if err != nil || !bytes.Equal(data, content) { t.Fatalf("Uploaded %s differs from original (%d of %d bytes, %v)", name, len(data), len(content), err) }
+	}
+	// resumed upload is completed rather than started over
+	_, err = client.ListObjectParts(ctx, config.Bucket, videoKey, uploadID, 0, 10000)
+	if minio.ToErrorResponse(err).Code != "NoSuchUpload" { t.Fatal("Interrupted upload is not completed:", err) }
+	if _, err := os.Stat(config.QueueFile); err != nil { t.Fatal("Queue file is missing:", err) }
+}
@@ -0,0 +1,337 @@
+package irnc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+type SequenceMode string
+
+const (
+	SequenceTimelapse SequenceMode = "timelapse"
+	SequenceBurst SequenceMode = "burst"
+)
+
+const minTimelapseInterval = time.Second
+// burst frames wait in memory until they're encoded
+const maxBurstCount = 50
+
+// Timelapse (pairs every interval) or burst (pairs as fast as frames come) parameters
+type SequenceRequest struct {
+	Mode SequenceMode `json:"mode"`
+	// timelapse only
+	IntervalSec float64 `json:"interval_sec,omitempty"`
+	// timelapse only, 0 runs until stopped
+	DurationSec uint `json:"duration_sec,omitempty"`
+	// burst only
+	Count uint `json:"count,omitempty"`
+	// assemble frames of every camera into H264 video
+	Video bool `json:"video,omitempty"`
+	// zero starts immediately
+	StartAt time.Time `json:"start_at,omitempty"`
+}
+
+type SequenceStatus struct {
+	Active bool `json:"active"`
+	Mode SequenceMode `json:"mode,omitempty"`
+	// waiting for start time
+	Scheduled bool `json:"scheduled,omitempty"`
+	// name prefix of frames (followed by frame number), known once started
+	Prefix string `json:"prefix,omitempty"`
+	Dir string `json:"dir,omitempty"`
+	// planned start while scheduled
+	Started time.Time `json:"started,omitempty"`
+	IntervalSec float64 `json:"interval_sec,omitempty"`
+	// pairs to take, 0 for timelapse running until stopped
+	Total uint `json:"total,omitempty"`
+	// pairs with at least one frame
+	Taken uint `json:"taken"`
+	// pairs with some frame missing
+	Failed uint `json:"failed"`
+	NextAt time.Time `json:"next_at,omitempty"`
+	Video bool `json:"video,omitempty"`
+}
+
+type sequenceSession struct {
+	status SequenceStatus
+	interval time.Duration
+	cancel context.CancelFunc
+	done chan struct{}
+}
+
+// guarded by recordingMtx
+var sequence *sequenceSession
+
+// Create encoder of sequence videos, replaced in tests
+var newSequenceEncoder = func(bitrate, framerate uint) VideoEncoder {
+	return &H264Encoder{bitrate: bitrate, framerate: framerate}
+}
+
+// H264 file assembled from sequence frames of one camera
+type sequenceVideo struct {
+	filename string
+	imageCh chan image.Image
+	// size of first frame, encoder can't change it
+	bounds image.Rectangle
+	done chan struct{}
+}
+
+// Do basic consistency checks of sequence parameters
+func (r SequenceRequest) Verify() (res []error) {
+	switch r.Mode {
+		case SequenceTimelapse:
+			if r.IntervalSec < minTimelapseInterval.Seconds() {
+				res = append(res, errors.New(fmt.Sprintf("Timelapse interval must be at least %v", minTimelapseInterval)))
+			}
+		case SequenceBurst:
+			if r.Count == 0 || r.Count > maxBurstCount {
+				res = append(res, errors.New(fmt.Sprintf("Burst count must be between 1 and %d", maxBurstCount)))
+			}
+		default:
+			res = append(res, errors.New(fmt.Sprintf("Unknown sequence mode %q", r.Mode)))
+	}
+	return
+}
+
+// Pairs to take, 0 for endless timelapse
+func (r SequenceRequest) total() uint {
+	if r.Mode == SequenceBurst { return r.Count }
+	return uint(math.Ceil(float64(r.DurationSec) / r.IntervalSec))
+}
+
+// Open video file and encode images sent to it in background
+func startSequenceVideo(filename string, bitrate, framerate uint) (*sequenceVideo, error) {
+	outputFile, err := os.OpenFile(filename, os.O_RDWR|os.O_CREATE, 0755)
+	if err != nil { return nil, err }
+	// burst frames come faster than they're encoded
+	video := &sequenceVideo{filename: filename, imageCh: make(chan image.Image, maxBurstCount), done: make(chan struct{})}
+	encodedCh := SetupChannelEncoder(newSequenceEncoder(bitrate, framerate), video.imageCh)
+	go func() {
+		defer close(video.done)
+		for encoded := range encodedCh {
+			err := encoded.Error
+			if err == nil {
+				_, err = outputFile.Write(encoded.Result)
+			}
+			if err != nil { log.Println("Sequence video writing error:", err) }
+		}
+		err := outputFile.Sync()
+		if err == nil { err = outputFile.Close() }
+		if err != nil { log.Println("Sequence video closing error:", err) }
+	}()
+	return video, nil
+}
+
+// Queue frame for encoding, frames of other size than first one (or of failed encoder) are skipped
+func (v *sequenceVideo) add(img image.Image) {
+	ycbcr := ToYCbCr420(img)
+	if v.bounds.Empty() {
+		v.bounds = ycbcr.Bounds()
+	} else if ycbcr.Bounds() != v.bounds {
+		log.Printf("Sequence frame %v doesn't fit %s video %v, skipped", ycbcr.Bounds(), filepath.Base(v.filename), v.bounds)
+		return
+	}
+	select {
+		case v.imageCh<- ycbcr:
+		// encoder failed and doesn't read frames anymore
+		case <-v.done:
+	}
+}
+
+// Encode queued frames and close file
+func (v *sequenceVideo) finish() {
+	close(v.imageCh)
+	<-v.done
+}
+
+// Start timelapse or burst in background (at requested time), returned channel is closed when sequence ends
+func StartSequence(req SequenceRequest) (<-chan struct{}, error) {
+	errs := req.Verify()
+	if len(errs) > 0 { return nil, errs[0] }
+	recordingMtx.Lock()
+	defer recordingMtx.Unlock()
+	// cameras are replaced during restart
+	err := capturesRefused()
+	if err != nil { return nil, err }
+	if sequence != nil {
+		return nil, errors.New("Timelapse or burst is already in progress")
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	session := &sequenceSession{
+		status: SequenceStatus{
+			Active: true,
+			Mode: req.Mode,
+			Scheduled: req.StartAt.After(time.Now()),
+			Started: req.StartAt,
+			IntervalSec: req.IntervalSec,
+			Total: req.total(),
+			Video: req.Video,
+		},
+		interval: time.Duration(req.IntervalSec * float64(time.Second)),
+		cancel: cancel,
+		done: make(chan struct{}),
+	}
+	if req.Mode == SequenceBurst {
+		session.interval = time.Second / time.Duration(RecordingFramerate())
+	}
+	sequence = session
+	go session.run(ctx)
+	return session.done, nil
+}
+
+// Stop current sequence ahead of time and wait for its videos to be finalized
+func StopSequence() error {
+	recordingMtx.Lock()
+	session := sequence
+	recordingMtx.Unlock()
+	if session == nil {
+		return errors.New("No timelapse or burst in progress")
+	}
+	session.cancel()
+	<-session.done
+	return nil
+}
+
+// Get state and progress of current sequence
+func GetSequenceStatus() SequenceStatus {
+	recordingMtx.Lock()
+	defer recordingMtx.Unlock()
+	if sequence == nil { return SequenceStatus{} }
+	return sequence.status
+}
+
+// Update session status under lock
+func (s *sequenceSession) update(change func(status *SequenceStatus)) {
+	recordingMtx.Lock()
+	defer recordingMtx.Unlock()
+	change(&s.status)
+}
+
+// Wait for start time, take pairs on schedule until total is reached or context is done, then finalize videos
+func (s *sequenceSession) run(ctx context.Context) {
+	defer func() {
+		s.cancel()
+		recordingMtx.Lock()
+		sequence = nil
+		recordingMtx.Unlock()
+		close(s.done)
+	}()
+	if s.status.Scheduled {
+		log.Printf("%s scheduled at %v", s.status.Mode, s.status.Started)
+		select {
+			case <-ctx.Done():
+				return
+			case <-time.After(time.Until(s.status.Started)):
+		}
+	}
+	now := time.Now()
+	prefix := now.Format(timestampFormat)
+	dir, err := prepareCaptureDir(now, 0)
+	if err != nil {
+		log.Printf("%s start error: %v", s.status.Mode, err)
+		PublishEvent(Event{Type: EventSequenceStopped, Sequence: prefix, Errors: errorStrings([]error{err})})
+		return
+	}
+	s.update(func(status *SequenceStatus) {
+		status.Scheduled = false
+		status.Started = now
+		status.Prefix = prefix
+		status.Dir = dir
+	})
+	PublishEvent(Event{Type: EventSequenceStarted, Sequence: prefix, Dir: dir})
+	log.Printf("%s %s started", s.status.Mode, prefix)
+
+	videos := make(map[string]*sequenceVideo)
+	var errs []error
+	if s.status.Video {
+		config := getAppConfig()
+		nCam, irCam := Cameras()
+		for i, cam := range []Camera{nCam, irCam} {
+			bitrate := []uint{config.NConfig.Bitrate, config.IRConfig.Bitrate}[i]
+			video, err := startSequenceVideo(cam.VideoFileName(filepath.Join(CaptureRoot(), dir, s.videoPrefix())), bitrate, RecordingFramerate())
+			if err != nil {
+				errs = append(errs, errors.New(fmt.Sprintf("%s sequence video error: %v", cam.Name(), err)))
+				continue
+			}
+			videos[cam.Name()] = video
+		}
+	}
+	// pairs being saved, jobs aren't kept since they hold frames
+	var savesWg sync.WaitGroup
+	for i := uint(0); s.status.Total == 0 || i < s.status.Total; i++ {
+		// absolute schedule, so slow grabbing doesn't shift following pairs
+		next := now.Add(time.Duration(i) * s.interval)
+		s.update(func(status *SequenceStatus) { status.NextAt = next })
+		select {
+			case <-ctx.Done():
+			case <-time.After(time.Until(next)):
+		}
+		if ctx.Err() != nil { break }
+		// sequence mustn't fill storage up, unlike single captures it goes on unattended
+		err := checkFreeSpace(getAppConfig().Storage, 0)
+		if err != nil {
+			log.Printf("%s %s stopped: %v", s.status.Mode, prefix, err)
+			errs = append(errs, err)
+			break
+		}
+		job, err := s.takePair(dir, fmt.Sprintf("%s_%04d", prefix, i + 1))
+		if err != nil { log.Printf("%s frame %d error: %v", s.status.Mode, i + 1, err) }
+		if job == nil { continue }
+		savesWg.Add(1)
+		go func() {
+			job.Wait()
+			savesWg.Done()
+		}()
+		for name, snapshot := range job.snapshots {
+			if video, ok := videos[name]; ok { video.add(snapshot.Image) }
+		}
+	}
+	// frames are saved before sequence is reported stopped
+	savesWg.Wait()
+	s.update(func(status *SequenceStatus) { status.NextAt = time.Time{} })
+	videoPrefix := ""
+	if len(videos) > 0 {
+		for _, video := range videos {
+			video.finish()
+		}
+		videoPrefix = s.videoPrefix()
+		indexCaptureSet(dir, videoPrefix, currentCameraConfigs())
+	}
+	log.Printf("%s %s finished: %d pairs taken, %d failed", s.status.Mode, prefix, s.status.Taken, s.status.Failed)
+	PublishEvent(Event{Type: EventSequenceStopped, Prefix: videoPrefix, Dir: dir, Sequence: prefix, Errors: errorStrings(errs)})
+}
+
+// Name prefix of assembled videos
+func (s *sequenceSession) videoPrefix() string {
+	return fmt.Sprintf("%s_%s", s.status.Prefix, s.status.Mode)
+}
+
+// Grab frames of both cameras (preview frames in burst) and count result, job is nil if nothing was grabbed
+func (s *sequenceSession) takePair(dir, prefix string) (*SnapshotJob, error) {
+	err := beginCapture()
+	if err == nil {
+		now := time.Now()
+		job, errs := startSnapshotJob(dir, prefix, ImageMetadata{Time: now, Position: CurrentPosition()}, s.status.Mode == SequenceBurst, s.status.Prefix)
+		if len(errs) > 0 { err = errs[0] }
+		if len(job.snapshots) > 0 {
+			// counted once its frames are grabbed, saving errors are published with snapshot_taken event
+			s.update(func(status *SequenceStatus) {
+				status.Taken++
+				if err != nil { status.Failed++ }
+			})
+			return job, err
+		}
+		// saving goroutine only publishes errors
+		job.Wait()
+	}
+	s.update(func(status *SequenceStatus) { status.Failed++ })
+	return nil, err
+}
@@ -0,0 +1,245 @@
+package irnc
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// Camera giving blank frames without device
+type fakeCamera struct {
+	name, id string
+	grabs int32
+	// H264 streams not cancelled yet
+	streams int32
+}
+
+func (cam *fakeCamera) Name() string { return cam.name }
+func (cam *fakeCamera) VerifyConfiguration() []error { return nil }
+func (cam *fakeCamera) Start(context.Context) error { return nil }
+func (cam *fakeCamera) Wait() { }
+func (cam *fakeCamera) LastFrameTime() time.Time { return time.Now() }
+func (cam *fakeCamera) FPS() float64 { return 0 }
+func (cam *fakeCamera) SaveVideo(context.Context, string, time.Duration) error { return nil }
+
+func (cam *fakeCamera) StreamH264(ctx context.Context) (<-chan []byte, error) {
+	atomic.AddInt32(&cam.streams, 1)
+	stream := make(chan []byte)
+	go func() {
+		<-ctx.Done()
+		atomic.AddInt32(&cam.streams, -1)
+		close(stream)
+	}()
+	return stream, nil
+}
+
+func (cam *fakeCamera) Preview() (image.Image, error) {
+	return image.NewYCbCr(image.Rect(0, 0, 16, 8), image.YCbCrSubsampleRatio420), nil
+}
+
+func (cam *fakeCamera) GrabSnapshot(namePrefix string, meta ImageMetadata, preview bool) (*Snapshot, error) {
+	atomic.AddInt32(&cam.grabs, 1)
+	img, _ := cam.Preview()
+	return &Snapshot{Filename: namePrefix + "_" + cam.id + ".png", Config: SnapshotConfig{Format: "png", PNGCompression: "speed"}, Image: img, Meta: meta}, nil
+}
+
+func (cam *fakeCamera) VideoFileName(namePrefix string) string {
+	return namePrefix + "_" + cam.id + ".h264"
+}
+
+// Encoder writing one byte per frame after "H" header
+type fakeEncoder struct { }
+
+func (encoder *fakeEncoder) InitBySample(image.Image) ([]byte, error) {
+	return []byte("H"), nil
+}
+
+func (encoder *fakeEncoder) Encode(img image.Image) ([]byte, error) {
+	if img == nil { return nil, EOFError{} }
+	return []byte("F"), nil
+}
+
+func (encoder *fakeEncoder) Destroy() error {
+	return nil
+}
+
+// Use fake cameras and encoder with capture root in temporary directory, return storage configuration
+func setupSequenceTest(t *testing.T) *Config {
+	config := &Config{
+		NConfig: CameraConfig{Bitrate: 1000000},
+		IRConfig: CameraConfig{Bitrate: 1000000},
+		PreviewFramerate: 20,
+		Storage: StorageConfig{Root: t.TempDir(), PerDayFolders: true},
+	}
+	camerasMtx.Lock()
+	prevConfig, prevNCam, prevIRCam := appConfig, nCam, irCam
+	appConfig, nCam, irCam = config, &fakeCamera{name: "NCam", id: "n"}, &fakeCamera{name: "IRCam", id: "ir"}
+	camerasMtx.Unlock()
+	prevEncoder := newSequenceEncoder
+	newSequenceEncoder = func(uint, uint) VideoEncoder { return &fakeEncoder{} }
+	t.Cleanup(func() {
+		newSequenceEncoder = prevEncoder
+		camerasMtx.Lock()
+		appConfig, nCam, irCam = prevConfig, prevNCam, prevIRCam
+		camerasMtx.Unlock()
+	})
+	return config
+}
+
+// Wait for event of given type, skipping others
+func waitForEvent(t *testing.T, eventCh <-chan Event, eventType EventType, timeout time.Duration) Event {
+	t.Helper()
+	deadline := time.After(timeout)
+	for {
+		select {
+			case event := <-eventCh:
+				if event.Type == eventType { return event }
+			case <-deadline:
+				t.Fatal("No event", eventType)
+		}
+	}
+}
+
+func TestSequenceRequest(t *testing.T) {
+	for _, invalid := range []SequenceRequest{
+		{Mode: "movie"},
+		{Mode: SequenceTimelapse, IntervalSec: 0.5},
+		{Mode: SequenceBurst},
+		{Mode: SequenceBurst, Count: maxBurstCount + 1},
+	} {
+		if len(invalid.Verify()) == 0 { t.Fatalf("%+v passed verification", invalid) }
+	}
+	for req, total := range map[SequenceRequest]uint{
+		{Mode: SequenceTimelapse, IntervalSec: 10, DurationSec: 60}: 6,
+		{Mode: SequenceTimelapse, IntervalSec: 7, DurationSec: 60}: 9,
+		{Mode: SequenceTimelapse, IntervalSec: 10}: 0,
+		{Mode: SequenceBurst, Count: 5, DurationSec: 60}: 5,
+	} {
+		if errs := req.Verify(); len(errs) > 0 { t.Fatal(errs) }
+		if req.total() != total { t.Fatalf("%+v takes %d pairs instead of %d", req, req.total(), total) }
+	}
+}
+
+func TestSequenceBurstVideo(t *testing.T) {
+	config := setupSequenceTest(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	eventCh := SubscribeEvents(ctx)
+	done, err := StartSequence(SequenceRequest{Mode: SequenceBurst, Count: 5, Video: true})
+	if err != nil { t.Fatal("Burst start error:", err) }
+	if _, err = StartSequence(SequenceRequest{Mode: SequenceBurst, Count: 5}); err == nil { t.Fatal("Second sequence is started") }
+	started := waitForEvent(t, eventCh, EventSequenceStarted, time.Second)
+	select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+			t.Fatal("Burst isn't finished")
+	}
+	stopped := waitForEvent(t, eventCh, EventSequenceStopped, time.Second)
+	if len(stopped.Errors) > 0 || stopped.Sequence != started.Sequence || stopped.Prefix != started.Sequence + "_burst" {
+		t.Fatalf("Unexpected sequence_stopped event %+v", stopped)
+	}
+	if status := GetSequenceStatus(); status.Active { t.Fatalf("Finished burst is active: %+v", status) }
+
+	dir := filepath.Join(config.Storage.Root, started.Dir)
+	for i := 1; i <= 5; i++ {
+		for _, id := range []string{"n", "ir"} {
+			name := filepath.Join(dir, fmt.Sprintf("%s_%04d_%s.png", started.Sequence, i, id))
+			if _, err := os.Stat(name); err != nil { t.Fatal("Burst frame is missing:", err) }
+		}
+	}
+	for _, id := range []string{"n", "ir"} {
+		video, err := os.ReadFile(filepath.Join(dir, started.Sequence + "_burst_" + id + ".h264"))
+		if err != nil || !bytes.Equal(video, []byte("H" + strings.Repeat("F", 5))) { t.Fatalf("Unexpected %s video %q (%v)", id, video, err) }
+	}
+}
+
+func TestSequenceScheduleAndStop(t *testing.T) {
+	setupSequenceTest(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	eventCh := SubscribeEvents(ctx)
+	startAt := time.Now().Add(300 * time.Millisecond)
+	done, err := StartSequence(SequenceRequest{Mode: SequenceTimelapse, IntervalSec: 1, StartAt: startAt})
+	if err != nil { t.Fatal("Timelapse start error:", err) }
+	if status := GetSequenceStatus(); !status.Active || !status.Scheduled || !status.Started.Equal(startAt) {
+		t.Fatalf("Unexpected scheduled timelapse status %+v", status)
+	}
+	// waiting sequence doesn't hold cameras
+	if err = pauseCaptures(); err != nil { t.Fatal("Cameras can't be paused while sequence is scheduled:", err) }
+	resumeCaptures()
+	// second sequence is refused during cameras restart with pause reason
+	if err = pauseCaptures(); err != nil { t.Fatal(err) }
+	_, err = StartSequence(SequenceRequest{Mode: SequenceBurst, Count: 5})
+	resumeCaptures()
+	if err == nil || !strings.Contains(err.Error(), "paused") { t.Fatal("Sequence is started during cameras restart:", err) }
+
+	waitForEvent(t, eventCh, EventSequenceStarted, time.Second)
+	if time.Now().Before(startAt) { t.Fatal("Timelapse started ahead of schedule") }
+	if err = pauseCaptures(); err == nil {
+		resumeCaptures()
+		t.Fatal("Cameras are paused while sequence runs")
+	}
+	waitForEvent(t, eventCh, EventSnapshotTaken, time.Second)
+	if status := GetSequenceStatus(); status.Scheduled || status.Taken != 1 || status.Total != 0 || status.NextAt.IsZero() {
+		t.Fatalf("Unexpected running timelapse status %+v", status)
+	}
+	err = StopSequence()
+	if err != nil { t.Fatal("Timelapse stop error:", err) }
+	select {
+		case <-done:
+		default:
+			t.Fatal("Timelapse isn't finished when stop returns")
+	}
+	if stopped := waitForEvent(t, eventCh, EventSequenceStopped, time.Second); len(stopped.Errors) > 0 { t.Fatal("Timelapse stop errors:", stopped.Errors) }
+	if err = StopSequence(); err == nil { t.Fatal("Finished timelapse is stopped again") }
+
+	// stop during waiting for start
+	done, err = StartSequence(SequenceRequest{Mode: SequenceTimelapse, IntervalSec: 1, StartAt: time.Now().Add(time.Hour)})
+	if err != nil { t.Fatal("Timelapse start error:", err) }
+	if err = StopSequence(); err != nil { t.Fatal("Scheduled timelapse stop error:", err) }
+	<-done
+	if status := GetSequenceStatus(); status.Active { t.Fatalf("Stopped timelapse is active: %+v", status) }
+}
+
+func TestSequenceStopsOnLowSpace(t *testing.T) {
+	config := setupSequenceTest(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	eventCh := SubscribeEvents(ctx)
+	done, err := StartSequence(SequenceRequest{Mode: SequenceTimelapse, IntervalSec: 1})
+	if err != nil { t.Fatal("Timelapse start error:", err) }
+	waitForEvent(t, eventCh, EventSnapshotTaken, time.Second)
+	lowSpaceConfig := *config
+	lowSpaceConfig.Storage.MinFreeBytes = 1 << 62
+	setAppConfig(&lowSpaceConfig)
+	select {
+		case <-done:
+		case <-time.After(3 * time.Second):
+			StopSequence()
+			t.Fatal("Timelapse isn't stopped by low free space")
+	}
+	stopped := waitForEvent(t, eventCh, EventSequenceStopped, time.Second)
+	if len(stopped.Errors) != 1 || !strings.Contains(stopped.Errors[0], "Not enough free space") {
+		t.Fatalf("Free space error expected, got %+v", stopped)
+	}
+	_, irCam := Cameras()
+	if grabs := atomic.LoadInt32(&irCam.(*fakeCamera).grabs); grabs != 1 { t.Fatal("1 pair expected before stop, got", grabs) }
+}
+
+func TestRecordingRefusedDuringRestart(t *testing.T) {
+	config := setupSequenceTest(t)
+	if err := pauseCaptures(); err != nil { t.Fatal(err) }
+	_, err := StartRecording(time.Second)
+	resumeCaptures()
+	if err == nil || !strings.Contains(err.Error(), "paused") { t.Fatal("Recording is started during cameras restart:", err) }
+	// refused recording leaves no empty day folder
+	entries, err := os.ReadDir(config.Storage.Root)
+	if err != nil || len(entries) != 0 { t.Fatal("Capture root isn't empty:", entries, err) }
+}
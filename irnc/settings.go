@@ -0,0 +1,179 @@
+package irnc
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+)
+
+// Settings edited on device are saved in working directory and layered over hardcoded configuration
+const SettingsFileName = "settings.json"
+
+type CameraSettings struct {
+	RotationDegree int `json:"rotation_degree"`
+	Bitrate uint `json:"bitrate"`
+	PreviewPixelDensity uint `json:"preview_pixel_density"`
+}
+
+// Part of configuration editable on device
+type Settings struct {
+	N CameraSettings `json:"n"`
+	IR CameraSettings `json:"ir"`
+	// applied without cameras restart
+	IRColorScheme uint `json:"ir_color_scheme"`
+	// capture framerate of both cameras
+	Framerate uint `json:"framerate"`
+	// applied without cameras restart
+	Live LiveConfig `json:"live"`
+	ScreenLayout string `json:"screen_layout"`
+}
+
+// Extract editable settings from configuration
+func SettingsFromConfig(config *Config) Settings {
+	cameraSettings := func(camConfig CameraConfig) CameraSettings {
+		return CameraSettings{
+			RotationDegree: camConfig.PhysicalConfig.RotationDegree,
+			Bitrate: camConfig.Bitrate,
+			PreviewPixelDensity: camConfig.PreviewPixelDensity,
+		}
+	}
+	return Settings{
+		N: cameraSettings(config.NConfig),
+		IR: cameraSettings(config.IRConfig),
+		IRColorScheme: config.IRConfig.ColorSchemeNumber,
+		Framerate: config.PreviewFramerate,
+		Live: config.Live,
+		ScreenLayout: config.ScreenLayout,
+	}
+}
+
+// Overwrite configuration values with settings
+func (s Settings) ApplyTo(config *Config) {
+	applyCameraSettings := func(camConfig *CameraConfig, camSettings CameraSettings) {
+		camConfig.PhysicalConfig.RotationDegree = camSettings.RotationDegree
+		camConfig.Bitrate = camSettings.Bitrate
+		camConfig.PreviewPixelDensity = camSettings.PreviewPixelDensity
+	}
+	applyCameraSettings(&config.NConfig, s.N)
+	applyCameraSettings(&config.IRConfig, s.IR)
+	config.IRConfig.ColorSchemeNumber = s.IRColorScheme
+	config.PreviewFramerate = s.Framerate
+	config.Live = s.Live
+	config.ScreenLayout = s.ScreenLayout
+}
+
+// Check whether switching between settings requires cameras restart
+func (s Settings) requiresRestart(other Settings) bool {
+	return s.N != other.N || s.IR != other.IR || s.Framerate != other.Framerate
+}
+
+// Do consistency checks of cameras built from configuration and live configuration
+func verifyConfig(config *Config) (res []error) {
+	for _, cam := range []Camera{GetNCameraFromConfig(config), GetIRCameraFromConfig(config)} {
+		for _, err := range cam.VerifyConfiguration() {
+			res = append(res, errors.New(fmt.Sprintf("%s: %v", cam.Name(), err)))
+		}
+	}
+	res = append(res, config.Live.Verify()...)
+	return
+}
+
+// Overwrite settings with values from file, missing file keeps settings unchanged
+func LoadSettings(filename string, settings *Settings) error {
+	data, err := os.ReadFile(filename)
+	if os.IsNotExist(err) { return nil }
+	if err != nil { return err }
+	return json.Unmarshal(data, settings)
+}
+
+// Save settings to file atomically
+func SaveSettings(filename string, settings Settings) error {
+	data, err := json.MarshalIndent(settings, "", "\t")
+	if err != nil { return err }
+	tmpFilename := filename + ".tmp"
+	err = os.WriteFile(tmpFilename, data, 0644)
+	if err != nil { return err }
+	return os.Rename(tmpFilename, filename)
+}
+
+// Get hardcoded configuration with saved settings applied (invalid saved settings are ignored)
+func loadConfig() *Config {
+	config := GetHardcodedConfig()
+	settings := SettingsFromConfig(config)
+	err := LoadSettings(SettingsFileName, &settings)
+	if err != nil {
+		log.Println("Settings loading error, defaults are used:", err)
+		return config
+	}
+	candidate := *config
+	settings.ApplyTo(&candidate)
+	errs := verifyConfig(&candidate)
+	if len(errs) > 0 {
+		log.Println("Saved settings are invalid, defaults are used:", errs)
+		return config
+	}
+	return &candidate
+}
+
+// Serializes changes of settings: reading current configuration, applying changed one and saving it
+var settingsMtx sync.Mutex
+
+// Get current settings
+func GetSettings() Settings {
+	settings := SettingsFromConfig(getAppConfig())
+	settings.Live = GetLiveConfig()
+	return settings
+}
+
+// Validate settings, apply them (restarting cameras if needed) and save; screen layout is kept (see SetScreenLayout)
+func ApplySettings(settings Settings) []error {
+	settingsMtx.Lock()
+	defer settingsMtx.Unlock()
+	current := GetSettings()
+	settings.ScreenLayout = current.ScreenLayout
+	config := *getAppConfig()
+	settings.ApplyTo(&config)
+	errs := verifyConfig(&config)
+	if len(errs) > 0 { return errs }
+	
+	if settings.requiresRestart(current) {
+		err := restartCameras(&config)
+		if err != nil { return []error{err} }
+	} else {
+		if settings.IRColorScheme != current.IRColorScheme {
+			err := setIRColorScheme(settings.IRColorScheme)
+			if err != nil { return []error{err} }
+		}
+		setAppConfig(&config)
+	}
+	SetLiveConfig(settings.Live)
+	err := SaveSettings(SettingsFileName, settings)
+	if err != nil {
+		return []error{errors.New(fmt.Sprintf("Settings are applied but not saved: %v", err))}
+	}
+	log.Println("Settings applied")
+	return nil
+}
+
+// Remember screen layout in saved settings, nothing else is applied
+func SetScreenLayout(layout string) error {
+	settingsMtx.Lock()
+	defer settingsMtx.Unlock()
+	if getAppConfig().ScreenLayout == layout { return nil }
+	updateAppConfig(func(config *Config) { config.ScreenLayout = layout })
+	err := SaveSettings(SettingsFileName, GetSettings())
+	if err != nil {
+		return errors.New(fmt.Sprintf("Screen layout saving error: %v", err))
+	}
+	return nil
+}
+
+// Save current settings, live configuration changed on device included
+func PersistSettings() error {
+	settingsMtx.Lock()
+	defer settingsMtx.Unlock()
+	return SaveSettings(SettingsFileName, GetSettings())
+}
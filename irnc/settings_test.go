@@ -0,0 +1,66 @@
+package irnc
+
+import (
+	"os"
+	"sync"
+	"testing"
+)
+
+// Use hardcoded configuration with fake cameras and settings file in temporary working directory
+func setupSettingsTest(t *testing.T) {
+	workDir := t.TempDir()
+	prevWorkDir, err := os.Getwd()
+	if err != nil { t.Fatal(err) }
+	if err = os.Chdir(workDir); err != nil { t.Fatal(err) }
+	config := GetHardcodedConfig()
+	camerasMtx.Lock()
+	prevConfig, prevNCam, prevIRCam := appConfig, nCam, irCam
+	appConfig, nCam, irCam = config, &fakeCamera{name: "NCam", id: "n"}, &fakeCamera{name: "IRCam", id: "ir"}
+	camerasMtx.Unlock()
+	prevLiveConfig := GetLiveConfig()
+	SetLiveConfig(config.Live)
+	t.Cleanup(func() {
+		os.Chdir(prevWorkDir)
+		SetLiveConfig(prevLiveConfig)
+		camerasMtx.Lock()
+		appConfig, nCam, irCam = prevConfig, prevNCam, prevIRCam
+		camerasMtx.Unlock()
+	})
+}
+
+func TestSetScreenLayoutKeepsLiveConfig(t *testing.T) {
+	setupSettingsTest(t)
+	zoom := AdjustZoom(10)
+	if err := SetScreenLayout("vertical"); err != nil { t.Fatal(err) }
+	if GetLiveConfig().ZoomPercent != zoom { t.Fatal("Zoom is reset by layout change:", GetLiveConfig().ZoomPercent) }
+	var saved Settings
+	err := LoadSettings(SettingsFileName, &saved)
+	if err != nil || saved.ScreenLayout != "vertical" || saved.Live.ZoomPercent != zoom { t.Fatalf("Unexpected saved settings %+v (%v)", saved, err) }
+}
+
+func TestConcurrentSettingsChanges(t *testing.T) {
+	setupSettingsTest(t)
+	draft := GetSettings()
+	draft.Live.VideoDurationSec++
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 20; i++ {
+			if errs := ApplySettings(draft); len(errs) > 0 { t.Error("Settings applying errors:", errs) }
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 20; i++ {
+			if err := SetScreenLayout([]string{"side_by_side", "vertical"}[i % 2]); err != nil { t.Error(err) }
+		}
+	}()
+	wg.Wait()
+	// settings draft doesn't carry layout, so toggled one isn't lost
+	var saved Settings
+	err := LoadSettings(SettingsFileName, &saved)
+	if err != nil || saved.ScreenLayout != "vertical" || getAppConfig().ScreenLayout != "vertical" || saved.Live.VideoDurationSec != draft.Live.VideoDurationSec {
+		t.Fatalf("Unexpected saved settings %+v (%v)", saved, err)
+	}
+}
@@ -0,0 +1,312 @@
+package irnc
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"time"
+)
+
+// Encodings running at once, more snapshots wait with their frames in memory
+const maxParallelSnapshotEncodings = 2
+// First line of raw frame dump, JSON header line and frame data follow
+const rawFrameMagic = "IRNC-RAW-FRAME"
+
+var snapshotEncodingSlots = make(chan struct{}, maxParallelSnapshotEncodings)
+
+type snapshotFormat struct {
+	extension string
+	// write snapshot to file
+	save func(filename string, s *Snapshot) error
+}
+
+var snapshotFormats = map[string]snapshotFormat{
+	"png": {"png", savePNGSnapshot},
+	"jpeg": {"jpg", saveJPEGSnapshot},
+	"webp": {"webp", saveWebPSnapshot},
+	"tiff": {"tiff", saveTIFFSnapshot},
+	"raw": {"raw", saveRawSnapshot},
+}
+
+var pngCompressionLevels = map[string]png.CompressionLevel{
+	"default": png.DefaultCompression,
+	"none": png.NoCompression,
+	"speed": png.BestSpeed,
+	"best": png.BestCompression,
+}
+
+// Frame copied from camera, encoded to file later (off the capture path)
+type Snapshot struct {
+	Filename string
+	Config SnapshotConfig
+	Image image.Image
+	Meta ImageMetadata
+}
+
+// Header line of raw frame dump
+type rawFrameHeader struct {
+	// ffmpeg name: "yuv420p", "yuv422p", "yuv440p", "yuv444p", "rgb24", "gray" or "gray16be"
+	PixelFormat string `json:"pixel_format"`
+	Width int `json:"width"`
+	Height int `json:"height"`
+	// planes are stored one after another without padding
+	PlaneSizes []int `json:"plane_sizes"`
+	Time time.Time `json:"time"`
+	Make string `json:"make,omitempty"`
+	Model string `json:"model,omitempty"`
+	RotationDegree int `json:"rotation_degree"`
+	Position *GPSPosition `json:"position,omitempty"`
+	Palette string `json:"palette,omitempty"`
+}
+
+// Do basic consistency checks for snapshot format options
+func (c SnapshotConfig) Verify() (res []error) {
+	if _, ok := snapshotFormats[c.Format]; !ok {
+		res = append(res, errors.New(fmt.Sprintf("Unknown snapshot format %q", c.Format)))
+	}
+	if c.JPEGQuality < 1 || c.JPEGQuality > 100 {
+		res = append(res, errors.New(fmt.Sprintf("JPEG quality must be between 1 and 100, got %d", c.JPEGQuality)))
+	}
+	if _, ok := pngCompressionLevels[c.PNGCompression]; !ok {
+		res = append(res, errors.New(fmt.Sprintf("Unknown PNG compression %q", c.PNGCompression)))
+	}
+	return
+}
+
+// File extension of configured format
+func (c SnapshotConfig) Extension() string {
+	return snapshotFormats[c.Format].extension
+}
+
+// Copy image which may share memory with decoder (YCbCr frames point to decoder buffers reused for next frames)
+func cloneImage(img image.Image) image.Image {
+	switch src := img.(type) {
+		case *image.YCbCr:
+			res := *src
+			res.Y = append([]uint8(nil), src.Y...)
+			res.Cb = append([]uint8(nil), src.Cb...)
+			res.Cr = append([]uint8(nil), src.Cr...)
+			return &res
+		case *image.Gray:
+			res := *src
+			res.Pix = append([]uint8(nil), src.Pix...)
+			return &res
+		case *image.Gray16:
+			res := *src
+			res.Pix = append([]uint8(nil), src.Pix...)
+			return &res
+		default:
+			// RGB frames are allocated by decoders for every frame
+			return img
+	}
+}
+
+// Encode snapshot to temporary file which gets final name once complete, so partial files never show up in captures
+func (s *Snapshot) Save() error {
+	format, ok := snapshotFormats[s.Config.Format]
+	if !ok { return errors.New(fmt.Sprintf("Unknown snapshot format %q", s.Config.Format)) }
+	snapshotEncodingSlots<- struct{}{}
+	defer func() { <-snapshotEncodingSlots }()
+	started := time.Now()
+	tmpFilename := s.Filename + ".tmp"
+	err := format.save(tmpFilename, s)
+	if err == nil { err = os.Rename(tmpFilename, s.Filename) }
+	if err != nil {
+		os.Remove(tmpFilename)
+		return err
+	}
+	log.Printf("Snapshot %s saved in %v", s.Filename, time.Since(started).Round(time.Millisecond))
+	return nil
+}
+
+// Create file and write it by buffered encoder
+func writeSnapshotFile(filename string, encode func(w io.Writer) error) error {
+	file, err := os.Create(filename)
+	if err != nil { return err }
+	w := bufio.NewWriter(file)
+	err = encode(w)
+	if err == nil { err = w.Flush() }
+	closeErr := file.Close()
+	if err != nil { return err }
+	return closeErr
+}
+
+func savePNGSnapshot(filename string, s *Snapshot) error {
+	return writeSnapshotFile(filename, func(w io.Writer) error {
+		return encodePNG(w, s.Image, pngCompressionLevels[s.Config.PNGCompression], s.Meta)
+	})
+}
+
+// JPEG encoder takes YCbCr frames directly (no color conversion)
+func saveJPEGSnapshot(filename string, s *Snapshot) error {
+	return writeSnapshotFile(filename, func(w io.Writer) error {
+		return encodeJPEG(w, s.Image, s.Config.JPEGQuality, s.Meta)
+	})
+}
+
+// Lossless WebP by cwebp from uncompressed PNG with metadata
+func saveWebPSnapshot(filename string, s *Snapshot) error {
+	sourceFilename := filename + ".png"
+	defer os.Remove(sourceFilename)
+	err := writeSnapshotFile(sourceFilename, func(w io.Writer) error {
+		return encodePNG(w, s.Image, png.NoCompression, s.Meta)
+	})
+	if err != nil { return err }
+	cmdCtx, cancel := context.WithTimeout(context.Background(), GeneralExternalsExecutionTimeout)
+	defer cancel()
+	output, err := exec.CommandContext(cmdCtx, "cwebp", "-quiet", "-lossless", "-exact", "-metadata", "all", sourceFilename, "-o", filename).CombinedOutput()
+	if err != nil { return errors.New(fmt.Sprintf("cwebp error: %v %s", err, output)) }
+	return nil
+}
+
+// Uncompressed TIFF keeping depth of source: 16-bit grayscale for radiometric (Gray16) frames, 8-bit grayscale for gray ones, 8-bit RGB for others
+// Palette-rendered IR frames are 8-bit RGB, widening them would only pretend precision
+func saveTIFFSnapshot(filename string, s *Snapshot) error {
+	bounds := s.Image.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if width == 0 || height == 0 { return errors.New("Empty image can't be saved as TIFF") }
+	var pixels []byte
+	photometric, samplesPerPixel, bits := uint16(2), uint16(3), uint16(8)
+	switch img := s.Image.(type) {
+		case *image.Gray16:
+			photometric, samplesPerPixel, bits = 1, 1, 16
+			pixels = make([]byte, 0, width * height * 2)
+			for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+				for x := bounds.Min.X; x < bounds.Max.X; x++ {
+					v := img.Gray16At(x, y).Y
+					pixels = append(pixels, byte(v >> 8), byte(v))
+				}
+			}
+		case *image.Gray:
+			photometric, samplesPerPixel = 1, 1
+			pixels = make([]byte, 0, width * height)
+			for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+				offset := img.PixOffset(bounds.Min.X, y)
+				pixels = append(pixels, img.Pix[offset:offset + width]...)
+			}
+		default:
+			pixels = make([]byte, 0, width * height * 3)
+			for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+				for x := bounds.Min.X; x < bounds.Max.X; x++ {
+					r, g, b, _ := img.At(x, y).RGBA()
+					pixels = append(pixels, byte(r >> 8), byte(g >> 8), byte(b >> 8))
+				}
+			}
+	}
+	bitsPerSample := make([]uint16, samplesPerPixel)
+	for i := range bitsPerSample {
+		bitsPerSample[i] = bits
+	}
+	xmp := buildXMP(s.Meta)
+	imageFields := []tiffField{
+		longField(tagImageWidth, uint32(width)),
+		longField(tagImageLength, uint32(height)),
+		shortField(tagBitsPerSample, bitsPerSample...),
+		shortField(tagCompression, 1),
+		shortField(tagPhotometricInterpretation, photometric),
+		longField(tagStripOffsets, 0),
+		shortField(tagSamplesPerPixel, samplesPerPixel),
+		longField(tagRowsPerStrip, uint32(height)),
+		longField(tagStripByteCounts, uint32(len(pixels))),
+		rationalField(tagXResolution, [2]uint32{72, 1}),
+		rationalField(tagYResolution, [2]uint32{72, 1}),
+		shortField(tagPlanarConfiguration, 1),
+		shortField(tagResolutionUnit, 2),
+		{tagXMLPacket, tiffByte, uint32(len(xmp)), []byte(xmp)},
+	}
+	return writeSnapshotFile(filename, func(w io.Writer) error {
+		_, err := w.Write(buildTIFF(s.Meta, imageFields, pixels))
+		return err
+	})
+}
+
+// Frame planes without row padding and their pixel format
+func rawFramePlanes(img image.Image) (pixelFormat string, planes [][]byte) {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	switch src := img.(type) {
+		case *image.YCbCr:
+			chromaFormats := map[image.YCbCrSubsampleRatio]struct{pixelFormat string; xShift, yShift uint}{
+				image.YCbCrSubsampleRatio420: {"yuv420p", 1, 1},
+				image.YCbCrSubsampleRatio422: {"yuv422p", 1, 0},
+				image.YCbCrSubsampleRatio440: {"yuv440p", 0, 1},
+				image.YCbCrSubsampleRatio444: {"yuv444p", 0, 0},
+			}
+			chroma, ok := chromaFormats[src.SubsampleRatio]
+			if !ok { break }
+			chromaWidth := (width + (1 << chroma.xShift) - 1) >> chroma.xShift
+			chromaHeight := (height + (1 << chroma.yShift) - 1) >> chroma.yShift
+			var y, cb, cr []byte
+			for row := 0; row < height; row++ {
+				offset := src.YOffset(bounds.Min.X, bounds.Min.Y + row)
+				y = append(y, src.Y[offset:offset + width]...)
+			}
+			for row := 0; row < chromaHeight; row++ {
+				offset := src.COffset(bounds.Min.X, bounds.Min.Y + (row << chroma.yShift))
+				cb = append(cb, src.Cb[offset:offset + chromaWidth]...)
+				cr = append(cr, src.Cr[offset:offset + chromaWidth]...)
+			}
+			return chroma.pixelFormat, [][]byte{y, cb, cr}
+		case *image.Gray:
+			var plane []byte
+			for row := bounds.Min.Y; row < bounds.Max.Y; row++ {
+				offset := src.PixOffset(bounds.Min.X, row)
+				plane = append(plane, src.Pix[offset:offset + width]...)
+			}
+			return "gray", [][]byte{plane}
+		case *image.Gray16:
+			var plane []byte
+			for row := bounds.Min.Y; row < bounds.Max.Y; row++ {
+				offset := src.PixOffset(bounds.Min.X, row)
+				plane = append(plane, src.Pix[offset:offset + 2 * width]...)
+			}
+			return "gray16be", [][]byte{plane}
+	}
+	plane := make([]byte, 0, width * height * 3)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			c := color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA)
+			plane = append(plane, c.R, c.G, c.B)
+		}
+	}
+	return "rgb24", [][]byte{plane}
+}
+
+// Frame dump as decoded from camera: magic line, JSON header line, planes
+func saveRawSnapshot(filename string, s *Snapshot) error {
+	pixelFormat, planes := rawFramePlanes(s.Image)
+	header := rawFrameHeader{
+		PixelFormat: pixelFormat,
+		Width: s.Image.Bounds().Dx(),
+		Height: s.Image.Bounds().Dy(),
+		Time: s.Meta.Time,
+		Make: s.Meta.Make,
+		Model: s.Meta.Model,
+		RotationDegree: s.Meta.RotationDegree,
+		Position: s.Meta.Position,
+	}
+	for _, plane := range planes {
+		header.PlaneSizes = append(header.PlaneSizes, len(plane))
+	}
+	if s.Meta.Thermal != nil { header.Palette = s.Meta.Thermal.Palette }
+	headerJSON, err := json.Marshal(header)
+	if err != nil { return err }
+	return writeSnapshotFile(filename, func(w io.Writer) error {
+		_, err := w.Write([]byte(rawFrameMagic + "\n" + string(headerJSON) + "\n"))
+		if err != nil { return err }
+		for _, plane := range planes {
+			_, err = w.Write(plane)
+			if err != nil { return err }
+		}
+		return nil
+	})
+}
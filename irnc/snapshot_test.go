@@ -0,0 +1,112 @@
+package irnc
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"image"
+	_ "image/jpeg"
+	_ "image/png"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+// YCbCr frame with distinct sample values
+func testYCbCrFrame() *image.YCbCr {
+	img := image.NewYCbCr(image.Rect(0, 0, 16, 8), image.YCbCrSubsampleRatio420)
+	for i := range img.Y {
+		img.Y[i] = uint8(i)
+	}
+	for i := range img.Cb {
+		img.Cb[i] = uint8(100 + i)
+		img.Cr[i] = uint8(200 - i)
+	}
+	return img
+}
+
+func TestSnapshotFormats(t *testing.T) {
+	dir := t.TempDir()
+	frame := testYCbCrFrame()
+	for format := range snapshotFormats {
+		if _, err := exec.LookPath("cwebp"); format == "webp" && err != nil {
+			t.Log("cwebp isn't installed, WebP is skipped")
+			continue
+		}
+		config := SnapshotConfig{Format: format, JPEGQuality: 80, PNGCompression: "speed"}
+		if errs := config.Verify(); len(errs) > 0 { t.Fatal(errs) }
+		snapshot := &Snapshot{Filename: filepath.Join(dir, "2021.03.01_10.00.00_n." + config.Extension()), Config: config, Image: cloneImage(frame), Meta: testImageMetadata}
+		err := snapshot.Save()
+		if err != nil { t.Fatalf("%s snapshot saving error: %v", format, err) }
+		content, err := os.ReadFile(snapshot.Filename)
+		if err != nil { t.Fatal(err) }
+		switch format {
+			case "png", "jpeg":
+				img, _, err := image.Decode(bytes.NewReader(content))
+				if err != nil || img.Bounds() != frame.Bounds() { t.Fatalf("Invalid %s snapshot (%v)", format, err) }
+			case "tiff":
+				ifd0 := readTestIFD(t, content, binary.BigEndian.Uint32(content[4:]))
+				// 8-bit frame isn't widened
+				if !bytes.Equal(ifd0[tagBitsPerSample], []byte{0, 8, 0, 8, 0, 8}) { t.Fatal("Unexpected TIFF bits per sample", ifd0[tagBitsPerSample]) }
+				if !bytes.Contains(ifd0[tagXMLPacket], []byte(`tiff:Model="CompactPRO"`)) { t.Fatal("TIFF XMP packet is missing") }
+				pixelsOffset, pixelsSize := binary.BigEndian.Uint32(ifd0[tagStripOffsets]), binary.BigEndian.Uint32(ifd0[tagStripByteCounts])
+				if pixelsSize != 16 * 8 * 3 || int(pixelsOffset + pixelsSize) != len(content) { t.Fatal("Unexpected TIFF strip", pixelsOffset, pixelsSize, len(content)) }
+				r, g, b, _ := frame.At(15, 7).RGBA()
+				if last := content[len(content) - 3:]; !bytes.Equal(last, []byte{byte(r >> 8), byte(g >> 8), byte(b >> 8)}) {
+					t.Fatal("Unexpected last TIFF pixel", last)
+				}
+			case "raw":
+				lines := bytes.SplitN(content, []byte("\n"), 3)
+				if string(lines[0]) != rawFrameMagic { t.Fatalf("Unexpected raw dump magic %q", lines[0]) }
+				var header rawFrameHeader
+				err = json.Unmarshal(lines[1], &header)
+				if err != nil { t.Fatal("Raw dump header error:", err) }
+				if header.PixelFormat != "yuv420p" || header.Width != 16 || header.Height != 8 || header.Palette != "hot" || header.Position == nil {
+					t.Fatalf("Unexpected raw dump header %+v", header)
+				}
+				expected := append(append(append([]byte(nil), frame.Y...), frame.Cb...), frame.Cr...)
+				if !bytes.Equal(lines[2], expected) { t.Fatal("Unexpected raw dump planes") }
+			case "webp":
+				if !bytes.HasPrefix(content, []byte("RIFF")) || string(content[8:12]) != "WEBP" { t.Fatal("Invalid WebP snapshot") }
+		}
+	}
+	// only final files are left
+	files, _ := filepath.Glob(filepath.Join(dir, "*"))
+	for _, file := range files {
+		if !captureFileRegexp.MatchString(filepath.Base(file)) { t.Fatal("Unexpected file left", file) }
+	}
+
+	snapshot := &Snapshot{Filename: filepath.Join(dir, "missing", "2021.03.01_10.00.00_n.png"), Config: SnapshotConfig{Format: "png", PNGCompression: "default"}, Image: frame}
+	if snapshot.Save() == nil { t.Fatal("Saving to missing folder succeeded") }
+}
+
+func TestTIFFSnapshotGray16(t *testing.T) {
+	img := image.NewGray16(image.Rect(0, 0, 4, 2))
+	for i := range img.Pix {
+		img.Pix[i] = uint8(i * 3)
+	}
+	snapshot := &Snapshot{Filename: filepath.Join(t.TempDir(), "2021.03.01_10.00.00_ir.tiff"), Config: SnapshotConfig{Format: "tiff"}, Image: img, Meta: testImageMetadata}
+	err := snapshot.Save()
+	if err != nil { t.Fatal("TIFF snapshot saving error:", err) }
+	content, err := os.ReadFile(snapshot.Filename)
+	if err != nil { t.Fatal(err) }
+	ifd0 := readTestIFD(t, content, binary.BigEndian.Uint32(content[4:]))
+	if !bytes.Equal(ifd0[tagBitsPerSample], []byte{0, 16}) || !bytes.Equal(ifd0[tagPhotometricInterpretation], []byte{0, 1}) {
+		t.Fatal("16-bit grayscale TIFF expected, got", ifd0[tagBitsPerSample], ifd0[tagPhotometricInterpretation])
+	}
+	// samples are big-endian just like Gray16 pixels
+	if !bytes.Equal(content[len(content) - len(img.Pix):], img.Pix) { t.Fatal("Unexpected TIFF samples", content[len(content) - len(img.Pix):]) }
+}
+
+func TestCloneImage(t *testing.T) {
+	frame := testYCbCrFrame()
+	clone := cloneImage(frame).(*image.YCbCr)
+	frame.Y[0], frame.Cb[0], frame.Cr[0] = 255, 255, 255
+	if clone.Y[0] != 0 || clone.Cb[0] != 100 || clone.Cr[0] != 200 || clone.Rect != frame.Rect { t.Fatal("Clone shares memory with frame") }
+}
+
+func TestSnapshotConfigVerify(t *testing.T) {
+	errs := SnapshotConfig{Format: "gif", JPEGQuality: 0, PNGCompression: "fast"}.Verify()
+	if len(errs) != 3 { t.Fatal("Three errors expected, got", errs) }
+}
@@ -0,0 +1,265 @@
+package irnc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Format of per-day capture folder names (same date format as capture prefixes)
+const dayFolderFormat = "2006.01.02"
+// Subdirectory of capture root for application logs
+const logDirName = "logs"
+
+// Get directory containing captures (and their per-day folders)
+func CaptureRoot() string {
+	return getAppConfig().Storage.Root
+}
+
+// Get directory of capture set files
+func (set CaptureSet) Directory(root string) string {
+	return filepath.Join(root, set.Dir)
+}
+
+// Get capture folder (relative to capture root) for capture started at given time
+func captureDirFor(config StorageConfig, t time.Time) string {
+	if !config.PerDayFolders { return "" }
+	return t.Format(dayFolderFormat)
+}
+
+// Refuse capture needing given amount of bytes when free space would drop below minimum, warn when it's low
+func checkFreeSpace(config StorageConfig, requiredBytes uint64) error {
+	freeBytes, err := freeSpaceBytes(config.Root)
+	if err != nil {
+		// unknown free space shouldn't prevent captures
+		log.Println("Free space retrieval error:", err)
+		return nil
+	}
+	if freeBytes < config.MinFreeBytes + requiredBytes {
+		err = errors.New(fmt.Sprintf("Not enough free space: %d MB left, %d MB required", freeBytes >> 20, (config.MinFreeBytes + requiredBytes) >> 20))
+		PublishEvent(Event{Type: EventStorageLow, Errors: []string{err.Error()}})
+		return err
+	}
+	if freeBytes < config.WarnFreeBytes + requiredBytes {
+		log.Printf("Free space is low: %d MB left", freeBytes >> 20)
+		PublishEvent(Event{Type: EventStorageLow})
+	}
+	return nil
+}
+
+// Check free space and create folder for capture started at given time, return folder relative to capture root
+func prepareCaptureDir(t time.Time, requiredBytes uint64) (string, error) {
+	config := getAppConfig().Storage
+	dir := captureDirFor(config, t)
+	err := os.MkdirAll(filepath.Join(config.Root, dir), 0755)
+	if err != nil { return "", errors.New(fmt.Sprintf("Capture directory creation error: %v", err)) }
+	err = checkFreeSpace(config, requiredBytes)
+	if err != nil { return "", err }
+	return dir, nil
+}
+
+// Open log file in logs folder of capture root
+func openLogFile(config StorageConfig) (*os.File, error) {
+	dir := filepath.Join(config.Root, logDirName)
+	err := os.MkdirAll(dir, 0755)
+	if err != nil { return nil, err }
+	return os.OpenFile(filepath.Join(dir, fmt.Sprintf("%s.log", nowAsString())), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0666)
+}
+
+// Move capture sets saved to working directory before capture root was introduced into capture root folders
+func migrateLegacyCaptures(srcDir string, config StorageConfig) {
+	srcAbs, err := filepath.Abs(srcDir)
+	if err != nil { return }
+	rootAbs, err := filepath.Abs(config.Root)
+	if err != nil || rootAbs == srcAbs { return }
+	sets, err := ListCaptureSets(srcDir)
+	if err != nil {
+		log.Println("Legacy captures listing error:", err)
+		return
+	}
+	for _, set := range sets {
+		// nested sets belong to other folders (capture root itself among them)
+		if set.Dir != "" { continue }
+		t, err := time.ParseInLocation(timestampFormat, set.Prefix, time.Local)
+		if err != nil { continue }
+		dir := captureDirFor(config, t)
+		err = os.MkdirAll(filepath.Join(config.Root, dir), 0755)
+		names := set.Files
+		if _, statErr := os.Stat(filepath.Join(srcDir, CaptureMetaFileName(set.Prefix))); statErr == nil {
+			names = append(names, CaptureMetaFileName(set.Prefix))
+		}
+		for _, name := range names {
+			if err != nil { break }
+			dst := filepath.Join(config.Root, dir, name)
+			if _, statErr := os.Stat(dst); statErr == nil {
+				err = errors.New(fmt.Sprintf("%s already exists", dst))
+				break
+			}
+			err = os.Rename(filepath.Join(srcDir, name), dst)
+		}
+		if err != nil {
+			log.Printf("Legacy capture set %s moving error: %v", set.Prefix, err)
+			continue
+		}
+		log.Printf("Legacy capture set %s moved to %s", set.Prefix, filepath.Join(config.Root, dir))
+	}
+}
+
+// Use counts of capture sets read by exports and HLS conversions, by "<dir>/<prefix>"
+var captureSetsInUse = make(map[string]int)
+var captureSetsInUseMtx sync.Mutex
+
+// Mark capture set as used, so retention keeps it until returned function is called
+func useCaptureSet(dir, prefix string) func() {
+	key := filepath.Join(dir, prefix)
+	captureSetsInUseMtx.Lock()
+	captureSetsInUse[key]++
+	captureSetsInUseMtx.Unlock()
+	return func() {
+		captureSetsInUseMtx.Lock()
+		defer captureSetsInUseMtx.Unlock()
+		captureSetsInUse[key]--
+		if captureSetsInUse[key] <= 0 { delete(captureSetsInUse, key) }
+	}
+}
+
+// Check whether capture set is used or waits for upload
+func isCaptureSetInUse(dir, prefix string) bool {
+	captureSetsInUseMtx.Lock()
+	used := captureSetsInUse[filepath.Join(dir, prefix)] > 0
+	captureSetsInUseMtx.Unlock()
+	if used { return true }
+	s := getS3Sync()
+	return s != nil && s.isQueued(dir, prefix)
+}
+
+// Capture set with information needed by retention policy
+type storedCaptureSet struct {
+	set CaptureSet
+	sizeBytes int64
+	// latest modification of set files
+	modTime time.Time
+	starred bool
+	// exported, converted or waiting for upload
+	inUse bool
+}
+
+// Collect sizes (VOD playlists included), times and stars of capture sets (newest first)
+func statCaptureSets(root string) ([]storedCaptureSet, error) {
+	sets, err := ListCaptureSets(root)
+	if err != nil { return nil, err }
+	hlsDir := configuredHLSDir()
+	var res []storedCaptureSet
+	for _, set := range sets {
+		stored := storedCaptureSet{set: set}
+		for _, name := range set.Files {
+			fileInfo, err := os.Stat(filepath.Join(set.Directory(root), name))
+			if err != nil { continue }
+			stored.sizeBytes += fileInfo.Size()
+			if fileInfo.ModTime().After(stored.modTime) {
+				stored.modTime = fileInfo.ModTime()
+			}
+		}
+		for _, name := range hlsFilesOf(hlsDir, set.Prefix) {
+			fileInfo, err := os.Stat(name)
+			if err == nil { stored.sizeBytes += fileInfo.Size() }
+		}
+		meta, err := LoadCaptureMeta(set.Directory(root), set.Prefix)
+		if err != nil {
+			// set with unreadable metadata may be starred
+			log.Println("Capture metadata loading error:", err)
+			stored.starred = true
+		}
+		stored.starred = stored.starred || meta.Starred
+		stored.inUse = isCaptureSetInUse(set.Dir, set.Prefix)
+		res = append(res, stored)
+	}
+	return res, nil
+}
+
+// Select sets to delete: older than max age, then oldest ones while total size exceeds max; starred sets and ones in use are kept
+func selectExpiredCaptureSets(sets []storedCaptureSet, config StorageConfig, now time.Time) (res []storedCaptureSet) {
+	sorted := append([]storedCaptureSet(nil), sets...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].modTime.Before(sorted[j].modTime) })
+	var totalBytes uint64
+	for _, stored := range sorted {
+		totalBytes += uint64(stored.sizeBytes)
+	}
+	for _, stored := range sorted {
+		if stored.starred || stored.inUse { continue }
+		expired := config.MaxAge > 0 && now.Sub(stored.modTime) > config.MaxAge
+		oversized := config.MaxTotalBytes > 0 && totalBytes > config.MaxTotalBytes
+		if !expired && !oversized { continue }
+		res = append(res, stored)
+		totalBytes -= uint64(stored.sizeBytes)
+	}
+	return
+}
+
+// Delete expired capture sets and logs, remove emptied day folders
+func applyRetention(config StorageConfig) {
+	sets, err := statCaptureSets(config.Root)
+	if err != nil {
+		log.Println("Retention listing error:", err)
+		return
+	}
+	for _, stored := range selectExpiredCaptureSets(sets, config, time.Now()) {
+		err := DeleteCaptureSet(config.Root, stored.set)
+		if err != nil {
+			log.Println("Retention error:", err)
+			continue
+		}
+		log.Printf("Capture set %s deleted by retention policy", stored.set.Prefix)
+	}
+	if config.MaxAge <= 0 { return }
+	logs, _ := filepath.Glob(filepath.Join(config.Root, logDirName, "*.log"))
+	for _, name := range logs {
+		fileInfo, err := os.Stat(name)
+		// current log is being written to, so it's never expired
+		if err != nil || time.Since(fileInfo.ModTime()) <= config.MaxAge { continue }
+		err = os.Remove(name)
+		if err != nil { log.Println("Log retention error:", err) }
+	}
+}
+
+var retentionCancel context.CancelFunc
+var retentionDone chan struct{}
+
+// Apply retention policy now and periodically in background (if any limit is set)
+func startRetention(config StorageConfig) {
+	if config.MaxAge <= 0 && config.MaxTotalBytes == 0 { return }
+	if config.RetentionInterval <= 0 {
+		log.Println("Retention interval must be positive, retention is disabled")
+		return
+	}
+	var ctx context.Context
+	ctx, retentionCancel = context.WithCancel(context.Background())
+	retentionDone = make(chan struct{})
+	go func() {
+		defer close(retentionDone)
+		ticker := time.NewTicker(config.RetentionInterval)
+		defer ticker.Stop()
+		for {
+			applyRetention(config)
+			select {
+				case <-ctx.Done():
+					return
+				case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Stop periodic retention
+func stopRetention() {
+	if retentionCancel == nil { return }
+	retentionCancel()
+	<-retentionDone
+	retentionCancel = nil
+}
@@ -0,0 +1,182 @@
+package irnc
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// Get prefixes of stored sets in order
+func storedPrefixes(sets []storedCaptureSet) (res []string) {
+	for _, stored := range sets {
+		res = append(res, stored.set.Prefix)
+	}
+	return
+}
+
+func TestSelectExpiredCaptureSets(t *testing.T) {
+	now := time.Date(2021, 3, 10, 12, 0, 0, 0, time.UTC)
+	stored := func(prefix string, age time.Duration, sizeBytes int64, starred bool) storedCaptureSet {
+		return storedCaptureSet{set: CaptureSet{Prefix: prefix}, sizeBytes: sizeBytes, modTime: now.Add(-age), starred: starred}
+	}
+	sets := []storedCaptureSet{
+		stored("new", time.Hour, 300, false),
+		stored("old_starred", 72 * time.Hour, 300, true),
+		stored("old", 48 * time.Hour, 200, false),
+		stored("oldest", 96 * time.Hour, 100, false),
+	}
+	tests := []struct {
+		name string
+		config StorageConfig
+		expected []string
+	}{
+		{"no limits", StorageConfig{}, nil},
+		{"age", StorageConfig{MaxAge: 24 * time.Hour}, []string{"oldest", "old"}},
+		{"age keeps everything fresh", StorageConfig{MaxAge: 100 * time.Hour}, nil},
+		// starred set counts to total, but next oldest is deleted instead
+		{"size", StorageConfig{MaxTotalBytes: 700}, []string{"oldest", "old"}},
+		{"size within limit", StorageConfig{MaxTotalBytes: 900}, nil},
+		{"size can't be reached without starred", StorageConfig{MaxTotalBytes: 100}, []string{"oldest", "old", "new"}},
+		{"age then size", StorageConfig{MaxAge: 90 * time.Hour, MaxTotalBytes: 700}, []string{"oldest", "old"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			found := storedPrefixes(selectExpiredCaptureSets(sets, test.config, now))
+			if len(found) != len(test.expected) { t.Fatalf("%v expected, got %v", test.expected, found) }
+			for i := range found {
+				if found[i] != test.expected[i] { t.Fatalf("%v expected, got %v", test.expected, found) }
+			}
+		})
+	}
+}
+
+func TestStatCaptureSets(t *testing.T) {
+	root := t.TempDir()
+	writeTestCaptures(t, root, map[string]string{
+		"2021.03.01/2021.03.01_10.00.00_n.png": "n photo",
+		"2021.03.01/2021.03.01_10.00.00_ir.png": "ir photo",
+		"2021.03.01/2021.03.01_10.00.00_meta.json": `{"starred":true}`,
+		"2021.03.02/2021.03.02_10.00.00_n.png": "n photo",
+		"2021.03.02/2021.03.02_10.00.00_meta.json": `{"starred":`,
+		"2021.03.03/2021.03.03_10.00.00_n.png": "n photo",
+	})
+	sets, err := statCaptureSets(root)
+	if err != nil { t.Fatal("Capture sets stat error:", err) }
+	starred := make(map[string]bool)
+	for _, stored := range sets {
+		starred[stored.set.Prefix] = stored.starred
+	}
+	// unreadable sidecar may hide star, so such set is kept
+	expected := map[string]bool{"2021.03.01_10.00.00": true, "2021.03.02_10.00.00": true, "2021.03.03_10.00.00": false}
+	if len(starred) != len(expected) { t.Fatalf("Stars %v expected, got %v", expected, starred) }
+	for prefix := range expected {
+		if starred[prefix] != expected[prefix] { t.Fatalf("Stars %v expected, got %v", expected, starred) }
+	}
+	if sets[0].set.Prefix != "2021.03.03_10.00.00" || sets[2].sizeBytes != int64(len("n photo") + len("ir photo")) {
+		t.Fatalf("Unexpected sets %+v", sets)
+	}
+}
+
+func TestApplyRetention(t *testing.T) {
+	root := t.TempDir()
+	writeTestCaptures(t, root, map[string]string{
+		"2021.03.01/2021.03.01_10.00.00_n.png": "n photo",
+		"2021.03.01/2021.03.01_10.00.00_meta.json": `{"starred":true}`,
+		"2021.03.02/2021.03.02_10.00.00_n.png": "n photo",
+		"2021.03.02/2021.03.02_10.00.00_ir.png": "ir photo",
+		"2021.03.02/2021.03.02_11.00.00_n.png": "n photo",
+		"logs/2021.03.01_09.00.00.log": "old log",
+		"logs/2021.03.02_09.00.00.log": "current log",
+	})
+	old := time.Now().Add(-48 * time.Hour)
+	for _, name := range []string{"2021.03.01/2021.03.01_10.00.00_n.png", "2021.03.01/2021.03.01_10.00.00_meta.json", "2021.03.02/2021.03.02_10.00.00_n.png", "2021.03.02/2021.03.02_10.00.00_ir.png", "logs/2021.03.01_09.00.00.log"} {
+		err := os.Chtimes(filepath.Join(root, name), old, old)
+		if err != nil { t.Fatal(err) }
+	}
+	applyRetention(StorageConfig{Root: root, MaxAge: 24 * time.Hour})
+	for name, kept := range map[string]bool{
+		"2021.03.01/2021.03.01_10.00.00_n.png": true,
+		"2021.03.02/2021.03.02_10.00.00_n.png": false,
+		"2021.03.02/2021.03.02_10.00.00_ir.png": false,
+		"2021.03.02/2021.03.02_11.00.00_n.png": true,
+		"logs/2021.03.01_09.00.00.log": false,
+		"logs/2021.03.02_09.00.00.log": true,
+	} {
+		_, err := os.Stat(filepath.Join(root, name))
+		if kept && err != nil { t.Error("Kept file is missing:", err) }
+		if !kept && !os.IsNotExist(err) { t.Error("Expired file is not deleted:", name) }
+	}
+
+	// oldest unstarred set goes when total size is exceeded
+	applyRetention(StorageConfig{Root: root, MaxTotalBytes: 1})
+	if _, err := os.Stat(filepath.Join(root, "2021.03.02")); !os.IsNotExist(err) { t.Error("Emptied day folder is not removed:", err) }
+	if _, err := os.Stat(filepath.Join(root, "2021.03.01/2021.03.01_10.00.00_n.png")); err != nil { t.Error("Starred set is deleted:", err) }
+}
+
+func TestMigrateLegacyCaptures(t *testing.T) {
+	workDir := t.TempDir()
+	writeTestCaptures(t, workDir, map[string]string{
+		"2021.03.01_10.00.00_n.png": "n photo",
+		"2021.03.01_10.00.00_ir.png": "ir photo",
+		"2021.03.01_10.00.00_meta.json": `{"starred":true}`,
+		"2021.03.02_11.00.00_n.h264": "n video",
+		"notes_n.txt": "not a capture",
+		"captures/2021.03.03/2021.03.03_12.00.00_n.png": "n photo",
+	})
+	config := StorageConfig{Root: filepath.Join(workDir, "captures"), PerDayFolders: true}
+	migrateLegacyCaptures(workDir, config)
+	for _, name := range []string{
+		"captures/2021.03.01/2021.03.01_10.00.00_n.png",
+		"captures/2021.03.01/2021.03.01_10.00.00_ir.png",
+		"captures/2021.03.01/2021.03.01_10.00.00_meta.json",
+		"captures/2021.03.02/2021.03.02_11.00.00_n.h264",
+		"captures/2021.03.03/2021.03.03_12.00.00_n.png",
+		"notes_n.txt",
+	} {
+		if _, err := os.Stat(filepath.Join(workDir, name)); err != nil { t.Error("File is missing after migration:", err) }
+	}
+	left, _ := filepath.Glob(filepath.Join(workDir, "2021.*"))
+	if len(left) > 0 { t.Fatal("Captures left in working directory:", left) }
+	meta, err := LoadCaptureMeta(filepath.Join(config.Root, "2021.03.01"), "2021.03.01_10.00.00")
+	if err != nil || !meta.Starred { t.Fatal("Sidecar isn't moved with its set:", meta, err) }
+}
+
+func TestRetentionKeepsSetsInUse(t *testing.T) {
+	root := t.TempDir()
+	writeTestCaptures(t, root, map[string]string{
+		"2021.03.01/2021.03.01_10.00.00_n.png": "exported",
+		"2021.03.01/2021.03.01_11.00.00_n.png": "queued for upload",
+		"2021.03.01/2021.03.01_12.00.00_n.png": "expired",
+	})
+	old := time.Now().Add(-48 * time.Hour)
+	for _, prefix := range []string{"2021.03.01_10.00.00", "2021.03.01_11.00.00", "2021.03.01_12.00.00"} {
+		err := os.Chtimes(filepath.Join(root, "2021.03.01", prefix + "_n.png"), old, old)
+		if err != nil { t.Fatal(err) }
+	}
+	endUse := useCaptureSet("2021.03.01", "2021.03.01_10.00.00")
+	defer endUse()
+	s3Config := GetHardcodedConfig().S3
+	s3Config.QueueFile = filepath.Join(t.TempDir(), "s3_queue.json")
+	s := newS3Sync(s3Config, root, nil)
+	s.enqueue("2021.03.01", "2021.03.01_11.00.00")
+	activeS3SyncMtx.Lock()
+	activeS3Sync = s
+	activeS3SyncMtx.Unlock()
+	defer func() {
+		activeS3SyncMtx.Lock()
+		activeS3Sync = nil
+		activeS3SyncMtx.Unlock()
+	}()
+
+	applyRetention(StorageConfig{Root: root, MaxAge: 24 * time.Hour})
+	for prefix, kept := range map[string]bool{"2021.03.01_10.00.00": true, "2021.03.01_11.00.00": true, "2021.03.01_12.00.00": false} {
+		_, err := os.Stat(filepath.Join(root, "2021.03.01", prefix + "_n.png"))
+		if kept && err != nil { t.Error("Capture set in use is deleted:", prefix) }
+		if !kept && !os.IsNotExist(err) { t.Error("Expired set is not deleted:", prefix) }
+	}
+	// released set goes on next run
+	endUse()
+	applyRetention(StorageConfig{Root: root, MaxAge: 24 * time.Hour})
+	if _, err := os.Stat(filepath.Join(root, "2021.03.01", "2021.03.01_10.00.00_n.png")); !os.IsNotExist(err) { t.Error("Released set is not deleted") }
+}
@@ -0,0 +1,156 @@
+package irnc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+type CameraState string
+
+const (
+	CameraStarting CameraState = "starting"
+	// frames are flowing
+	CameraRunning CameraState = "running"
+	// started but frames stalled, restart follows if they don't resume
+	CameraDegraded CameraState = "degraded"
+	// start failed or camera stopped providing frames, restart follows after backoff
+	CameraFailed CameraState = "failed"
+	CameraStopped CameraState = "stopped"
+)
+
+type CameraStatus struct {
+	State CameraState `json:"state"`
+	LastError string `json:"last_error,omitempty"`
+	Restarts uint `json:"restarts"`
+	Since time.Time `json:"since"`
+	FPS float64 `json:"fps"`
+	LastFrame time.Time `json:"last_frame"`
+}
+
+// Keeps camera running: restarts it with exponential backoff on start failures and frame stalls
+type CameraSupervisor struct {
+	cam Camera
+	config SupervisorConfig
+	status CameraStatus
+	statusMtx sync.Mutex
+	done chan struct{}
+}
+
+func NewCameraSupervisor(cam Camera, config SupervisorConfig) *CameraSupervisor {
+	return &CameraSupervisor{
+		cam: cam,
+		config: config,
+		status: CameraStatus{State: CameraStopped, Since: time.Now()},
+		done: make(chan struct{}),
+	}
+}
+
+// Get current camera status
+func (s *CameraSupervisor) Status() CameraStatus {
+	s.statusMtx.Lock()
+	status := s.status
+	s.statusMtx.Unlock()
+	status.FPS = s.cam.FPS()
+	status.LastFrame = s.cam.LastFrameTime()
+	return status
+}
+
+// Update status and notify subscribers on state change
+func (s *CameraSupervisor) setState(state CameraState, err error) {
+	s.statusMtx.Lock()
+	changed := s.status.State != state
+	if changed {
+		s.status.State = state
+		s.status.Since = time.Now()
+	}
+	if err != nil {
+		s.status.LastError = err.Error()
+	}
+	s.statusMtx.Unlock()
+	if !changed { return }
+	log.Printf("%s state: %s", s.cam.Name(), state)
+	event := Event{Type: EventCameraStateChanged, Camera: s.cam.Name(), State: string(state)}
+	if err != nil {
+		event.Errors = []string{err.Error()}
+	}
+	PublishEvent(event)
+	if state == CameraFailed {
+		event.Type = EventCameraFailed
+		PublishEvent(event)
+	}
+}
+
+// Track frame flow until context is done (nil result) or frames stall for too long
+func (s *CameraSupervisor) watch(ctx context.Context, started time.Time) error {
+	ticker := time.NewTicker(s.config.CheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+			case <-ctx.Done():
+				return nil
+			case <-ticker.C:
+		}
+		lastFrameTime := s.cam.LastFrameTime()
+		if lastFrameTime.Before(started) {
+			lastFrameTime = started
+		}
+		frameAge := time.Since(lastFrameTime)
+		switch {
+			case frameAge > s.config.StallRestartTimeout:
+				return errors.New(fmt.Sprintf("No frames for %v", frameAge.Round(time.Second)))
+			case frameAge > s.config.StallTimeout:
+				s.setState(CameraDegraded, nil)
+			default:
+				s.setState(CameraRunning, nil)
+		}
+	}
+}
+
+// Run camera until context is done, camera resources are released on return
+func (s *CameraSupervisor) Run(ctx context.Context) {
+	defer close(s.done)
+	backoff := s.config.MinBackoff
+	for {
+		s.setState(CameraStarting, nil)
+		runCtx, cancel := context.WithCancel(ctx)
+		started := time.Now()
+		err := s.cam.Start(runCtx)
+		if err == nil {
+			err = s.watch(runCtx, started)
+			if time.Since(started) > s.config.MaxBackoff {
+				// camera was fine for a while, so failure is not a persistent one
+				backoff = s.config.MinBackoff
+			}
+		}
+		cancel()
+		s.cam.Wait()
+		if ctx.Err() != nil {
+			s.setState(CameraStopped, nil)
+			return
+		}
+		s.setState(CameraFailed, err)
+		log.Printf("%s failure: %v, restart in %v", s.cam.Name(), err, backoff)
+		select {
+			case <-ctx.Done():
+				s.setState(CameraStopped, nil)
+				return
+			case <-time.After(backoff):
+		}
+		backoff *= 2
+		if backoff > s.config.MaxBackoff {
+			backoff = s.config.MaxBackoff
+		}
+		s.statusMtx.Lock()
+		s.status.Restarts++
+		s.statusMtx.Unlock()
+	}
+}
+
+// Wait until supervised camera is stopped and released
+func (s *CameraSupervisor) Wait() {
+	<-s.done
+}
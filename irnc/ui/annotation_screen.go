@@ -0,0 +1,182 @@
+package ui
+
+import (
+	"context"
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/canvas"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
+	"image/color"
+	"irnc"
+	"log"
+	"strings"
+	"sync"
+)
+
+var tagButtonSize = fyne.NewSize(140, 56)
+
+// Screen labeling capture set with preconfigured tags (large toggle buttons) and note typed on on-screen keyboard
+type annotationScreen struct {
+	nav *screenNavigator
+	set irnc.CaptureSet
+	selected map[string]bool
+	// tags of set which aren't offered, kept as is
+	extraTags []string
+	stateMtx sync.Mutex
+	offeredTags []string
+	tagButtons map[string]*widget.Button
+	notes *widget.Entry
+	title *canvas.Text
+	// shows either tags or keyboard
+	body *fyne.Container
+	tagsContent, keyboardContent fyne.CanvasObject
+	onClose func()
+	Content fyne.CanvasObject
+}
+
+// Factory function for annotationScreen
+func newAnnotationScreen(nav *screenNavigator, buttonSize, buttonPaddingSize float32) *annotationScreen {
+	s := &annotationScreen{
+		nav: nav,
+		offeredTags: irnc.GetAnnotationConfig().Tags,
+		tagButtons: make(map[string]*widget.Button),
+		notes: widget.NewEntry(),
+		title: canvas.NewText("", color.White),
+	}
+	s.title.TextStyle = fyne.TextStyle{Bold: true}
+	s.notes.SetPlaceHolder("Note")
+	var tagCells []fyne.CanvasObject
+	for _, tag := range s.offeredTags {
+		tag := tag
+		button := widget.NewButton(tag, func() { s.toggleTag(tag) })
+		s.tagButtons[tag] = button
+		tagCells = append(tagCells, button)
+	}
+	s.tagsContent = container.NewVScroll(container.NewGridWrap(tagButtonSize, tagCells...))
+	s.keyboardContent = newOnScreenKeyboard(s.notes).Content
+	s.body = container.NewMax(s.tagsContent)
+
+	skipButton := NewSquareIconStickyButton(buttonSize, buttonPaddingSize, theme.NavigateBackIcon(), func(wg *sync.WaitGroup) {
+		s.close()
+		wg.Done()
+	})
+	keyboardButton := NewSquareIconStickyButton(buttonSize, buttonPaddingSize, theme.DocumentCreateIcon(), func(wg *sync.WaitGroup) {
+		s.toggleKeyboard()
+		wg.Done()
+	})
+	saveButton := NewSquareIconStickyButton(buttonSize, buttonPaddingSize, theme.ConfirmIcon(), func(wg *sync.WaitGroup) {
+		s.save()
+		wg.Done()
+	})
+	s.Content = container.NewBorder(
+		container.NewVBox(
+			container.NewBorder(nil, nil, skipButton, container.NewHBox(keyboardButton, saveButton), container.NewCenter(s.title)),
+			s.notes,
+		),
+		nil, nil, nil,
+		s.body,
+	)
+	return s
+}
+
+// Show screen with current annotation of capture set, call back when it's saved or skipped
+func (s *annotationScreen) Open(set irnc.CaptureSet, onClose func()) {
+	meta, err := irnc.LoadCaptureMeta(set.Directory(irnc.CaptureRoot()), set.Prefix)
+	if err != nil { log.Println("Capture metadata loading error:", err) }
+	s.stateMtx.Lock()
+	s.set = set
+	s.onClose = onClose
+	s.selected = make(map[string]bool)
+	s.extraTags = nil
+	for _, tag := range meta.Tags {
+		if _, offered := s.tagButtons[tag]; offered {
+			s.selected[tag] = true
+		} else {
+			s.extraTags = append(s.extraTags, tag)
+		}
+	}
+	s.stateMtx.Unlock()
+	for _, tag := range s.offeredTags {
+		s.updateTagButton(tag)
+	}
+	s.notes.SetText(meta.Notes)
+	s.title.Text = set.Prefix
+	s.title.Refresh()
+	s.body.Objects = []fyne.CanvasObject{s.tagsContent}
+	s.body.Refresh()
+	s.nav.Show(s.Content)
+}
+
+// Select or deselect tag
+func (s *annotationScreen) toggleTag(tag string) {
+	irnc.NotifyUserActivity()
+	s.stateMtx.Lock()
+	s.selected[tag] = !s.selected[tag]
+	s.stateMtx.Unlock()
+	s.updateTagButton(tag)
+}
+
+// Highlight selected tag
+func (s *annotationScreen) updateTagButton(tag string) {
+	s.stateMtx.Lock()
+	selected := s.selected[tag]
+	s.stateMtx.Unlock()
+	button := s.tagButtons[tag]
+	if selected {
+		button.Importance = widget.HighImportance
+	} else {
+		button.Importance = widget.MediumImportance
+	}
+	button.Refresh()
+}
+
+// Switch between tags and on-screen keyboard
+func (s *annotationScreen) toggleKeyboard() {
+	if s.body.Objects[0] == s.keyboardContent {
+		s.body.Objects = []fyne.CanvasObject{s.tagsContent}
+	} else {
+		s.body.Objects = []fyne.CanvasObject{s.keyboardContent}
+	}
+	s.body.Refresh()
+}
+
+// Save selected tags (in offered order) and note to capture set
+func (s *annotationScreen) save() {
+	s.stateMtx.Lock()
+	set := s.set
+	var tags []string
+	for _, tag := range s.offeredTags {
+		if s.selected[tag] { tags = append(tags, tag) }
+	}
+	tags = append(tags, s.extraTags...)
+	s.stateMtx.Unlock()
+	err := irnc.SetCaptureAnnotation(irnc.CaptureRoot(), set, tags, strings.TrimSpace(s.notes.Text))
+	if err != nil {
+		log.Println("Capture annotation error:", err)
+		s.title.Text = "Saving failed"
+		s.title.Refresh()
+		return
+	}
+	s.close()
+}
+
+// Leave screen (physical keyboard goes back to shortcuts)
+func (s *annotationScreen) close() {
+	s.nav.window.Canvas().Unfocus()
+	s.stateMtx.Lock()
+	onClose := s.onClose
+	s.stateMtx.Unlock()
+	onClose()
+}
+
+// Offer annotation of every successful single capture made while live preview is shown
+func promptAnnotations(ctx context.Context, nav *screenNavigator, s *annotationScreen) {
+	if !irnc.GetAnnotationConfig().PromptAfterCapture { return }
+	for event := range irnc.SubscribeEvents(ctx) {
+		if event.Type != irnc.EventSnapshotTaken && event.Type != irnc.EventRecordingStopped { continue }
+		// frames of timelapse or burst would prompt one after another
+		if len(event.Errors) > 0 || event.Sequence != "" || !nav.IsMainShown() { continue }
+		s.Open(irnc.CaptureSet{Prefix: event.Prefix, Dir: event.Dir}, nav.ShowMain)
+	}
+}
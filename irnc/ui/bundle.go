@@ -1,7 +1,7 @@
 // auto-generated
 // Code generated by '$ fyne bundle'. DO NOT EDIT.
 
-package irnc
+package ui
 
 import "fyne.io/fyne/v2"
 
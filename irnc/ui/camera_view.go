@@ -0,0 +1,175 @@
+package ui
+
+import (
+	"fmt"
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/canvas"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/layout"
+	"image/color"
+	"irnc"
+	"strings"
+	"time"
+)
+
+var liveColor = color.NRGBA{0, 160, 0, 200}
+var reconnectingColor = color.NRGBA{200, 140, 0, 200}
+var failedColor = color.NRGBA{200, 0, 0, 200}
+
+// Camera preview with status badge and "NO SIGNAL" placeholder instead of frozen image
+type CameraView struct {
+	Image *UpdateableImage
+	Content *fyne.Container
+	badge *fyne.Container
+	badgeText *canvas.Text
+	badgeBackground *canvas.Rectangle
+	noSignal *fyne.Container
+	recording *fyne.Container
+	recordingDot *canvas.Circle
+	recordingText *canvas.Text
+	sequence *fyne.Container
+	sequenceText *canvas.Text
+	gps *fyne.Container
+	gpsText *canvas.Text
+	gpsBackground *canvas.Rectangle
+}
+
+const recordingDotBlinkPeriod = time.Second
+
+// Format duration as minutes:seconds
+func formatMinSec(seconds float64) string {
+	total := int(seconds)
+	return fmt.Sprintf("%02d:%02d", total / 60, total % 60)
+}
+
+// Factory function for CameraView
+func NewCameraView(minSize fyne.Size) *CameraView {
+	v := &CameraView{
+		Image: NewUpdateableImage(minSize),
+		badgeText: canvas.NewText("", color.White),
+		badgeBackground: canvas.NewRectangle(failedColor),
+	}
+	v.badgeText.TextStyle = fyne.TextStyle{Bold: true}
+	noSignalText := canvas.NewText("NO SIGNAL", color.White)
+	noSignalText.TextSize = 24
+	noSignalText.TextStyle = fyne.TextStyle{Bold: true}
+	v.noSignal = container.NewMax(canvas.NewRectangle(color.Black), container.NewCenter(noSignalText))
+	v.badge = container.NewMax(v.badgeBackground, container.NewPadded(v.badgeText))
+	v.recordingDot = canvas.NewCircle(failedColor)
+	v.recordingText = canvas.NewText("", color.White)
+	v.recordingText.TextStyle = fyne.TextStyle{Bold: true}
+	dot := container.New(layout.NewGridWrapLayout(fyne.NewSize(12, 12)), v.recordingDot)
+	v.recording = container.NewMax(
+		canvas.NewRectangle(color.NRGBA{0, 0, 0, 160}),
+		container.NewPadded(container.NewHBox(container.NewCenter(dot), v.recordingText)),
+	)
+	v.recording.Hide()
+	v.sequenceText = canvas.NewText("", color.White)
+	v.sequenceText.TextStyle = fyne.TextStyle{Bold: true}
+	v.sequence = container.NewMax(canvas.NewRectangle(color.NRGBA{0, 0, 0, 160}), container.NewPadded(v.sequenceText))
+	v.sequence.Hide()
+	v.gpsText = canvas.NewText("", color.White)
+	v.gpsText.TextStyle = fyne.TextStyle{Bold: true}
+	v.gpsBackground = canvas.NewRectangle(failedColor)
+	v.gps = container.NewMax(v.gpsBackground, container.NewPadded(v.gpsText))
+	v.gps.Hide()
+	v.Content = container.NewMax(
+		v.Image,
+		v.noSignal,
+		container.NewVBox(container.NewHBox(v.badge, layout.NewSpacer(), v.gps), layout.NewSpacer(), container.NewHBox(v.recording, layout.NewSpacer(), v.sequence)),
+	)
+	return v
+}
+
+// Show camera state, fps and last frame age; hide preview if camera is not live
+func (v *CameraView) UpdateStatus(status irnc.CameraStatus) {
+	var text string
+	var badgeColor color.Color
+	switch status.State {
+		case irnc.CameraRunning:
+			text = "LIVE"
+			badgeColor = liveColor
+		case irnc.CameraStarting, irnc.CameraDegraded:
+			text = "RECONNECTING"
+			badgeColor = reconnectingColor
+		default:
+			text = "FAILED"
+			badgeColor = failedColor
+	}
+	if !status.LastFrame.IsZero() {
+		text = fmt.Sprintf("%s %.1f fps %.1fs", text, status.FPS, time.Since(status.LastFrame).Seconds())
+	}
+	v.badgeText.Text = text
+	v.badgeBackground.FillColor = badgeColor
+	// text width changes, so badge needs relayout
+	v.badge.Refresh()
+	if status.State == irnc.CameraRunning {
+		v.noSignal.Hide()
+	} else {
+		v.noSignal.Show()
+	}
+}
+
+// Show blinking REC indicator with elapsed/remaining time, file size and space left estimate during recording
+func (v *CameraView) UpdateRecording(status irnc.RecordingStatus, cameraName string) {
+	camStatus, ok := status.Cameras[cameraName]
+	if !status.Active || !ok || camStatus.Finished {
+		if v.recording.Visible() { v.recording.Hide() }
+		return
+	}
+	v.recordingText.Text = fmt.Sprintf("REC %s -%s %.1f MB ~%.0f min left",
+		formatMinSec(camStatus.ElapsedSec), formatMinSec(camStatus.RemainingSec),
+		float64(camStatus.SizeBytes) / (1 << 20), status.SpaceLeftMinutes)
+	if time.Now().UnixNano() / int64(recordingDotBlinkPeriod / 2) % 2 == 0 {
+		v.recordingDot.Show()
+	} else {
+		v.recordingDot.Hide()
+	}
+	v.recording.Show()
+	v.recording.Refresh()
+}
+
+// Show timelapse/burst progress: pairs taken (of total), failed ones and time to next pair, or start time while scheduled
+func (v *CameraView) UpdateSequence(status irnc.SequenceStatus) {
+	if !status.Active {
+		if v.sequence.Visible() { v.sequence.Hide() }
+		return
+	}
+	text := strings.ToUpper(string(status.Mode))
+	if status.Scheduled {
+		text += " AT " + status.Started.Format("15:04")
+	} else {
+		text += fmt.Sprintf(" %d", status.Taken)
+		if status.Total > 0 { text += fmt.Sprintf("/%d", status.Total) }
+		if status.Failed > 0 { text += fmt.Sprintf(" (%d failed)", status.Failed) }
+		if status.Mode == irnc.SequenceTimelapse && !status.NextAt.IsZero() {
+			text += " next " + formatMinSec(time.Until(status.NextAt).Seconds())
+		}
+	}
+	v.sequenceText.Text = text
+	v.sequence.Show()
+	v.sequence.Refresh()
+}
+
+// Show GPS receiver state (hidden when GPS is disabled)
+func (v *CameraView) UpdateGPS(status irnc.GPSStatus) {
+	switch status.State {
+		case irnc.GPSDisabled:
+			if v.gps.Visible() { v.gps.Hide() }
+			return
+		case irnc.GPSFix:
+			v.gpsText.Text = fmt.Sprintf("GPS %s", strings.ToUpper(status.Position.Quality))
+			if status.Position.Satellites > 0 {
+				v.gpsText.Text += fmt.Sprintf(" %d sat", status.Position.Satellites)
+			}
+			v.gpsBackground.FillColor = liveColor
+		case irnc.GPSNoFix:
+			v.gpsText.Text = "GPS NO FIX"
+			v.gpsBackground.FillColor = reconnectingColor
+		default:
+			v.gpsText.Text = "GPS OFFLINE"
+			v.gpsBackground.FillColor = failedColor
+	}
+	v.gps.Show()
+	v.gps.Refresh()
+}
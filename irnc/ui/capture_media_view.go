@@ -0,0 +1,115 @@
+package ui
+
+import (
+	"context"
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/canvas"
+	"fyne.io/fyne/v2/container"
+	"image"
+	"image/color"
+	_ "image/jpeg"
+	_ "image/png"
+	"irnc"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Shows captured file: photo as is, H264 video played in loop
+type captureMediaView struct {
+	image *UpdateableImage
+	missing *fyne.Container
+	Content *fyne.Container
+	cancel context.CancelFunc
+	cancelMtx sync.Mutex
+}
+
+// Factory function for captureMediaView
+func newCaptureMediaView(minSize fyne.Size) *captureMediaView {
+	missingText := canvas.NewText("NO FILE", color.White)
+	missingText.TextSize = 24
+	missingText.TextStyle = fyne.TextStyle{Bold: true}
+	v := &captureMediaView{
+		image: NewUpdateableImage(minSize),
+		missing: container.NewMax(canvas.NewRectangle(color.Black), container.NewCenter(missingText)),
+	}
+	v.Content = container.NewMax(v.image, v.missing)
+	return v
+}
+
+// Show file (empty name shows placeholder), previous playback is stopped
+func (v *captureMediaView) Show(filename string) {
+	v.Stop()
+	v.image.Update(nil)
+	if filename == "" {
+		v.missing.Show()
+		return
+	}
+	v.missing.Hide()
+	ctx, cancel := context.WithCancel(context.Background())
+	v.cancelMtx.Lock()
+	v.cancel = cancel
+	v.cancelMtx.Unlock()
+	if filepath.Ext(filename) == ".h264" {
+		go v.playVideo(ctx, filename)
+	} else {
+		go v.showPhoto(ctx, filename)
+	}
+}
+
+// Stop video playback
+func (v *captureMediaView) Stop() {
+	v.cancelMtx.Lock()
+	defer v.cancelMtx.Unlock()
+	if v.cancel == nil { return }
+	v.cancel()
+	v.cancel = nil
+}
+
+// Load photo in background
+func (v *captureMediaView) showPhoto(ctx context.Context, filename string) {
+	file, err := os.Open(filename)
+	if err != nil {
+		log.Println("Photo opening error:", err)
+		return
+	}
+	defer file.Close()
+	img, _, err := image.Decode(file)
+	if err != nil {
+		log.Println("Photo decoding error:", err)
+		return
+	}
+	if ctx.Err() == nil {
+		v.image.Update(img)
+	}
+}
+
+// Decode video with recording framerate over and over until context is done
+func (v *captureMediaView) playVideo(ctx context.Context, filename string) {
+	frameDuration := time.Second / time.Duration(irnc.RecordingFramerate())
+	for ctx.Err() == nil {
+		frames, err := irnc.DecodeH264File(ctx, filename)
+		if err != nil {
+			log.Println("Video opening error:", err)
+			return
+		}
+		shown := 0
+		for decoded := range frames {
+			// decoder is drained after stop to release its resources
+			if ctx.Err() != nil { continue }
+			if decoded.Error != nil {
+				log.Println("Video decoding error:", decoded.Error)
+				continue
+			}
+			v.image.Update(decoded.Result)
+			shown++
+			time.Sleep(frameDuration)
+		}
+		if shown == 0 {
+			log.Println("No frames decoded from", filename)
+			return
+		}
+	}
+}
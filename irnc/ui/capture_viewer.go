@@ -0,0 +1,170 @@
+package ui
+
+import (
+	"fmt"
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/canvas"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/layout"
+	"fyne.io/fyne/v2/theme"
+	"image/color"
+	"irnc"
+	"log"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// Full-screen view of single capture set with swipe navigation, starring, annotation, export and deletion
+type captureViewer struct {
+	gallery *galleryScreen
+	index int
+	current irnc.CaptureSet
+	irMedia, nMedia *captureMediaView
+	title *canvas.Text
+	starButton *SquareIconStickyButton
+	Content fyne.CanvasObject
+}
+
+// Factory function for captureViewer
+func newCaptureViewer(gallery *galleryScreen, buttonSize, buttonPaddingSize float32) *captureViewer {
+	minMediaSize := fyne.Size{Width: 100, Height: 100}
+	v := &captureViewer{
+		gallery: gallery,
+		irMedia: newCaptureMediaView(minMediaSize),
+		nMedia: newCaptureMediaView(minMediaSize),
+		title: canvas.NewText("", color.White),
+	}
+	v.title.TextStyle = fyne.TextStyle{Bold: true}
+	backButton := NewSquareIconStickyButton(buttonSize, buttonPaddingSize, theme.NavigateBackIcon(), func(wg *sync.WaitGroup) {
+		v.Close()
+		wg.Done()
+	})
+	v.starButton = NewSquareIconStickyButton(buttonSize, buttonPaddingSize, unstarredIcon, func(wg *sync.WaitGroup) {
+		v.toggleStar()
+		wg.Done()
+	})
+	deleteButton := NewSquareIconStickyButton(buttonSize, buttonPaddingSize, theme.DeleteIcon(), func(wg *sync.WaitGroup) {
+		v.confirmDelete()
+		wg.Done()
+	})
+	exportButton := NewSquareIconStickyButton(buttonSize, buttonPaddingSize, theme.UploadIcon(), func(wg *sync.WaitGroup) {
+		v.export()
+		wg.Done()
+	})
+	annotateButton := NewSquareIconStickyButton(buttonSize, buttonPaddingSize, theme.DocumentCreateIcon(), func(wg *sync.WaitGroup) {
+		v.annotate()
+		wg.Done()
+	})
+	buttons := container.New(layout.NewVBoxLayout(), layout.NewSpacer(), backButton, layout.NewSpacer(), v.starButton, layout.NewSpacer(), annotateButton, layout.NewSpacer(), exportButton, layout.NewSpacer(), deleteButton, layout.NewSpacer())
+	
+	titleBar := container.NewMax(canvas.NewRectangle(color.NRGBA{0, 0, 0, 160}), container.NewPadded(v.title))
+	irSide := container.NewMax(v.irMedia.Content, container.NewVBox(container.NewHBox(titleBar, layout.NewSpacer())))
+	next := func() { v.show(v.index + 1) }
+	previous := func() { v.show(v.index - 1) }
+	v.Content = container.New(&irncLayout{},
+		NewSwipeArea(irSide, next, previous),
+		buttons,
+		NewSwipeArea(v.nMedia.Content, next, previous),
+	)
+	return v
+}
+
+// Show capture set with given gallery position
+func (v *captureViewer) Open(index int) {
+	v.gallery.nav.Show(v.Content)
+	// playback was stopped on close, so same set must be reloaded
+	v.current = irnc.CaptureSet{}
+	v.show(index)
+}
+
+// Stop playback and return to gallery
+func (v *captureViewer) Close() {
+	v.irMedia.Stop()
+	v.nMedia.Stop()
+	v.gallery.Show()
+}
+
+// Switch to capture set (position is clamped to existing ones), gallery is shown when there are no sets left
+func (v *captureViewer) show(index int) {
+	count := v.gallery.Len()
+	if count == 0 {
+		v.Close()
+		return
+	}
+	if index < 0 { index = 0 }
+	if index >= count { index = count - 1 }
+	set, _ := v.gallery.Set(index)
+	if index == v.index && set.Prefix == v.current.Prefix { return }
+	v.index = index
+	v.current = set
+	v.irMedia.Show(capturePath(set, set.CameraFile("ir")))
+	v.nMedia.Show(capturePath(set, set.CameraFile("n")))
+	v.updateTitle()
+}
+
+// Show prefix, position, tags and star state
+func (v *captureViewer) updateTitle() {
+	meta, err := irnc.LoadCaptureMeta(v.current.Directory(irnc.CaptureRoot()), v.current.Prefix)
+	if err != nil { log.Println("Capture metadata loading error:", err) }
+	if meta.Starred {
+		v.starButton.SetIcon(starredIcon)
+	} else {
+		v.starButton.SetIcon(unstarredIcon)
+	}
+	v.title.Text = fmt.Sprintf("%s  %d/%d", v.current.Prefix, v.index + 1, v.gallery.Len())
+	if len(meta.Tags) > 0 {
+		v.title.Text += "  " + strings.Join(meta.Tags, ", ")
+	}
+	v.title.Refresh()
+}
+
+// Star or unstar current capture set
+func (v *captureViewer) toggleStar() {
+	meta, err := irnc.LoadCaptureMeta(v.current.Directory(irnc.CaptureRoot()), v.current.Prefix)
+	if err == nil {
+		err = irnc.SetCaptureStarred(irnc.CaptureRoot(), v.current, !meta.Starred)
+	}
+	if err != nil { log.Println("Capture starring error:", err) }
+	v.updateTitle()
+}
+
+// Ask for confirmation and delete current capture set
+func (v *captureViewer) confirmDelete() {
+	set := v.current
+	dialog.ShowConfirm("Delete", fmt.Sprintf("Delete %s?", set.Prefix), func(confirmed bool) {
+		if !confirmed { return }
+		v.irMedia.Stop()
+		v.nMedia.Stop()
+		err := irnc.DeleteCaptureSet(irnc.CaptureRoot(), set)
+		if err != nil { log.Println(err) }
+		v.gallery.Reload()
+		v.current = irnc.CaptureSet{}
+		v.show(v.index)
+	}, v.gallery.nav.window)
+}
+
+// Stop playback and edit tags and notes of current capture set, then come back to it
+func (v *captureViewer) annotate() {
+	v.irMedia.Stop()
+	v.nMedia.Stop()
+	index := v.index
+	v.gallery.annotation.Open(v.current, func() {
+		v.gallery.Reload()
+		v.Open(index)
+	})
+}
+
+// Stop playback and copy current capture set to USB stick
+func (v *captureViewer) export() {
+	v.irMedia.Stop()
+	v.nMedia.Stop()
+	v.gallery.export.ExportSets([]irnc.CaptureSet{v.current})
+}
+
+// Path of capture set file, empty name stays empty
+func capturePath(set irnc.CaptureSet, name string) string {
+	if name == "" { return "" }
+	return filepath.Join(set.Directory(irnc.CaptureRoot()), name)
+}
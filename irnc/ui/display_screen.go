@@ -0,0 +1,115 @@
+package ui
+
+import (
+	"fmt"
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/canvas"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/layout"
+	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
+	"image/color"
+	"irnc"
+	"log"
+	"sync"
+)
+
+// Step of brightness -/+ buttons
+const brightnessStepPercent = 10
+
+// Screen with brightness and night mode, changes are applied immediately and saved on leaving
+type displayScreen struct {
+	nav *screenNavigator
+	brightness *widget.Slider
+	brightnessValue *canvas.Text
+	nightMode *canvas.Text
+	Content fyne.CanvasObject
+}
+
+// Factory function for displayScreen
+func newDisplayScreen(nav *screenNavigator, buttonSize, buttonPaddingSize float32) *displayScreen {
+	s := &displayScreen{nav: nav}
+	s.brightness = widget.NewSlider(1, 100)
+	s.brightness.OnChanged = func(value float64) {
+		irnc.NotifyUserActivity()
+		s.setBrightness(int(value))
+	}
+	s.brightnessValue = canvas.NewText("", color.White)
+	s.brightnessValue.TextStyle = fyne.TextStyle{Bold: true}
+	s.brightnessValue.TextSize = 20
+	decrease := NewSquareIconStickyButton(buttonSize, buttonPaddingSize, theme.ContentRemoveIcon(), func(wg *sync.WaitGroup) {
+		s.setBrightness(int(irnc.GetLiveConfig().BrightnessPercent) - brightnessStepPercent)
+		wg.Done()
+	})
+	increase := NewSquareIconStickyButton(buttonSize, buttonPaddingSize, theme.ContentAddIcon(), func(wg *sync.WaitGroup) {
+		s.setBrightness(int(irnc.GetLiveConfig().BrightnessPercent) + brightnessStepPercent)
+		wg.Done()
+	})
+	s.nightMode = canvas.NewText("", color.White)
+	s.nightMode.TextStyle = fyne.TextStyle{Bold: true}
+	s.nightMode.TextSize = 20
+	nightToggle := NewSquareIconStickyButton(buttonSize, buttonPaddingSize, theme.VisibilityOffIcon(), func(wg *sync.WaitGroup) {
+		irnc.SetNightMode(!irnc.GetLiveConfig().NightMode)
+		s.update()
+		wg.Done()
+	})
+	backButton := NewSquareIconStickyButton(buttonSize, buttonPaddingSize, theme.NavigateBackIcon(), func(wg *sync.WaitGroup) {
+		s.save()
+		nav.ShowMain()
+		wg.Done()
+	})
+	label := func(text string) fyne.CanvasObject {
+		return canvas.NewText(text, color.White)
+	}
+	s.Content = container.NewBorder(
+		container.NewHBox(backButton),
+		nil, nil, nil,
+		container.NewVBox(
+			container.NewHBox(
+				container.NewVBox(layout.NewSpacer(), label("Brightness"), s.brightnessValue, layout.NewSpacer()),
+				layout.NewSpacer(),
+				decrease,
+				increase,
+			),
+			s.brightness,
+			container.NewHBox(
+				container.NewVBox(layout.NewSpacer(), label("Night mode"), s.nightMode, layout.NewSpacer()),
+				layout.NewSpacer(),
+				nightToggle,
+			),
+		),
+	)
+	return s
+}
+
+// Apply brightness live
+func (s *displayScreen) setBrightness(percent int) {
+	if uint(percent) == irnc.GetLiveConfig().BrightnessPercent { return }
+	irnc.SetBrightness(percent)
+	s.update()
+}
+
+// Show current values
+func (s *displayScreen) update() {
+	lc := irnc.GetLiveConfig()
+	s.brightnessValue.Text = fmt.Sprintf("%d %%", lc.BrightnessPercent)
+	s.brightnessValue.Refresh()
+	if s.brightness.Value != float64(lc.BrightnessPercent) {
+		s.brightness.SetValue(float64(lc.BrightnessPercent))
+	}
+	s.nightMode.Text = "Off"
+	if lc.NightMode { s.nightMode.Text = "On" }
+	s.nightMode.Refresh()
+}
+
+// Persist display settings
+func (s *displayScreen) save() {
+	err := irnc.PersistSettings()
+	if err != nil { log.Println("Display settings saving error:", err) }
+}
+
+// Show screen with current values
+func (s *displayScreen) Show() {
+	s.update()
+	s.nav.Show(s.Content)
+}
@@ -0,0 +1,154 @@
+package ui
+
+import (
+	"fmt"
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/canvas"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/layout"
+	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
+	"image/color"
+	"irnc"
+	"log"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const exportRefreshInterval = 500 * time.Millisecond
+
+// Screen copying captures to removable volume with progress
+type exportScreen struct {
+	nav *screenNavigator
+	volume *canvas.Text
+	progress *widget.ProgressBar
+	status *widget.Label
+	deleteOriginals *widget.Check
+	// detected volume, empty if none
+	currentVolume string
+	volumeMtx sync.Mutex
+	stopRefresh chan struct{}
+	Content fyne.CanvasObject
+}
+
+// Factory function for exportScreen
+func newExportScreen(nav *screenNavigator, buttonSize, buttonPaddingSize float32) *exportScreen {
+	s := &exportScreen{
+		nav: nav,
+		volume: canvas.NewText("", color.White),
+		progress: widget.NewProgressBar(),
+		status: widget.NewLabel(""),
+	}
+	s.volume.TextStyle = fyne.TextStyle{Bold: true}
+	s.volume.TextSize = 20
+	s.status.Wrapping = fyne.TextWrapWord
+	s.deleteOriginals = widget.NewCheck("Delete originals after verified copy", nil)
+	backButton := NewSquareIconStickyButton(buttonSize, buttonPaddingSize, theme.NavigateBackIcon(), func(wg *sync.WaitGroup) {
+		s.Close()
+		wg.Done()
+	})
+	exportButton := NewSquareIconStickyButton(buttonSize, buttonPaddingSize, theme.UploadIcon(), func(wg *sync.WaitGroup) {
+		s.start(func(volume string) error {
+			return irnc.StartNewCapturesExport(volume, s.deleteOriginals.Checked)
+		})
+		wg.Done()
+	})
+	s.Content = container.NewBorder(
+		container.NewHBox(backButton, layout.NewSpacer(), exportButton),
+		nil, nil, nil,
+		container.NewVBox(s.volume, s.progress, s.deleteOriginals, s.status),
+	)
+	return s
+}
+
+// Show screen and watch for volume and export progress
+func (s *exportScreen) Show() {
+	s.deleteOriginals.SetChecked(irnc.GetExportConfig().DeleteAfterExport)
+	s.status.SetText("New captures are copied with checksum verification")
+	s.nav.Show(s.Content)
+	if s.stopRefresh != nil { return }
+	s.stopRefresh = make(chan struct{})
+	go func(stop <-chan struct{}) {
+		ticker := time.NewTicker(exportRefreshInterval)
+		defer ticker.Stop()
+		for {
+			s.refresh()
+			select {
+				case <-stop:
+					return
+				case <-ticker.C:
+			}
+		}
+	}(s.stopRefresh)
+}
+
+// Stop watching and return to live preview (export itself goes on)
+func (s *exportScreen) Close() {
+	if s.stopRefresh != nil {
+		close(s.stopRefresh)
+		s.stopRefresh = nil
+	}
+	s.nav.ShowMain()
+}
+
+// Show screen and start copying given capture sets
+func (s *exportScreen) ExportSets(sets []irnc.CaptureSet) {
+	s.Show()
+	s.refresh()
+	s.start(func(volume string) error {
+		return irnc.StartExport(volume, sets, s.deleteOriginals.Checked)
+	})
+}
+
+// Start export to detected volume
+func (s *exportScreen) start(export func(volume string) error) {
+	s.volumeMtx.Lock()
+	volume := s.currentVolume
+	s.volumeMtx.Unlock()
+	if volume == "" {
+		s.status.SetText("Insert USB stick first")
+		return
+	}
+	err := export(volume)
+	if err != nil {
+		log.Println("Export start error:", err)
+		s.status.SetText(err.Error())
+	}
+}
+
+// Update detected volume and export progress
+func (s *exportScreen) refresh() {
+	volumes, err := irnc.DetectExportVolumes(irnc.GetExportConfig())
+	if err != nil { log.Println("Volume detection error:", err) }
+	volume := ""
+	if len(volumes) > 0 {
+		// first one is used when several are plugged
+		volume = volumes[0]
+	}
+	s.volumeMtx.Lock()
+	s.currentVolume = volume
+	s.volumeMtx.Unlock()
+	if volume == "" {
+		s.volume.Text = "No USB stick"
+	} else {
+		s.volume.Text = "USB stick: " + filepath.Base(volume)
+	}
+	s.volume.Refresh()
+
+	progress := irnc.GetExportProgress()
+	if progress.BytesTotal > 0 {
+		s.progress.SetValue(float64(progress.BytesDone) / float64(progress.BytesTotal))
+	}
+	switch {
+		case progress.Active:
+			current := progress.SetsDone + 1
+			if current > progress.SetsTotal { current = progress.SetsTotal }
+			s.status.SetText(fmt.Sprintf("Copying %d/%d: %s", current, progress.SetsTotal, progress.Current))
+		case !progress.Finished.IsZero() && len(progress.Errors) > 0:
+			s.status.SetText(fmt.Sprintf("Exported %d sets with errors:\n%s", progress.SetsTotal - len(progress.Errors), strings.Join(progress.Errors, "\n")))
+		case !progress.Finished.IsZero():
+			s.status.SetText(fmt.Sprintf("Exported %d sets, stick can be removed", progress.SetsTotal))
+	}
+}
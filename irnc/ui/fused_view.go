@@ -0,0 +1,92 @@
+package ui
+
+import (
+	"fyne.io/fyne/v2"
+	"image"
+	"image/color"
+	"sync"
+)
+
+// Opacity of IR preview blended over N preview
+const fusedIRAlpha = 0.5
+
+// Single preview with IR image alpha-blended over N image
+type fusedView struct {
+	Image *UpdateableImage
+	nPreview, irPreview image.Image
+	previewsMtx sync.Mutex
+}
+
+// Factory function for fusedView
+func newFusedView(minSize fyne.Size) *fusedView {
+	return &fusedView{Image: NewUpdateableImage(minSize)}
+}
+
+// Remember latest preview of camera ("n" or "ir") and show blend (red-tinted in night mode) once both are available
+func (v *fusedView) Update(camID string, preview image.Image, night bool) {
+	v.previewsMtx.Lock()
+	if camID == "ir" {
+		v.irPreview = preview
+	} else {
+		v.nPreview = preview
+	}
+	nPreview, irPreview := v.nPreview, v.irPreview
+	v.previewsMtx.Unlock()
+	if nPreview == nil || irPreview == nil { return }
+	blend := blendImages(nPreview, irPreview, fusedIRAlpha)
+	if night {
+		blend = nightImage(blend)
+	}
+	v.Image.Update(blend)
+}
+
+// Read 8-bit RGB of pixels in row y at columns xs (relative to image bounds) into dst
+func readRGBRow(img image.Image, y int, xs []int, dst []uint8) {
+	bounds := img.Bounds()
+	y += bounds.Min.Y
+	// fast paths for camera previews and blends, no color interface per pixel
+	switch src := img.(type) {
+		case *image.YCbCr:
+			for i, x := range xs {
+				x += bounds.Min.X
+				cOffset := src.COffset(x, y)
+				dst[i * 3], dst[i * 3 + 1], dst[i * 3 + 2] = color.YCbCrToRGB(src.Y[src.YOffset(x, y)], src.Cb[cOffset], src.Cr[cOffset])
+			}
+		case *image.RGBA:
+			for i, x := range xs {
+				copy(dst[i * 3:i * 3 + 3], src.Pix[src.PixOffset(bounds.Min.X + x, y):])
+			}
+		default:
+			for i, x := range xs {
+				r, g, b, _ := img.At(bounds.Min.X + x, y).RGBA()
+				dst[i * 3], dst[i * 3 + 1], dst[i * 3 + 2] = uint8(r >> 8), uint8(g >> 8), uint8(b >> 8)
+			}
+	}
+}
+
+// Blend top image over bottom one (scaled to bottom image size, nearest neighbour) with given opacity
+func blendImages(bottom, top image.Image, alpha float64) image.Image {
+	bottomBounds := bottom.Bounds()
+	topBounds := top.Bounds()
+	width, height := bottomBounds.Dx(), bottomBounds.Dy()
+	res := image.NewRGBA(image.Rect(0, 0, width, height))
+	if topBounds.Empty() { return res }
+	bottomXs, topXs := make([]int, width), make([]int, width)
+	for x := range bottomXs {
+		bottomXs[x], topXs[x] = x, x * topBounds.Dx() / width
+	}
+	topAlpha := uint32(alpha * 256)
+	bottomRow, topRow := make([]uint8, width * 3), make([]uint8, width * 3)
+	for y := 0; y < height; y++ {
+		readRGBRow(bottom, y, bottomXs, bottomRow)
+		readRGBRow(top, y * topBounds.Dy() / height, topXs, topRow)
+		pix := res.Pix[y * res.Stride:]
+		for x := 0; x < width; x++ {
+			for c := 0; c < 3; c++ {
+				pix[x * 4 + c] = uint8((uint32(bottomRow[x * 3 + c]) * (256 - topAlpha) + uint32(topRow[x * 3 + c]) * topAlpha) >> 8)
+			}
+			pix[x * 4 + 3] = 255
+		}
+	}
+	return res
+}
@@ -0,0 +1,171 @@
+package ui
+
+import (
+	"fmt"
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/canvas"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
+	"image/color"
+	"irnc"
+	"log"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+var thumbnailSize = fyne.NewSize(80, 60)
+
+var starredIcon = theme.NewThemedResource(fyne.NewStaticResource("starred.svg", []byte(
+	`<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 24 24"><path d="M12 17.27L18.18 21l-1.64-7.03L22 9.24l-7.19-.61L12 2 9.19 8.63 2 9.24l5.46 4.73L5.82 21z"/></svg>`)))
+var unstarredIcon = theme.NewThemedResource(fyne.NewStaticResource("unstarred.svg", []byte(
+	`<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 24 24"><path d="M22 9.24l-7.19-.62L12 2 9.19 8.63 2 9.24l5.46 4.73L5.82 21 12 17.27 18.18 21l-1.63-7.03L22 9.24zM12 15.4l-3.76 2.27 1-4.28-3.32-2.88 4.38-.38L12 6.1l1.71 4.04 4.38.38-3.32 2.88 1 4.28L12 15.4z"/></svg>`)))
+
+// Screen with capture sets (newest first), tap opens set in full-screen viewer
+type galleryScreen struct {
+	nav *screenNavigator
+	entries []irnc.CatalogEntry
+	entriesMtx sync.Mutex
+	list *widget.List
+	title *canvas.Text
+	viewer *captureViewer
+	// copies sets chosen in viewer
+	export *exportScreen
+	// edits tags and notes of set chosen in viewer
+	annotation *annotationScreen
+	Content fyne.CanvasObject
+}
+
+// Factory function for galleryScreen
+func newGalleryScreen(nav *screenNavigator, buttonSize, buttonPaddingSize float32) *galleryScreen {
+	g := &galleryScreen{nav: nav}
+	g.list = widget.NewList(
+		func() int {
+			return g.Len()
+		},
+		newCaptureSetRow,
+		func(id widget.ListItemID, row fyne.CanvasObject) {
+			g.entriesMtx.Lock()
+			defer g.entriesMtx.Unlock()
+			if id < len(g.entries) { updateCaptureSetRow(row, g.entries[id]) }
+		},
+	)
+	g.list.OnSelected = func(id widget.ListItemID) {
+		g.list.Unselect(id)
+		g.viewer.Open(id)
+	}
+	backButton := NewSquareIconStickyButton(buttonSize, buttonPaddingSize, theme.NavigateBackIcon(), func(wg *sync.WaitGroup) {
+		nav.ShowMain()
+		wg.Done()
+	})
+	g.title = canvas.NewText("", color.White)
+	g.title.TextSize = 20
+	g.title.TextStyle = fyne.TextStyle{Bold: true}
+	g.Content = container.NewBorder(container.NewHBox(backButton, container.NewCenter(g.title)), nil, nil, nil, g.list)
+	g.viewer = newCaptureViewer(g, buttonSize, buttonPaddingSize)
+	return g
+}
+
+// Reread capture sets from catalog
+func (g *galleryScreen) Reload() {
+	entries, err := irnc.QueryCaptures(irnc.CatalogQuery{})
+	if err != nil { log.Println("Capture sets query error:", err) }
+	g.entriesMtx.Lock()
+	g.entries = entries
+	g.entriesMtx.Unlock()
+	g.title.Text = fmt.Sprintf("%d captures", len(entries))
+	g.title.Refresh()
+	g.list.Refresh()
+}
+
+// Get capture set by list position
+func (g *galleryScreen) Set(index int) (irnc.CaptureSet, bool) {
+	g.entriesMtx.Lock()
+	defer g.entriesMtx.Unlock()
+	if index < 0 || index >= len(g.entries) { return irnc.CaptureSet{}, false }
+	return g.entries[index].CaptureSet, true
+}
+
+// Get count of capture sets
+func (g *galleryScreen) Len() int {
+	g.entriesMtx.Lock()
+	defer g.entriesMtx.Unlock()
+	return len(g.entries)
+}
+
+// Show up-to-date list of captures
+func (g *galleryScreen) Show() {
+	g.Reload()
+	g.nav.Show(g.Content)
+}
+
+// Create list row template: IR and N thumbnails, prefix and description
+func newCaptureSetRow() fyne.CanvasObject {
+	var thumbnails []fyne.CanvasObject
+	for i := 0; i < 2; i++ {
+		thumbnail := &canvas.Image{FillMode: canvas.ImageFillContain}
+		thumbnail.SetMinSize(thumbnailSize)
+		thumbnails = append(thumbnails, thumbnail)
+	}
+	prefix := canvas.NewText("", color.White)
+	prefix.TextStyle = fyne.TextStyle{Bold: true}
+	description := canvas.NewText("", color.Gray{Y: 180})
+	return container.NewHBox(thumbnails[0], thumbnails[1], container.NewVBox(prefix, description))
+}
+
+// Fill list row with capture set
+func updateCaptureSetRow(row fyne.CanvasObject, entry irnc.CatalogEntry) {
+	set := entry.CaptureSet
+	objects := row.(*fyne.Container).Objects
+	setThumbnail(objects[0].(*canvas.Image), capturePath(set, set.CameraFile("ir")))
+	setThumbnail(objects[1].(*canvas.Image), capturePath(set, set.CameraFile("n")))
+	texts := objects[2].(*fyne.Container).Objects
+	prefix := texts[0].(*canvas.Text)
+	prefix.Text = set.Prefix
+	prefix.Refresh()
+	description := texts[1].(*canvas.Text)
+	description.Text = describeCaptureSet(entry)
+	description.Refresh()
+}
+
+// Show photo as is, placeholder icons for video, photo formats which can't be shown (WebP, TIFF, raw) and missing file
+func setThumbnail(thumbnail *canvas.Image, path string) {
+	thumbnail.File = ""
+	thumbnail.Resource = nil
+	switch {
+		case path == "":
+			thumbnail.Resource = theme.QuestionIcon()
+		case filepath.Ext(path) == ".png" || filepath.Ext(path) == ".jpg":
+			thumbnail.File = path
+		case filepath.Ext(path) == ".h264":
+			thumbnail.Resource = theme.FileVideoIcon()
+		default:
+			thumbnail.Resource = theme.FileImageIcon()
+	}
+	thumbnail.Refresh()
+}
+
+// Short human-readable summary of capture set
+func describeCaptureSet(entry irnc.CatalogEntry) string {
+	kinds := make(map[string]bool)
+	for _, name := range entry.Files {
+		if filepath.Ext(name) == ".h264" {
+			kinds["video"] = true
+		} else {
+			kinds["photo"] = true
+		}
+	}
+	var parts []string
+	for _, kind := range []string{"photo", "video"} {
+		if kinds[kind] { parts = append(parts, kind) }
+	}
+	if entry.DurationSec > 0 {
+		parts = append(parts, fmt.Sprintf("%.0fs", entry.DurationSec))
+	}
+	if entry.Starred {
+		parts = append(parts, "starred")
+	}
+	parts = append(parts, entry.Tags...)
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,152 @@
+package ui
+
+import (
+	"context"
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/app"
+	"fyne.io/fyne/v2/theme"
+	"irnc"
+	"log"
+	"sync"
+	"time"
+)
+
+// warning: non GC-managed memory bleeds constantly (approx. 1Mb in 6min)
+// logic/camera/decoder/etc removal doesn't eliminate memleak
+// seems to bleed faster when GUI updates frequently
+// originating from Fyne communication with Raspbian?
+
+const displayMonitorInterval = 200 * time.Millisecond
+
+// Size of resizable window in windowed mode
+var windowedSize = fyne.NewSize(800, 480)
+
+// Run GUI, show main window (fullscreen unless windowed) until exit button is pressed (or exit is chosen in menu) or context is done
+func RunGUI(ctx context.Context, windowed bool) {
+	app := app.New()
+	w := app.NewWindow("IRNC")
+	
+	buttonSize := float32(100)
+	buttonPaddingSize := float32(10)
+	photoButton := NewSquareIconStickyButton(buttonSize, buttonPaddingSize, rscPhotoPng, func(wg *sync.WaitGroup) {
+		go func() {
+			// button is released once frames are grabbed, encoding continues in background
+			_, errs := irnc.StartSnapshot()
+			for _, err := range errs {
+				log.Println(err)
+			}
+			wg.Done()
+		}()
+	})
+	recordButton := NewSquareIconStickyButton(buttonSize, buttonPaddingSize, rscVideoPng, func(wg *sync.WaitGroup) {
+		recordingDone, err := irnc.StartRecording(irnc.GetLiveConfig().VideoDuration())
+		if err != nil {
+			log.Println("Recording start error:", err)
+			wg.Done()
+			return
+		}
+		go func() {
+			<-recordingDone
+			wg.Done()
+		}()
+	})
+	quit := func() {
+		// cleanup is done by caller after RunGUI returns
+		log.Println("Exit requested")
+		app.Quit()
+	}
+	nav := &screenNavigator{window: w, wake: newWakeOverlay()}
+	var liveScreen *mainScreen
+	gallery := newGalleryScreen(nav, buttonSize * 0.6, buttonPaddingSize * 0.6)
+	settings := newSettingsScreen(nav, buttonSize * 0.6, buttonPaddingSize * 0.6)
+	display := newDisplayScreen(nav, buttonSize * 0.6, buttonPaddingSize * 0.6)
+	export := newExportScreen(nav, buttonSize * 0.6, buttonPaddingSize * 0.6)
+	annotation := newAnnotationScreen(nav, buttonSize * 0.6, buttonPaddingSize * 0.6)
+	sequence := newSequenceScreen(nav, buttonSize * 0.6, buttonPaddingSize * 0.6)
+	gallery.export = export
+	gallery.annotation = annotation
+	menu := newMenuScreen(buttonSize, buttonPaddingSize, []menuItem{
+		{theme.NavigateBackIcon(), "Back", nav.ShowMain},
+		{theme.FolderOpenIcon(), "Gallery", gallery.Show},
+		{theme.SettingsIcon(), "Settings", settings.Show},
+		{theme.ViewRestoreIcon(), "Layout", func() { liveScreen.cycleLayout(1) }},
+		{theme.ComputerIcon(), "Display", display.Show},
+		{theme.HistoryIcon(), "Timelapse", sequence.Show},
+		{theme.UploadIcon(), "Export", export.Show},
+		{rscExitPng, "Exit", quit},
+	})
+	menuButton := NewSquareIconStickyButton(buttonSize, buttonPaddingSize, theme.MenuIcon(), func(wg *sync.WaitGroup) {
+		nav.Show(menu)
+		wg.Done()
+	})
+	exitButton := NewSquareIconStickyButton(buttonSize, buttonPaddingSize, rscExitPng, func(*sync.WaitGroup) {
+		quit()
+	})
+	liveScreen = newMainScreen(nav, []fyne.CanvasObject{photoButton, recordButton, menuButton, exitButton})
+	liveScreen.SetLayout(ScreenLayout(irnc.GetSettings().ScreenLayout), false)
+	bindShortcuts(w, nav, newShortcuts(liveScreen, quit))
+	
+	for i, view := range []*CameraView{liveScreen.nView, liveScreen.irView} {
+		go func(camIndex int, view *CameraView) {
+			for {
+				// cameras are replaced when settings change
+				nCam, irCam := irnc.Cameras()
+				camera := []irnc.Camera{nCam, irCam}[camIndex]
+				status := irnc.GetCameraStatus(camera)
+				view.UpdateStatus(status)
+				view.UpdateRecording(irnc.GetRecordingStatus(), camera.Name())
+				view.UpdateSequence(irnc.GetSequenceStatus())
+				if view == liveScreen.irView {
+					// one indicator is enough, IR preview is shown by most layouts
+					view.UpdateGPS(irnc.GetGPSStatus())
+				}
+				if status.State != irnc.CameraRunning {
+					// frozen or missing image is covered by placeholder, nothing to update
+					time.Sleep(time.Second / time.Duration(irnc.GetLiveConfig().PreviewFramerate))
+					continue
+				}
+				preview, err := camera.Preview()
+				if err == nil {
+					liveScreen.UpdatePreview([]string{"n", "ir"}[camIndex], view, preview)
+				} else {
+					log.Println("Preview image retrieval error:", err)
+				}
+				// warning: sleep-less cycle prevents other widgets update which is suboptimal. runtime.Gosched() is not sufficient.
+				time.Sleep(time.Second / time.Duration(irnc.GetLiveConfig().PreviewFramerate))
+			}
+		}(i, view)
+	}
+	go monitorDisplay(app, nav)
+	go promptAnnotations(ctx, nav, annotation)
+	go func() {
+		<-ctx.Done()
+		app.Quit()
+	}()
+	if windowed {
+		w.Resize(windowedSize)
+	} else {
+		w.SetFullScreen(true)
+	}
+	w.ShowAndRun()
+}
+
+// Cover dimmed screen by wake overlay, switch theme when night mode changes
+func monitorDisplay(app fyne.App, nav *screenNavigator) {
+	night := false
+	for {
+		if irnc.BacklightDimmed() {
+			if !nav.wake.Visible() { nav.wake.Show() }
+		} else if nav.wake.Visible() {
+			nav.wake.Hide()
+		}
+		if lc := irnc.GetLiveConfig(); lc.NightMode != night {
+			night = lc.NightMode
+			if night {
+				app.Settings().SetTheme(newNightTheme())
+			} else {
+				app.Settings().SetTheme(theme.DefaultTheme())
+			}
+		}
+		time.Sleep(displayMonitorInterval)
+	}
+}
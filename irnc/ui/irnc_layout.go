@@ -1,17 +1,26 @@
-package irnc
+package ui
 
 import (
 	"fyne.io/fyne/v2"
 )
 
-// Minimal container in middle and evenly maxed containers on sides
-type irncLayout struct { }
+// Minimal container in middle and evenly maxed containers on sides (top and bottom when vertical)
+type irncLayout struct {
+	vertical bool
+}
 
 // Minimal size
 func (l *irncLayout) MinSize(objects []fyne.CanvasObject) fyne.Size {
 	var w, h float32
 	for _, o := range objects {
 		chMinSize := o.MinSize()
+		if l.vertical {
+			h += chMinSize.Height
+			if chMinSize.Width > w {
+				w = chMinSize.Width
+			}
+			continue
+		}
 		w += chMinSize.Width
 		if chMinSize.Height > h {
 			h = chMinSize.Height
@@ -28,6 +37,19 @@ func (l *irncLayout) Layout(objects []fyne.CanvasObject, containerSize fyne.Size
 	right := objects[2]
 	
 	midSize := mid.MinSize()
+	if l.vertical {
+		midTop := (containerSize.Height - midSize.Height)/2
+		
+		mid.Resize(fyne.NewSize(containerSize.Width, midSize.Height))
+		mid.Move(fyne.NewPos(0, midTop))
+		
+		left.Resize(fyne.NewSize(containerSize.Width, midTop))
+		left.Move(fyne.NewPos(0, 0))
+		
+		right.Resize(fyne.NewSize(containerSize.Width, containerSize.Height - midTop - midSize.Height))
+		right.Move(fyne.NewPos(0, midTop+midSize.Height))
+		return
+	}
 	midLeft := (containerSize.Width - midSize.Width)/2
 	
 	mid.Resize(fyne.NewSize(midSize.Width, containerSize.Height))
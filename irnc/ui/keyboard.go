@@ -0,0 +1,79 @@
+package ui
+
+import (
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
+	"irnc"
+	"strings"
+	"unicode"
+)
+
+// Key rows of on-screen keyboard (lowercase, shift gives uppercase)
+var keyboardRows = []string{"1234567890", "qwertyuiop", "asdfghjkl", "zxcvbnm"}
+
+// On-screen keyboard typing into entry, for devices without physical keyboard
+type onScreenKeyboard struct {
+	target *widget.Entry
+	// next letter is uppercase
+	shift bool
+	letterKeys []*widget.Button
+	Content fyne.CanvasObject
+}
+
+// Factory function for onScreenKeyboard
+func newOnScreenKeyboard(target *widget.Entry) *onScreenKeyboard {
+	k := &onScreenKeyboard{target: target}
+	var rows []fyne.CanvasObject
+	for _, row := range keyboardRows {
+		var keys []fyne.CanvasObject
+		for _, r := range row {
+			key := r
+			button := widget.NewButton(string(key), func() { k.typeRune(key) })
+			if unicode.IsLetter(key) { k.letterKeys = append(k.letterKeys, button) }
+			keys = append(keys, button)
+		}
+		rows = append(rows, container.NewGridWithColumns(len(row), keys...))
+	}
+	shiftKey := widget.NewButtonWithIcon("", theme.MoveUpIcon(), func() {
+		irnc.NotifyUserActivity()
+		k.setShift(!k.shift)
+	})
+	backspaceKey := widget.NewButtonWithIcon("", theme.NavigateBackIcon(), func() {
+		irnc.NotifyUserActivity()
+		k.target.TypedKey(&fyne.KeyEvent{Name: fyne.KeyBackspace})
+	})
+	spaceKey := widget.NewButton("space", func() { k.typeRune(' ') })
+	var punctuation []fyne.CanvasObject
+	for _, r := range "-.,/#" {
+		key := r
+		punctuation = append(punctuation, widget.NewButton(string(key), func() { k.typeRune(key) }))
+	}
+	bottomRow := container.NewBorder(nil, nil, shiftKey, backspaceKey,
+		container.NewGridWithColumns(2, spaceKey, container.NewGridWithColumns(len(punctuation), punctuation...)))
+	k.Content = container.NewVBox(append(rows, bottomRow)...)
+	return k
+}
+
+// Type character at entry cursor, shift applies to single letter
+func (k *onScreenKeyboard) typeRune(r rune) {
+	irnc.NotifyUserActivity()
+	if k.shift && unicode.IsLetter(r) {
+		r = unicode.ToUpper(r)
+		k.setShift(false)
+	}
+	k.target.TypedRune(r)
+}
+
+// Switch letter keys between lowercase and uppercase
+func (k *onScreenKeyboard) setShift(shift bool) {
+	k.shift = shift
+	for _, key := range k.letterKeys {
+		if shift {
+			key.SetText(strings.ToUpper(key.Text))
+		} else {
+			key.SetText(strings.ToLower(key.Text))
+		}
+	}
+}
@@ -0,0 +1,145 @@
+package ui
+
+import (
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/layout"
+	"image"
+	"irnc"
+	"log"
+	"sync"
+)
+
+type ScreenLayout string
+
+const (
+	// IR on the left, buttons in the middle, N on the right
+	LayoutSideBySide ScreenLayout = "side_by_side"
+	// N on the left, buttons in the middle, IR on the right
+	LayoutSwapped ScreenLayout = "swapped"
+	// single camera full screen with buttons overlay
+	LayoutSingleIR ScreenLayout = "single_ir"
+	LayoutSingleN ScreenLayout = "single_n"
+	// IR full screen with draggable N inset
+	LayoutPiP ScreenLayout = "pip"
+	// IR on top, buttons row in the middle, N on bottom (portrait screens)
+	LayoutVertical ScreenLayout = "vertical"
+	// IR blended over N with buttons overlay
+	LayoutFused ScreenLayout = "fused"
+)
+
+// Order of layouts switched by swipe/menu
+var screenLayouts = []ScreenLayout{LayoutSideBySide, LayoutSwapped, LayoutSingleIR, LayoutSingleN, LayoutPiP, LayoutVertical, LayoutFused}
+
+// Get layout following (or preceding for negative step) given one, unknown layout is treated as default
+func cycleScreenLayout(current ScreenLayout, step int) ScreenLayout {
+	index := 0
+	for i, l := range screenLayouts {
+		if l == current { index = i }
+	}
+	count := len(screenLayouts)
+	return screenLayouts[((index + step) % count + count) % count]
+}
+
+// Live preview screen arranged by selectable layout
+type mainScreen struct {
+	nav *screenNavigator
+	irView, nView *CameraView
+	fused *fusedView
+	buttons []fyne.CanvasObject
+	layout ScreenLayout
+	layoutMtx sync.Mutex
+}
+
+// Factory function for mainScreen
+func newMainScreen(nav *screenNavigator, buttons []fyne.CanvasObject) *mainScreen {
+	minPreviewSize := fyne.Size{Width: 100, Height: 100}
+	return &mainScreen{
+		nav: nav,
+		irView: NewCameraView(minPreviewSize),
+		nView: NewCameraView(minPreviewSize),
+		fused: newFusedView(minPreviewSize),
+		buttons: buttons,
+	}
+}
+
+// Get current layout
+func (m *mainScreen) Layout() ScreenLayout {
+	m.layoutMtx.Lock()
+	defer m.layoutMtx.Unlock()
+	return m.layout
+}
+
+// Rearrange screen (unknown layout is replaced by default one), remember choice if requested
+func (m *mainScreen) SetLayout(l ScreenLayout, remember bool) {
+	known := false
+	for _, candidate := range screenLayouts {
+		if candidate == l { known = true }
+	}
+	if !known {
+		log.Printf("Unknown screen layout %q, %q is used", l, LayoutSideBySide)
+		l = LayoutSideBySide
+	}
+	m.layoutMtx.Lock()
+	m.layout = l
+	m.layoutMtx.Unlock()
+	m.nav.main = NewSwipeArea(m.build(l), func() { m.cycleLayout(1) }, func() { m.cycleLayout(-1) })
+	m.nav.ShowMain()
+	if !remember { return }
+	err := irnc.SetScreenLayout(string(l))
+	if err != nil { log.Println(err) }
+}
+
+// Switch to next/previous layout
+func (m *mainScreen) cycleLayout(step int) {
+	m.SetLayout(cycleScreenLayout(m.Layout(), step), true)
+}
+
+// Arrange camera views and buttons (objects are shared, so only one arrangement is shown at a time)
+func (m *mainScreen) build(l ScreenLayout) fyne.CanvasObject {
+	column := func() fyne.CanvasObject {
+		objects := []fyne.CanvasObject{layout.NewSpacer()}
+		for _, button := range m.buttons {
+			objects = append(objects, button, layout.NewSpacer())
+		}
+		return container.New(layout.NewVBoxLayout(), objects...)
+	}
+	switch l {
+		case LayoutSwapped:
+			return container.New(&irncLayout{}, m.nView.Content, column(), m.irView.Content)
+		case LayoutSingleIR:
+			return container.New(&overlayLayout{}, m.irView.Content, column())
+		case LayoutSingleN:
+			return container.New(&overlayLayout{}, m.nView.Content, column())
+		case LayoutPiP:
+			pipLayout := &overlayLayout{insetX: 0, insetY: 1, withInset: true}
+			inset := NewDraggableInset(m.nView.Content, pipLayout)
+			res := container.New(pipLayout, m.irView.Content, inset, column())
+			inset.parent = res
+			return res
+		case LayoutVertical:
+			objects := []fyne.CanvasObject{layout.NewSpacer()}
+			for _, button := range m.buttons {
+				objects = append(objects, button, layout.NewSpacer())
+			}
+			return container.New(&irncLayout{vertical: true}, m.irView.Content, container.New(layout.NewHBoxLayout(), objects...), m.nView.Content)
+		case LayoutFused:
+			return container.New(&overlayLayout{}, m.fused.Image, column())
+		default:
+			return container.New(&irncLayout{}, m.irView.Content, column(), m.nView.Content)
+	}
+}
+
+// Show fresh preview of camera ("n" or "ir"), red-tinted in night mode
+func (m *mainScreen) UpdatePreview(camID string, view *CameraView, preview image.Image) {
+	night := irnc.GetLiveConfig().NightMode
+	if m.Layout() == LayoutFused {
+		m.fused.Update(camID, preview, night)
+		return
+	}
+	if night {
+		view.Image.Update(nightImage(preview))
+	} else {
+		view.Image.Update(preview)
+	}
+}
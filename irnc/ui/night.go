@@ -0,0 +1,67 @@
+package ui
+
+import (
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/theme"
+	"image"
+	"image/color"
+)
+
+// Night mode colors: dim red on black preserves dark adaptation of eyes
+var nightForegroundColor = color.NRGBA{160, 0, 0, 255}
+var nightDisabledColor = color.NRGBA{80, 0, 0, 255}
+var nightHighlightColor = color.NRGBA{160, 0, 0, 64}
+
+// Default dark theme with all foreground colors replaced by dim red
+type nightTheme struct {
+	fyne.Theme
+}
+
+// Factory function for nightTheme
+func newNightTheme() fyne.Theme {
+	return &nightTheme{Theme: theme.DefaultTheme()}
+}
+
+// Get theme color, variant is ignored (night theme is always dark)
+func (t *nightTheme) Color(name fyne.ThemeColorName, _ fyne.ThemeVariant) color.Color {
+	switch name {
+		case theme.ColorNameBackground, theme.ColorNameInputBackground, theme.ColorNameButton:
+			return color.Black
+		case theme.ColorNameDisabled, theme.ColorNameDisabledButton, theme.ColorNamePlaceHolder, theme.ColorNameScrollBar, theme.ColorNameShadow:
+			return nightDisabledColor
+		case theme.ColorNameForeground, theme.ColorNamePrimary, theme.ColorNameFocus:
+			return nightForegroundColor
+		case theme.ColorNameHover, theme.ColorNamePressed, theme.ColorNameSelection:
+			return nightHighlightColor
+		default:
+			return t.Theme.Color(name, theme.VariantDark)
+	}
+}
+
+// Palette of black to night foreground color
+var nightPalette = func() color.Palette {
+	res := make(color.Palette, 256)
+	for i := range res {
+		res[i] = color.NRGBA{uint8(uint32(nightForegroundColor.R) * uint32(i) / 255), 0, 0, 255}
+	}
+	return res
+}()
+
+// Turn image into red monochrome by its luminance
+func nightImage(img image.Image) image.Image {
+	bounds := img.Bounds()
+	res := image.NewPaletted(image.Rect(0, 0, bounds.Dx(), bounds.Dy()), nightPalette)
+	// fast path for camera previews: luminance is stored separately
+	if ycbcr, ok := img.(*image.YCbCr); ok {
+		for y := 0; y < bounds.Dy(); y++ {
+			copy(res.Pix[y * res.Stride:y * res.Stride + bounds.Dx()], ycbcr.Y[ycbcr.YOffset(bounds.Min.X, bounds.Min.Y + y):])
+		}
+		return res
+	}
+	for y := 0; y < bounds.Dy(); y++ {
+		for x := 0; x < bounds.Dx(); x++ {
+			res.Pix[y * res.Stride + x] = color.GrayModel.Convert(img.At(bounds.Min.X + x, bounds.Min.Y + y)).(color.Gray).Y
+		}
+	}
+	return res
+}
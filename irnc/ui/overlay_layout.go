@@ -0,0 +1,90 @@
+package ui
+
+import (
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/widget"
+)
+
+// Part of screen occupied by picture-in-picture inset
+const insetScale = 0.35
+
+// Full-size background, optional draggable inset and minimal button bar overlaid at the right edge
+type overlayLayout struct {
+	// relative inset position within free space: 0 - left/top, 1 - right/bottom
+	insetX, insetY float32
+	withInset bool
+}
+
+// Minimal size
+func (l *overlayLayout) MinSize(objects []fyne.CanvasObject) fyne.Size {
+	var res fyne.Size
+	for _, o := range objects {
+		res = res.Max(o.MinSize())
+	}
+	return res
+}
+
+// Layout function
+func (l *overlayLayout) Layout(objects []fyne.CanvasObject, containerSize fyne.Size) {
+	if len(objects) == 0 { return }
+	background := objects[0]
+	background.Resize(containerSize)
+	background.Move(fyne.NewPos(0, 0))
+	rest := objects[1:]
+	if l.withInset && len(rest) > 0 {
+		inset := rest[0]
+		rest = rest[1:]
+		insetSize := fyne.NewSize(containerSize.Width * insetScale, containerSize.Height * insetScale)
+		inset.Resize(insetSize)
+		inset.Move(fyne.NewPos((containerSize.Width - insetSize.Width) * l.insetX, (containerSize.Height - insetSize.Height) * l.insetY))
+	}
+	if len(rest) > 0 {
+		buttons := rest[0]
+		buttonsWidth := buttons.MinSize().Width
+		buttons.Resize(fyne.NewSize(buttonsWidth, containerSize.Height))
+		buttons.Move(fyne.NewPos(containerSize.Width - buttonsWidth, 0))
+	}
+}
+
+// Inset of picture-in-picture layout, moved by dragging
+type DraggableInset struct {
+	widget.BaseWidget
+	content fyne.CanvasObject
+	layout *overlayLayout
+	parent *fyne.Container
+}
+
+// Factory function for DraggableInset, parent container must use given layout
+func NewDraggableInset(content fyne.CanvasObject, layout *overlayLayout) *DraggableInset {
+	inset := &DraggableInset{content: content, layout: layout}
+	inset.ExtendBaseWidget(inset)
+	return inset
+}
+
+// Link widget to its renderer
+func (i *DraggableInset) CreateRenderer() fyne.WidgetRenderer {
+	return widget.NewSimpleRenderer(i.content)
+}
+
+// Drag event handler
+func (i *DraggableInset) Dragged(e *fyne.DragEvent) {
+	if i.parent == nil { return }
+	parentSize := i.parent.Size()
+	size := i.Size()
+	clamp := func(v float32) float32 {
+		if v < 0 { return 0 }
+		if v > 1 { return 1 }
+		return v
+	}
+	if freeWidth := parentSize.Width - size.Width; freeWidth > 0 {
+		i.layout.insetX = clamp(i.layout.insetX + e.Dragged.DX / freeWidth)
+	}
+	if freeHeight := parentSize.Height - size.Height; freeHeight > 0 {
+		i.layout.insetY = clamp(i.layout.insetY + e.Dragged.DY / freeHeight)
+	}
+	i.parent.Refresh()
+}
+
+// Drag end event handler
+func (i *DraggableInset) DragEnd() {
+}
@@ -0,0 +1,107 @@
+package ui
+
+import (
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/canvas"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/layout"
+	"fyne.io/fyne/v2/widget"
+	"image/color"
+	"irnc"
+	"sync"
+)
+
+// Switches window content between main (live preview) screen and auxiliary full-screen screens
+type screenNavigator struct {
+	window fyne.Window
+	main fyne.CanvasObject
+	wake *wakeOverlay
+	// screen being shown
+	current fyne.CanvasObject
+	currentMtx sync.Mutex
+}
+
+// Replace window content with screen
+func (n *screenNavigator) Show(screen fyne.CanvasObject) {
+	n.currentMtx.Lock()
+	n.current = screen
+	n.currentMtx.Unlock()
+	n.window.SetContent(container.NewMax(screen, n.wake))
+}
+
+// Check whether live preview screen is shown
+func (n *screenNavigator) IsMainShown() bool {
+	n.currentMtx.Lock()
+	defer n.currentMtx.Unlock()
+	return n.current != nil && n.current == n.main
+}
+
+// Return to live preview screen
+func (n *screenNavigator) ShowMain() {
+	n.Show(n.main)
+}
+
+// Transparent cover of dimmed screen, first touch only wakes screen instead of pressing something
+type wakeOverlay struct {
+	widget.BaseWidget
+}
+
+// Factory function for wakeOverlay (hidden until screen is dimmed)
+func newWakeOverlay() *wakeOverlay {
+	o := &wakeOverlay{}
+	o.ExtendBaseWidget(o)
+	o.Hide()
+	return o
+}
+
+// Link widget to its renderer
+func (o *wakeOverlay) CreateRenderer() fyne.WidgetRenderer {
+	return widget.NewSimpleRenderer(canvas.NewRectangle(color.Transparent))
+}
+
+// Tap event handler
+func (o *wakeOverlay) Tapped(*fyne.PointEvent) {
+	o.wakeUp()
+}
+
+// Drag event handler
+func (o *wakeOverlay) Dragged(*fyne.DragEvent) {
+}
+
+// Drag end event handler
+func (o *wakeOverlay) DragEnd() {
+	o.wakeUp()
+}
+
+// Restore brightness and uncover screen
+func (o *wakeOverlay) wakeUp() {
+	irnc.NotifyUserActivity()
+	o.Hide()
+}
+
+// Large labeled button of menu screen
+type menuItem struct {
+	icon fyne.Resource
+	label string
+	action func()
+}
+
+// Create screen with grid of large labeled buttons
+func newMenuScreen(buttonSize, buttonPaddingSize float32, items []menuItem) fyne.CanvasObject {
+	var cells []fyne.CanvasObject
+	for _, item := range items {
+		action := item.action
+		button := NewSquareIconStickyButton(buttonSize, buttonPaddingSize, item.icon, func(wg *sync.WaitGroup) {
+			action()
+			wg.Done()
+		})
+		label := canvas.NewText(item.label, color.White)
+		label.TextStyle = fyne.TextStyle{Bold: true}
+		label.Alignment = fyne.TextAlignCenter
+		cells = append(cells, container.NewVBox(container.NewCenter(button), label))
+	}
+	return container.NewMax(
+		canvas.NewRectangle(color.Black),
+		container.NewVBox(layout.NewSpacer(), container.NewGridWithColumns(4, cells...), layout.NewSpacer()),
+	)
+}
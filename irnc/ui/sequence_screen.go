@@ -0,0 +1,178 @@
+package ui
+
+import (
+	"fmt"
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/canvas"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/layout"
+	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
+	"image/color"
+	"irnc"
+	"sync"
+)
+
+// Sequence parameter chosen from preset values by -/+ buttons
+type presetControl struct {
+	label string
+	presets []int
+	index int
+	format func(int) string
+	value *canvas.Text
+}
+
+// Screen starting timelapse or burst with chosen parameters, progress is shown in live preview
+type sequenceScreen struct {
+	nav *screenNavigator
+	interval, duration, count *presetControl
+	video bool
+	videoValue *canvas.Text
+	// guards control indexes and video flag
+	paramsMtx sync.Mutex
+	status *widget.Label
+	Content fyne.CanvasObject
+}
+
+// Format duration in minutes, 0 as unlimited
+func formatSequenceDuration(minutes int) string {
+	if minutes == 0 { return "until stopped" }
+	if minutes % 60 == 0 { return fmt.Sprintf("%d h", minutes / 60) }
+	return fmt.Sprintf("%d min", minutes)
+}
+
+// Factory function for sequenceScreen
+func newSequenceScreen(nav *screenNavigator, buttonSize, buttonPaddingSize float32) *sequenceScreen {
+	s := &sequenceScreen{
+		nav: nav,
+		interval: &presetControl{label: "Timelapse interval", presets: []int{1, 2, 5, 10, 30, 60, 120, 300, 600, 1800, 3600}, index: 3, format: withUnit("s")},
+		duration: &presetControl{label: "Timelapse duration", presets: []int{0, 1, 5, 10, 30, 60, 120, 240, 480, 1440}, index: 0, format: formatSequenceDuration},
+		count: &presetControl{label: "Burst pairs", presets: []int{2, 5, 10, 20, 30, 50}, index: 2, format: func(v int) string { return fmt.Sprintf("%d", v) }},
+	}
+	var rows []fyne.CanvasObject
+	for _, control := range []*presetControl{s.interval, s.duration, s.count} {
+		rows = append(rows, s.newControlRow(control, buttonSize, buttonPaddingSize))
+	}
+	s.videoValue = canvas.NewText("", color.White)
+	s.videoValue.TextStyle = fyne.TextStyle{Bold: true}
+	s.videoValue.TextSize = 20
+	videoToggle := NewSquareIconStickyButton(buttonSize, buttonPaddingSize, theme.MediaVideoIcon(), func(wg *sync.WaitGroup) {
+		s.paramsMtx.Lock()
+		s.video = !s.video
+		s.paramsMtx.Unlock()
+		s.update()
+		wg.Done()
+	})
+	rows = append(rows, container.NewHBox(
+		container.NewVBox(layout.NewSpacer(), canvas.NewText("Assemble video", color.White), s.videoValue, layout.NewSpacer()),
+		layout.NewSpacer(),
+		videoToggle,
+	))
+	backButton := NewSquareIconStickyButton(buttonSize, buttonPaddingSize, theme.NavigateBackIcon(), func(wg *sync.WaitGroup) {
+		nav.ShowMain()
+		wg.Done()
+	})
+	timelapseButton := NewSquareIconStickyButton(buttonSize, buttonPaddingSize, theme.HistoryIcon(), func(wg *sync.WaitGroup) {
+		s.start(irnc.SequenceTimelapse)
+		wg.Done()
+	})
+	burstButton := NewSquareIconStickyButton(buttonSize, buttonPaddingSize, theme.MediaFastForwardIcon(), func(wg *sync.WaitGroup) {
+		s.start(irnc.SequenceBurst)
+		wg.Done()
+	})
+	stopButton := NewSquareIconStickyButton(buttonSize, buttonPaddingSize, theme.MediaStopIcon(), func(wg *sync.WaitGroup) {
+		// button stays pressed until frames and videos are saved
+		go func() {
+			err := irnc.StopSequence()
+			if err != nil {
+				s.status.SetText(err.Error())
+			} else {
+				s.update()
+			}
+			wg.Done()
+		}()
+	})
+	s.status = widget.NewLabel("")
+	s.status.Wrapping = fyne.TextWrapWord
+	s.Content = container.NewBorder(
+		container.NewBorder(nil, nil, backButton, container.NewHBox(timelapseButton, burstButton, stopButton), s.status),
+		nil, nil, nil,
+		container.NewVScroll(container.NewVBox(rows...)),
+	)
+	return s
+}
+
+// Create row with label, value and -/+ buttons
+func (s *sequenceScreen) newControlRow(control *presetControl, buttonSize, buttonPaddingSize float32) fyne.CanvasObject {
+	label := canvas.NewText(control.label, color.White)
+	control.value = canvas.NewText("", color.White)
+	control.value.TextStyle = fyne.TextStyle{Bold: true}
+	control.value.TextSize = 20
+	decrease := NewSquareIconStickyButton(buttonSize, buttonPaddingSize, theme.ContentRemoveIcon(), func(wg *sync.WaitGroup) {
+		s.change(control, -1)
+		wg.Done()
+	})
+	increase := NewSquareIconStickyButton(buttonSize, buttonPaddingSize, theme.ContentAddIcon(), func(wg *sync.WaitGroup) {
+		s.change(control, 1)
+		wg.Done()
+	})
+	return container.NewHBox(
+		container.NewVBox(layout.NewSpacer(), label, control.value, layout.NewSpacer()),
+		layout.NewSpacer(),
+		decrease,
+		increase,
+	)
+}
+
+// Move to neighbouring preset within bounds
+func (s *sequenceScreen) change(control *presetControl, delta int) {
+	s.paramsMtx.Lock()
+	index := control.index + delta
+	if index >= 0 && index < len(control.presets) { control.index = index }
+	s.paramsMtx.Unlock()
+	s.update()
+}
+
+// Start sequence with chosen parameters and return to live preview showing its progress
+func (s *sequenceScreen) start(mode irnc.SequenceMode) {
+	s.paramsMtx.Lock()
+	req := irnc.SequenceRequest{
+		Mode: mode,
+		IntervalSec: float64(s.interval.presets[s.interval.index]),
+		DurationSec: uint(s.duration.presets[s.duration.index] * 60),
+		Count: uint(s.count.presets[s.count.index]),
+		Video: s.video,
+	}
+	s.paramsMtx.Unlock()
+	_, err := irnc.StartSequence(req)
+	if err != nil {
+		s.status.SetText(err.Error())
+		return
+	}
+	s.nav.ShowMain()
+}
+
+// Show chosen values and current sequence
+func (s *sequenceScreen) update() {
+	s.paramsMtx.Lock()
+	for _, control := range []*presetControl{s.interval, s.duration, s.count} {
+		control.value.Text = control.format(control.presets[control.index])
+		control.value.Refresh()
+	}
+	s.videoValue.Text = "Off"
+	if s.video { s.videoValue.Text = "On" }
+	s.videoValue.Refresh()
+	s.paramsMtx.Unlock()
+	status := irnc.GetSequenceStatus()
+	if status.Active {
+		s.status.SetText(fmt.Sprintf("%s in progress: %d pairs taken", status.Mode, status.Taken))
+	} else {
+		s.status.SetText("Start timelapse or burst of N+IR pairs")
+	}
+}
+
+// Show screen with chosen values
+func (s *sequenceScreen) Show() {
+	s.update()
+	s.nav.Show(s.Content)
+}
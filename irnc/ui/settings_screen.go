@@ -0,0 +1,180 @@
+package ui
+
+import (
+	"fmt"
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/canvas"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/layout"
+	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
+	"image/color"
+	"irnc"
+	"strings"
+	"sync"
+)
+
+// Numeric setting changed by large -/+ buttons in fixed steps within bounds
+type settingControl struct {
+	label string
+	step, min, max int
+	get func(*irnc.Settings) int
+	set func(*irnc.Settings, int)
+	format func(int) string
+	value *canvas.Text
+}
+
+// Screen editing settings draft, which is validated and applied as a whole
+type settingsScreen struct {
+	nav *screenNavigator
+	draft irnc.Settings
+	draftMtx sync.Mutex
+	controls []*settingControl
+	status *widget.Label
+	Content fyne.CanvasObject
+}
+
+// Format value with unit
+func withUnit(unit string) func(int) string {
+	return func(value int) string { return fmt.Sprintf("%d %s", value, unit) }
+}
+
+// Factory function for settingsScreen
+func newSettingsScreen(nav *screenNavigator, buttonSize, buttonPaddingSize float32) *settingsScreen {
+	s := &settingsScreen{nav: nav}
+	s.controls = []*settingControl{
+		{label: "IR palette", step: 1, min: 0, max: irnc.MaxIRColorSchemeNumber,
+			get: func(st *irnc.Settings) int { return int(st.IRColorScheme) },
+			set: func(st *irnc.Settings, v int) { st.IRColorScheme = uint(v) },
+			format: func(v int) string { return fmt.Sprintf("%d", v) }},
+		{label: "Zoom", step: 25, min: irnc.MinZoomPercent, max: irnc.MaxZoomPercent,
+			get: func(st *irnc.Settings) int { return int(st.Live.ZoomPercent) },
+			set: func(st *irnc.Settings, v int) { st.Live.ZoomPercent = uint(v) },
+			format: withUnit("%")},
+		{label: "Preview refresh", step: 1, min: 1, max: 30,
+			get: func(st *irnc.Settings) int { return int(st.Live.PreviewFramerate) },
+			set: func(st *irnc.Settings, v int) { st.Live.PreviewFramerate = uint(v) },
+			format: withUnit("fps")},
+		{label: "Video duration", step: 10, min: 10, max: 600,
+			get: func(st *irnc.Settings) int { return int(st.Live.VideoDurationSec) },
+			set: func(st *irnc.Settings, v int) { st.Live.VideoDurationSec = uint(v) },
+			format: withUnit("s")},
+		{label: "Camera framerate", step: 1, min: 1, max: 30,
+			get: func(st *irnc.Settings) int { return int(st.Framerate) },
+			set: func(st *irnc.Settings, v int) { st.Framerate = uint(v) },
+			format: withUnit("fps")},
+	}
+	for _, camPair := range []struct{name string; settings func(*irnc.Settings) *irnc.CameraSettings}{
+		{"N", func(st *irnc.Settings) *irnc.CameraSettings { return &st.N }},
+		{"IR", func(st *irnc.Settings) *irnc.CameraSettings { return &st.IR }},
+	} {
+		cam := camPair.settings
+		s.controls = append(s.controls,
+			&settingControl{label: camPair.name + " rotation", step: 90, min: 0, max: 270,
+				get: func(st *irnc.Settings) int { return cam(st).RotationDegree },
+				set: func(st *irnc.Settings, v int) { cam(st).RotationDegree = v },
+				format: withUnit("deg")},
+			&settingControl{label: camPair.name + " bitrate", step: 1000000, min: 1000000, max: 25000000,
+				get: func(st *irnc.Settings) int { return int(cam(st).Bitrate) },
+				set: func(st *irnc.Settings, v int) { cam(st).Bitrate = uint(v) },
+				format: func(v int) string { return fmt.Sprintf("%d Mbit/s", v / 1000000) }},
+			&settingControl{label: camPair.name + " preview density", step: 1, min: 1, max: 4,
+				get: func(st *irnc.Settings) int { return int(cam(st).PreviewPixelDensity) },
+				set: func(st *irnc.Settings, v int) { cam(st).PreviewPixelDensity = uint(v) },
+				format: withUnit("x")},
+		)
+	}
+	
+	var rows []fyne.CanvasObject
+	for _, control := range s.controls {
+		rows = append(rows, s.newControlRow(control, buttonSize, buttonPaddingSize))
+	}
+	backButton := NewSquareIconStickyButton(buttonSize, buttonPaddingSize, theme.NavigateBackIcon(), func(wg *sync.WaitGroup) {
+		nav.ShowMain()
+		wg.Done()
+	})
+	applyButton := NewSquareIconStickyButton(buttonSize, buttonPaddingSize, theme.ConfirmIcon(), func(wg *sync.WaitGroup) {
+		// cameras restart takes a while, button stays pressed until it's done
+		s.apply()
+		wg.Done()
+	})
+	s.status = widget.NewLabel("")
+	s.status.Wrapping = fyne.TextWrapWord
+	s.Content = container.NewBorder(
+		container.NewBorder(nil, nil, backButton, applyButton, s.status),
+		nil, nil, nil,
+		container.NewVScroll(container.NewVBox(rows...)),
+	)
+	return s
+}
+
+// Create row with label, value and -/+ buttons
+func (s *settingsScreen) newControlRow(control *settingControl, buttonSize, buttonPaddingSize float32) fyne.CanvasObject {
+	label := canvas.NewText(control.label, color.White)
+	control.value = canvas.NewText("", color.White)
+	control.value.TextStyle = fyne.TextStyle{Bold: true}
+	control.value.TextSize = 20
+	decrease := NewSquareIconStickyButton(buttonSize, buttonPaddingSize, theme.ContentRemoveIcon(), func(wg *sync.WaitGroup) {
+		s.change(control, -control.step)
+		wg.Done()
+	})
+	increase := NewSquareIconStickyButton(buttonSize, buttonPaddingSize, theme.ContentAddIcon(), func(wg *sync.WaitGroup) {
+		s.change(control, control.step)
+		wg.Done()
+	})
+	return container.NewHBox(
+		container.NewVBox(layout.NewSpacer(), label, control.value, layout.NewSpacer()),
+		layout.NewSpacer(),
+		decrease,
+		increase,
+	)
+}
+
+// Change draft value within bounds
+func (s *settingsScreen) change(control *settingControl, delta int) {
+	s.draftMtx.Lock()
+	value := control.get(&s.draft) + delta
+	if value < control.min { value = control.min }
+	if value > control.max { value = control.max }
+	control.set(&s.draft, value)
+	s.draftMtx.Unlock()
+	s.updateValue(control)
+}
+
+// Show draft value of control
+func (s *settingsScreen) updateValue(control *settingControl) {
+	s.draftMtx.Lock()
+	control.value.Text = control.format(control.get(&s.draft))
+	s.draftMtx.Unlock()
+	control.value.Refresh()
+}
+
+// Validate and apply draft, report result
+func (s *settingsScreen) apply() {
+	s.status.SetText("Applying...")
+	s.draftMtx.Lock()
+	draft := s.draft
+	s.draftMtx.Unlock()
+	errs := irnc.ApplySettings(draft)
+	if len(errs) == 0 {
+		s.status.SetText("Settings applied")
+		return
+	}
+	var messages []string
+	for _, err := range errs {
+		messages = append(messages, err.Error())
+	}
+	s.status.SetText(strings.Join(messages, "\n"))
+}
+
+// Show screen with current settings as draft
+func (s *settingsScreen) Show() {
+	s.draftMtx.Lock()
+	s.draft = irnc.GetSettings()
+	s.draftMtx.Unlock()
+	for _, control := range s.controls {
+		s.updateValue(control)
+	}
+	s.status.SetText("Changes take effect after confirmation")
+	s.nav.Show(s.Content)
+}
@@ -0,0 +1,78 @@
+package ui
+
+import (
+	"errors"
+	"fmt"
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/driver/desktop"
+	"irnc"
+	"log"
+)
+
+// Action triggered by key press
+type shortcutAction struct {
+	name string
+	action func() error
+	// ignored on other screens than live preview
+	mainOnly bool
+}
+
+// Key bindings: letters for desktop keyboard, digits for USB keypad (keypad digits are reported as regular ones)
+func newShortcuts(liveScreen *mainScreen, quit func()) map[fyne.KeyName]shortcutAction {
+	snapshot := shortcutAction{"snapshot", func() error {
+		_, errs := irnc.StartSnapshot()
+		if len(errs) > 0 { return errors.New(fmt.Sprint(errs)) }
+		return nil
+	}, false}
+	record := shortcutAction{"record toggle", irnc.ToggleRecording, false}
+	palette := shortcutAction{"palette cycle", irnc.CycleIRColorScheme, false}
+	nextLayout := shortcutAction{"next layout", func() error {
+		liveScreen.cycleLayout(1)
+		return nil
+	}, true}
+	previousLayout := shortcutAction{"previous layout", func() error {
+		liveScreen.cycleLayout(-1)
+		return nil
+	}, true}
+	// single deliberate key, Esc is too easy to hit when leaving other screens
+	exit := shortcutAction{"exit", func() error {
+		quit()
+		return nil
+	}, false}
+	return map[fyne.KeyName]shortcutAction{
+		fyne.KeySpace: snapshot,
+		fyne.Key1: snapshot,
+		fyne.KeyR: record,
+		fyne.Key2: record,
+		fyne.KeyP: palette,
+		fyne.Key3: palette,
+		fyne.KeyL: nextLayout,
+		fyne.KeyRight: nextLayout,
+		fyne.Key6: nextLayout,
+		fyne.KeyLeft: previousLayout,
+		fyne.Key4: previousLayout,
+		fyne.KeyQ: exit,
+	}
+}
+
+// Bind shortcuts to window keyboard (no-op on platforms without physical keyboard support)
+func bindShortcuts(w fyne.Window, nav *screenNavigator, shortcuts map[fyne.KeyName]shortcutAction) {
+	deskCanvas, ok := w.Canvas().(desktop.Canvas)
+	if !ok {
+		log.Println("Keyboard shortcuts are not supported")
+		return
+	}
+	deskCanvas.SetOnKeyDown(func(e *fyne.KeyEvent) {
+		shortcut, ok := shortcuts[e.Name]
+		if !ok || (shortcut.mainOnly && !nav.IsMainShown()) { return }
+		// key press on dimmed screen only wakes it
+		dimmed := irnc.BacklightDimmed()
+		irnc.NotifyUserActivity()
+		if dimmed { return }
+		go func() {
+			log.Println("Key", e.Name, shortcut.name)
+			err := shortcut.action()
+			if err != nil { log.Printf("Key %s %s error: %v", e.Name, shortcut.name, err) }
+		}()
+	})
+}
@@ -1,4 +1,4 @@
-package irnc
+package ui
 
 import (
 	"fyne.io/fyne/v2"
@@ -6,6 +6,7 @@ import (
 	"fyne.io/fyne/v2/layout"
 	"fyne.io/fyne/v2/widget"
 	"image/color"
+	"irnc"
 	"sync"
 	"time"
 )
@@ -64,6 +65,12 @@ func (b *SquareIconStickyButton) CreateRenderer() fyne.WidgetRenderer {
 	return r
 }
 
+// Replace icon of button
+func (b *SquareIconStickyButton) SetIcon(icon fyne.Resource) {
+	b.Icon = icon
+	b.Refresh()
+}
+
 // Minimal size
 func (b *SquareIconStickyButton) MinSize() fyne.Size {
 	return fyne.Size{b.MinDim, b.MinDim}
@@ -71,6 +78,7 @@ func (b *SquareIconStickyButton) MinSize() fyne.Size {
 
 // Tapped event handler
 func (b *SquareIconStickyButton) Tapped(*fyne.PointEvent) {
+	irnc.NotifyUserActivity()
 	if b.OnTapped == nil { return }
 	b.tapMtx.Lock()
 	if b.tapVisual != nil {
@@ -133,6 +141,7 @@ func (r *buttonRenderer) Objects() []fyne.CanvasObject {
 
 // Refresh button
 func (r *buttonRenderer) Refresh() {
+	r.icon.Resource = r.button.Icon
 	r.icon.Refresh()
 	r.background.Refresh()
 	r.border.Refresh()
@@ -0,0 +1,56 @@
+package ui
+
+import (
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/widget"
+	"irnc"
+)
+
+// Horizontal drag distance recognized as swipe
+const swipeMinDistance = 50
+
+// Wraps content and turns horizontal drags over it into swipe callbacks
+type SwipeArea struct {
+	widget.BaseWidget
+	content fyne.CanvasObject
+	dragDX float32
+	
+	// finger moved to the left (next item)
+	OnSwipeLeft func() `json:"-"`
+	// finger moved to the right (previous item)
+	OnSwipeRight func() `json:"-"`
+}
+
+// Factory function for SwipeArea widgets
+func NewSwipeArea(content fyne.CanvasObject, onSwipeLeft, onSwipeRight func()) *SwipeArea {
+	area := &SwipeArea{
+		content: content,
+		OnSwipeLeft: onSwipeLeft,
+		OnSwipeRight: onSwipeRight,
+	}
+	area.ExtendBaseWidget(area)
+	return area
+}
+
+// Link widget to its renderer
+func (a *SwipeArea) CreateRenderer() fyne.WidgetRenderer {
+	return widget.NewSimpleRenderer(a.content)
+}
+
+// Drag event handler
+func (a *SwipeArea) Dragged(e *fyne.DragEvent) {
+	irnc.NotifyUserActivity()
+	a.dragDX += e.Dragged.DX
+}
+
+// Drag end event handler
+func (a *SwipeArea) DragEnd() {
+	dx := a.dragDX
+	a.dragDX = 0
+	switch {
+		case dx <= -swipeMinDistance && a.OnSwipeLeft != nil:
+			a.OnSwipeLeft()
+		case dx >= swipeMinDistance && a.OnSwipeRight != nil:
+			a.OnSwipeRight()
+	}
+}
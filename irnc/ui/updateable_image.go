@@ -1,4 +1,4 @@
-package irnc
+package ui
 
 import (
 	"fyne.io/fyne/v2"
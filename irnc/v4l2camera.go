@@ -5,10 +5,10 @@ import (
 	"errors"
 	"fmt"
 	"image"
-	"image/png"
 	"log"
 	"os"
 	"sync"
+	"sync/atomic"
 	"time"
 	v4l2 "github.com/thinkski/go-v4l2"
 )
@@ -28,19 +28,75 @@ type frameReceivingCommunicationPack struct {
 	ReceivingDoneCh <-chan struct{}
 }
 
+var frameReceiverCounter uint64
+
+// Streaming frame source of camera (v4l2 device, replaced by fake in tests)
+type captureDevice interface {
+	// buffers must be released after use, capacity equals number of device buffers
+	Frames() <-chan v4l2.Buffer
+	Stop() error
+	Close() error
+}
+
+// Real v4l2 device
+type v4l2CaptureDevice struct {
+	*v4l2.Device
+}
+
+// Channel of dequeued device buffers
+func (d v4l2CaptureDevice) Frames() <-chan v4l2.Buffer {
+	return d.C
+}
+
 type V4L2Camera struct {
 	bitrate uint
+	// written to image metadata
+	cameraMake, cameraModel string
 	decoder VideoDecoder
-	device *v4l2.Device
+	device captureDevice
 	deviceNumber uint
+	// opens device streaming frames of given size, v4l2 device of deviceNumber if nil
+	openDevice func(width, height uint) (captureDevice, error)
 	disposition CameraDisposition
 	frameReceivers map[string]frameReceivingCommunicationPack
 	framerate uint
 	lastImageCh chan image.Image
+	name string
 	previewWidth, previewHeight uint
 	previewPixelDensity uint
 	recordWidth, recordHeight uint
+	snapshotConfig SnapshotConfig
+	// decoder for full resolution stills (set together with stillRequestCh)
+	newStillDecoder func() VideoDecoder
+	// served by frame loop, nil if stills aren't supported
+	stillRequestCh chan chan stillResult
+	// recordings encoding last images, stills would freeze them
+	videoRecordings int32
+	// tracks goroutines holding device/decoder until start context is done
+	releaseWg sync.WaitGroup
 	stateMtx sync.Mutex
+	lastFrameTime time.Time
+	fps float64
+	fpsWindowStart time.Time
+	fpsWindowFrames uint
+	// frames are paused deliberately, so stall detection is suspended
+	stillInProgress bool
+	statsMtx sync.Mutex
+}
+
+const lastImageTimeout = time.Second
+const fpsWindow = time.Second
+// limit for reconfiguration and first full resolution picture
+const stillCaptureTimeout = 5 * time.Second
+// pictures skipped after device start while exposure settles
+const stillWarmupPictures = 5
+// limit for collecting device buffers before stream stop
+const deviceStopTimeout = time.Second
+
+// Full resolution frame or error of still capture
+type stillResult struct {
+	img image.Image
+	err error
 }
 
 // Do basic consistency checks for configuration values (camera/tool-specific)
@@ -66,16 +122,74 @@ func (v4l2c *V4L2Camera) VerifyConfiguration() (res []error) {
 	if v4l2c.framerate == 0 {
 		res = append(res, errors.New("Framerate must be positive"))
 	}
+	res = append(res, v4l2c.snapshotConfig.Verify()...)
+	if v4l2c.snapshotConfig.FullResolution && v4l2c.stillRequestCh == nil {
+		res = append(res, errors.New(fmt.Sprintf("Full resolution stills aren't supported by %s (frames have device resolution already)", v4l2c.name)))
+	}
 	return
 }
 
+// Camera name for logs and status
+func (v4l2c *V4L2Camera) Name() string {
+	return v4l2c.name
+}
+
+// Time of last frame received from device (now while full resolution still is taken, so paused preview isn't reported as stall)
+func (v4l2c *V4L2Camera) LastFrameTime() time.Time {
+	v4l2c.statsMtx.Lock()
+	defer v4l2c.statsMtx.Unlock()
+	if v4l2c.stillInProgress { return time.Now() }
+	return v4l2c.lastFrameTime
+}
+
+// Suspend or resume stall detection, frame age starts from still end
+func (v4l2c *V4L2Camera) setStillInProgress(inProgress bool) {
+	v4l2c.statsMtx.Lock()
+	defer v4l2c.statsMtx.Unlock()
+	v4l2c.stillInProgress = inProgress
+	if !inProgress { v4l2c.lastFrameTime = time.Now() }
+}
+
+// Frames per second received from device recently (0 if frames stopped)
+func (v4l2c *V4L2Camera) FPS() float64 {
+	v4l2c.statsMtx.Lock()
+	defer v4l2c.statsMtx.Unlock()
+	if time.Since(v4l2c.lastFrameTime) > fpsWindow { return 0 }
+	return v4l2c.fps
+}
+
+// Update frame statistics on frame arrival
+func (v4l2c *V4L2Camera) countFrame() {
+	v4l2c.statsMtx.Lock()
+	defer v4l2c.statsMtx.Unlock()
+	now := time.Now()
+	v4l2c.lastFrameTime = now
+	v4l2c.fpsWindowFrames++
+	if elapsed := now.Sub(v4l2c.fpsWindowStart); elapsed >= fpsWindow {
+		v4l2c.fps = float64(v4l2c.fpsWindowFrames) / elapsed.Seconds()
+		v4l2c.fpsWindowStart = now
+		v4l2c.fpsWindowFrames = 0
+	}
+}
+
+// Get last decoded image, fail if camera doesn't provide images
+func (v4l2c *V4L2Camera) getLastImage() (image.Image, error) {
+	select {
+		case img := <-v4l2c.lastImageCh:
+			if img == nil { return nil, errors.New("No image available") }
+			return img, nil
+		case <-time.After(lastImageTimeout):
+			return nil, errors.New(fmt.Sprintf("%s provides no images", v4l2c.name))
+	}
+}
+
 // Configure channel which will inexhaustibly return last video decode result as image
-func (v4l2c *V4L2Camera) setupImageChannel(imageCh chan<- image.Image, ctx context.Context) {
+func (v4l2c *V4L2Camera) setupImageChannel(imageCh chan<- image.Image, ctx context.Context) error {
+	err := v4l2c.decoder.Init()
+	if err != nil { return errors.New(fmt.Sprintf("Decoder initialization error: %v", err)) }
 	frameCh := make(chan frameWithWg)
 	v4l2c.frameReceivers["lastImage"] = frameReceivingCommunicationPack{FrameCh: frameCh, ReceivingDoneCh: ctx.Done()}
 	
-	err := v4l2c.decoder.Init()
-	if err != nil { log.Panic("Decoder initialization error:", err) }
 	updatedImageCh := make(chan image.Image)
 	go func() {
 		var img image.Image
@@ -94,7 +208,9 @@ func (v4l2c *V4L2Camera) setupImageChannel(imageCh chan<- image.Image, ctx conte
 		}
 	}()
 	
+	v4l2c.releaseWg.Add(1)
 	go func() {
+		defer v4l2c.releaseWg.Done()
 		defer v4l2c.decoder.Destroy()
 		for {
 			select {
@@ -107,13 +223,18 @@ func (v4l2c *V4L2Camera) setupImageChannel(imageCh chan<- image.Image, ctx conte
 						continue
 					}
 					if err == nil {
-						updatedImageCh<- img
+						select {
+							case <-ctx.Done():
+								return
+							case updatedImageCh<- img:
+						}
 					} else {
 						log.Println("LastImage update error:", err)
 					}
 			}
 		}
 	}()
+	return nil
 }
 
 // Add frames handler to receivers list
@@ -130,32 +251,39 @@ func (v4l2c *V4L2Camera) removeFrameReceiver(id string) {
 	delete(v4l2c.frameReceivers, id)
 }
 
-// Configure and open camera device
-func (v4l2c *V4L2Camera) Start(ctx context.Context) {
+// Configure and open camera device, frames are received until context is done
+func (v4l2c *V4L2Camera) Start(ctx context.Context) error {
 	v4l2c.stateMtx.Lock()
 	defer v4l2c.stateMtx.Unlock()
 	
-	v4l2c.setupImageChannel(v4l2c.lastImageCh, ctx)
-	var err error
-	v4l2c.device, err = v4l2.Open(fmt.Sprintf("/dev/video%d", v4l2c.deviceNumber))
-	if err != nil { log.Panic("V4L2 device opening error:", err) }
-	
-	v4l2c.device.SetPixelFormat(int(v4l2c.recordWidth), int(v4l2c.recordHeight), v4l2.V4L2_PIX_FMT_H264)
-	v4l2c.device.SetBitrate(int32(v4l2c.bitrate))
-	v4l2c.device.Start()
+	err := v4l2c.setupImageChannel(v4l2c.lastImageCh, ctx)
+	if err != nil { return err }
+	v4l2c.device, err = v4l2c.startDevice(v4l2c.recordWidth, v4l2c.recordHeight)
+	if err != nil { return err }
 	
+	v4l2c.releaseWg.Add(1)
 	go func() {
+		defer v4l2c.releaseWg.Done()
 		for {
 			var frame v4l2.Buffer
 			select {
 				case <-ctx.Done():
 					v4l2c.stateMtx.Lock()
 					defer v4l2c.stateMtx.Unlock()
-					err := v4l2c.device.Close()
-					if err != nil { log.Println("V4L2 device closing error:", err) }
+					closeDevice(v4l2c.device)
 					return
-				case frame = <-v4l2c.device.C:
+				case resultCh := <-v4l2c.stillRequestCh:
+					// frames aren't dispatched meanwhile, receivers keep last image
+					img, err := v4l2c.captureStill()
+					resultCh<- stillResult{img, err}
+					if v4l2c.device == nil {
+						// record resolution couldn't be restored, supervisor restarts camera once frames are missing
+						return
+					}
+					continue
+				case frame = <-v4l2c.device.Frames():
 			}
+			v4l2c.countFrame()
 			
 			var frameHandlersWg sync.WaitGroup
 			v4l2c.stateMtx.Lock()
@@ -176,18 +304,121 @@ func (v4l2c *V4L2Camera) Start(ctx context.Context) {
 			frame.Release()
 		}
 	}()
+	return nil
 }
 
-// Get cropped photo suitable for preview
-func (v4l2c *V4L2Camera) Preview() (preview image.Image, err error) {
-	originalImage := <-v4l2c.lastImageCh
-	if originalImage == nil {
-		err = errors.New("No preview available")
-		return
+// Open v4l2 device and start H264 stream of given frame size
+func (v4l2c *V4L2Camera) openV4L2Device(width, height uint) (captureDevice, error) {
+	device, err := v4l2.Open(fmt.Sprintf("/dev/video%d", v4l2c.deviceNumber))
+	if err != nil { return nil, errors.New(fmt.Sprintf("V4L2 device opening error: %v", err)) }
+	
+	device.SetPixelFormat(int(width), int(height), v4l2.V4L2_PIX_FMT_H264)
+	device.SetBitrate(int32(v4l2c.bitrate))
+	// SPS/PPS before every GoP, so streams can be joined at any time (not supported by loopback devices)
+	device.SetRepeatSequenceHeader(true)
+	err = device.Start()
+	if err != nil {
+		device.Close()
+		return nil, errors.New(fmt.Sprintf("V4L2 device starting error: %v", err))
 	}
+	return v4l2CaptureDevice{device}, nil
+}
+
+// Open device streaming frames of given size
+func (v4l2c *V4L2Camera) startDevice(width, height uint) (captureDevice, error) {
+	if v4l2c.openDevice != nil { return v4l2c.openDevice(width, height) }
+	return v4l2c.openV4L2Device(width, height)
+}
+
+// Stop stream and close device once all its buffers are held (not released), so dequeuing goroutine of v4l2 library waits in driver and can't touch buffers being unmapped
+func closeDevice(device captureDevice) {
+	timeout := time.After(deviceStopTimeout)
+	collecting:
+	for held := 0; held < cap(device.Frames()); held++ {
+		select {
+			case <-device.Frames():
+			case <-timeout:
+				log.Println("V4L2 device buffers aren't returned, device is stopped anyway")
+				break collecting
+		}
+	}
+	err := device.Stop()
+	if err != nil { log.Println("V4L2 device stopping error:", err) }
+	err = device.Close()
+	if err != nil { log.Println("V4L2 device closing error:", err) }
+}
+
+// Close device and open it again streaming frames of given size (device is nil if opening fails)
+func (v4l2c *V4L2Camera) reopenDevice(width, height uint) error {
+	if v4l2c.device != nil { closeDevice(v4l2c.device) }
+	var err error
+	v4l2c.device, err = v4l2c.startDevice(width, height)
+	return err
+}
+
+// Switch device to max resolution, decode single picture and switch back to record resolution (runs in frame loop)
+func (v4l2c *V4L2Camera) captureStill() (img image.Image, err error) {
+	started := time.Now()
+	v4l2c.setStillInProgress(true)
+	defer func() {
+		restoreErr := v4l2c.reopenDevice(v4l2c.recordWidth, v4l2c.recordHeight)
+		if restoreErr != nil { log.Printf("%s preview restoring error: %v", v4l2c.name, restoreErr) }
+		v4l2c.setStillInProgress(false)
+		if err == nil { log.Printf("%s full resolution still captured in %v", v4l2c.name, time.Since(started).Round(time.Millisecond)) }
+	}()
+	err = v4l2c.reopenDevice(v4l2c.disposition.Width, v4l2c.disposition.Height)
+	if err != nil { return nil, errors.New(fmt.Sprintf("Full resolution configuration error: %v", err)) }
+	decoder := v4l2c.newStillDecoder()
+	err = decoder.Init()
+	if err != nil { return nil, errors.New(fmt.Sprintf("Decoder initialization error: %v", err)) }
+	defer decoder.Destroy()
+	timeout := time.After(stillCaptureTimeout)
+	pictures := 0
+	for {
+		select {
+			case <-timeout:
+				return nil, errors.New("No full resolution picture received")
+			case frame := <-v4l2c.device.Frames():
+				picture, err := decoder.Decode(frame.Data)
+				if err == nil {
+					pictures++
+					if pictures > stillWarmupPictures { img = cloneImage(picture) }
+				}
+				frame.Release()
+				if _, noPicture := err.(NoPictureError); err != nil && !noPicture { return nil, err }
+				if img != nil { return img, nil }
+		}
+	}
+}
+
+// Capture frame at max device resolution, preview (and streams) pause meanwhile
+func (v4l2c *V4L2Camera) CaptureStill() (image.Image, error) {
+	if v4l2c.stillRequestCh == nil { return nil, errors.New(fmt.Sprintf("%s doesn't support full resolution stills", v4l2c.name)) }
+	if atomic.LoadInt32(&v4l2c.videoRecordings) > 0 { return nil, errors.New("Full resolution stills aren't available during recording") }
+	resultCh := make(chan stillResult, 1)
+	select {
+		case v4l2c.stillRequestCh<- resultCh:
+		case <-time.After(lastImageTimeout):
+			return nil, errors.New(fmt.Sprintf("%s isn't streaming", v4l2c.name))
+	}
+	result := <-resultCh
+	return result.img, result.err
+}
+
+// Wait until device and decoder are released after start context is done
+func (v4l2c *V4L2Camera) Wait() {
+	v4l2c.releaseWg.Wait()
+}
+
+// Get cropped (and zoomed by live configuration) photo suitable for preview
+func (v4l2c *V4L2Camera) Preview() (preview image.Image, err error) {
+	originalImage, err := v4l2c.getLastImage()
+	if err != nil { return }
 	originalBounds := originalImage.Bounds()
-	pw := v4l2c.previewWidth * v4l2c.previewPixelDensity
-	ph := v4l2c.previewHeight * v4l2c.previewPixelDensity
+	zoomPercent := GetLiveConfig().ZoomPercent
+	if zoomPercent < MinZoomPercent { zoomPercent = MinZoomPercent }
+	pw := v4l2c.previewWidth * v4l2c.previewPixelDensity * MinZoomPercent / zoomPercent
+	ph := v4l2c.previewHeight * v4l2c.previewPixelDensity * MinZoomPercent / zoomPercent
 	minPreviewX := (originalBounds.Max.X - originalBounds.Min.X - int(pw))/2 + originalBounds.Min.X
 	minPreviewY := (originalBounds.Max.Y - originalBounds.Min.Y - int(ph))/2 + originalBounds.Min.Y
 	
@@ -204,32 +435,45 @@ func (v4l2c *V4L2Camera) Preview() (preview image.Image, err error) {
 	return
 }
 
-// Take single image from v4l2 video stream and save it to png file
-func (v4l2c *V4L2Camera) SavePngPhotoFromV4L2(filename string) error {
-	outputFile, err := os.Create(filename)
-	if err != nil { return err }
-	defer func() {
-		err = outputFile.Close()
-		if err != nil { log.Println("Snapshot file closing error:", err) }
-	}()
-	img := <-v4l2c.lastImageCh
-	if img == nil { return errors.New("No image available.") }
-	return png.Encode(outputFile, img)
+// Name of snapshot file with camera suffix and extension of configured format
+func (v4l2c *V4L2Camera) snapshotFileName(namePrefix, suffix string) string {
+	return fmt.Sprintf("%s_%s.%s", namePrefix, suffix, v4l2c.snapshotConfig.Extension())
 }
 
-// Take a photo and save it to file with given name prefix
-func (v4l2c *V4L2Camera) SaveSnapshot(namePrefix string) error {
-	return errors.New("*V4L2Camera.SaveSnapshot is unimplemented. Use SavePngPhotoFromV4L2 in embedders")
+// Copy single image from v4l2 video stream (or full resolution still if configured and preview frame isn't requested) with camera and capture metadata, it's encoded by Snapshot.Save
+func (v4l2c *V4L2Camera) GrabSnapshotFromV4L2(filename string, meta ImageMetadata, preview bool) (*Snapshot, error) {
+	var img image.Image
+	var err error
+	if v4l2c.snapshotConfig.FullResolution && !preview {
+		img, err = v4l2c.CaptureStill()
+		if err != nil { log.Printf("%s full resolution still error, preview frame is used: %v", v4l2c.name, err) }
+	}
+	if img == nil {
+		img, err = v4l2c.getLastImage()
+		if err != nil { return nil, err }
+		img = cloneImage(img)
+	}
+	meta.Make = v4l2c.cameraMake
+	meta.Model = v4l2c.cameraModel
+	meta.RotationDegree = v4l2c.disposition.RotationDegree
+	return &Snapshot{Filename: filename, Config: v4l2c.snapshotConfig, Image: img, Meta: meta}, nil
+}
+
+// Take a photo to be saved to file with given name prefix
+func (v4l2c *V4L2Camera) GrabSnapshot(namePrefix string, meta ImageMetadata, preview bool) (*Snapshot, error) {
+	return nil, errors.New("*V4L2Camera.GrabSnapshot is unimplemented. Use GrabSnapshotFromV4L2 in embedders")
 }
 
-// Record video from v4l2 video device to h264 file by encoding snapshot sequence
-func (v4l2c *V4L2Camera) SaveH264VideoFromV4L2(filename string, videoDuration time.Duration) error {
+// Record video from v4l2 video device to h264 file by encoding snapshot sequence (until duration passed or context cancelled)
+func (v4l2c *V4L2Camera) SaveH264VideoFromV4L2(ctx context.Context, filename string, videoDuration time.Duration) error {
 	outputFile, err := os.OpenFile(filename, os.O_RDWR|os.O_CREATE, 0755)
 	if err != nil { return err }
 	defer func() {
 		err = outputFile.Close()
 		if err != nil { log.Println("Video file closing error:", err) }
 	}()
+	atomic.AddInt32(&v4l2c.videoRecordings, 1)
+	defer atomic.AddInt32(&v4l2c.videoRecordings, -1)
 	
 	imagesToEncodeCh := make(chan image.Image)
 	encodedCh := SetupChannelEncoder(&H264Encoder{bitrate: v4l2c.bitrate, framerate: v4l2c.framerate}, imagesToEncodeCh)
@@ -243,6 +487,9 @@ func (v4l2c *V4L2Camera) SaveH264VideoFromV4L2(filename string, videoDuration ti
 				case <-videoEndCh:
 					close(imagesToEncodeCh)
 					return
+				case <-ctx.Done():
+					close(imagesToEncodeCh)
+					return
 			}
 		}
 	}()
@@ -253,10 +500,113 @@ func (v4l2c *V4L2Camera) SaveH264VideoFromV4L2(filename string, videoDuration ti
 		}
 		if err != nil { log.Println("Video file writing error:", err) }
 	}
-	return nil
+	return outputFile.Sync()
 }
 
 // Record video to file with given name prefix
-func (v4l2c *V4L2Camera) SaveVideo(namePrefix string, videoDuration time.Duration) error {
+func (v4l2c *V4L2Camera) SaveVideo(ctx context.Context, namePrefix string, videoDuration time.Duration) error {
 	return errors.New("*V4L2Camera.SaveVideo is unimplemented. Use SaveH264VideoFromV4L2 in embedders")
 }
+
+// Number of stream frames waiting for slow consumer before frames are dropped
+const streamBufferFrames = 8
+
+// Sender of H264 stream which never blocks camera, when consumer is behind frames are dropped until next keyframe (its decoder isn't fed broken references)
+type streamSender struct {
+	ch chan []byte
+	dropping bool
+}
+
+// Factory function for streamSender
+func newStreamSender() *streamSender {
+	return &streamSender{ch: make(chan []byte, streamBufferFrames)}
+}
+
+// Queue access unit for consumer or drop it
+func (s *streamSender) send(data []byte) {
+	if s.dropping && !isH264Keyframe(data) { return }
+	select {
+		case s.ch<- data:
+			s.dropping = false
+		default:
+			s.dropping = true
+	}
+}
+
+// Get copies of raw device frames (native H264 for hardware encoders) until context is done, frames are dropped for slow consumer
+func (v4l2c *V4L2Camera) StreamDeviceFrames(ctx context.Context) <-chan []byte {
+	id := fmt.Sprintf("stream%d", atomic.AddUint64(&frameReceiverCounter, 1))
+	frameCh := make(chan frameWithWg)
+	sender := newStreamSender()
+	v4l2c.addFrameReceiver(id, frameCh, ctx.Done())
+	go func() {
+		defer close(sender.ch)
+		defer v4l2c.removeFrameReceiver(id)
+		for {
+			select {
+				case <-ctx.Done():
+					return
+				case frame := <-frameCh:
+					// device buffer is reused after release, so data must be copied
+					data := make([]byte, len(frame.Frame.Data))
+					copy(data, frame.Frame.Data)
+					frame.FrameProcessed.Done()
+					// blocked consumer would hold next frame of preview, recording and snapshots
+					sender.send(data)
+			}
+		}
+	}()
+	return sender.ch
+}
+
+// Get H264 stream (Annex B access units, first one prefixed by SPS/PPS) by encoding last images until context is done, frames are dropped for slow consumer
+func (v4l2c *V4L2Camera) StreamEncodedImages(ctx context.Context) <-chan []byte {
+	imagesToEncodeCh := make(chan image.Image)
+	encoder := &H264Encoder{bitrate: v4l2c.bitrate, framerate: v4l2c.framerate, lowLatency: true}
+	encodedCh := SetupChannelEncoder(encoder, imagesToEncodeCh)
+	go func() {
+		defer close(imagesToEncodeCh)
+		for {
+			select {
+				case <-ctx.Done():
+					return
+				case img := <-v4l2c.lastImageCh:
+					imagesToEncodeCh<- ToYCbCr420(img)
+					time.Sleep(time.Second / time.Duration(v4l2c.framerate))
+			}
+		}
+	}()
+	sender := newStreamSender()
+	go func() {
+		defer close(sender.ch)
+		var header []byte
+		isHeader := true
+		for encoded := range encodedCh {
+			if encoded.Error != nil {
+				log.Println("Stream encoding error:", encoded.Error)
+				continue
+			}
+			if isHeader {
+				isHeader = false
+				header = append(header, encoded.Result...)
+				continue
+			}
+			data := encoded.Result
+			if header != nil {
+				data = append(header, data...)
+				header = nil
+			}
+			// after context is done encoder is only drained, so it can be flushed and destroyed
+			if ctx.Err() == nil {
+				// first access unit with parameter sets always fits empty buffer
+				sender.send(data)
+			}
+		}
+	}()
+	return sender.ch
+}
+
+// Get H264 stream from camera
+func (v4l2c *V4L2Camera) StreamH264(ctx context.Context) (<-chan []byte, error) {
+	return nil, errors.New("*V4L2Camera.StreamH264 is unimplemented. Use StreamDeviceFrames or StreamEncodedImages in embedders")
+}
@@ -0,0 +1,197 @@
+package irnc
+
+import (
+	"context"
+	"encoding/binary"
+	"image"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+	v4l2 "github.com/thinkski/go-v4l2"
+)
+
+// Device producing frames which carry their size, frames of reopened device may come late
+type fakeCaptureDevice struct {
+	frames chan v4l2.Buffer
+	stopCh chan struct{}
+	generatorDone chan struct{}
+	closed bool
+}
+
+// Factory function for fakeCaptureDevice, frames are generated until Stop
+func newFakeCaptureDevice(width, height uint, firstFrameDelay time.Duration) *fakeCaptureDevice {
+	d := &fakeCaptureDevice{frames: make(chan v4l2.Buffer, 2), stopCh: make(chan struct{}), generatorDone: make(chan struct{})}
+	go func() {
+		defer close(d.generatorDone)
+		delay := firstFrameDelay
+		for {
+			select {
+				case <-d.stopCh:
+					return
+				case <-time.After(delay):
+			}
+			delay = 5 * time.Millisecond
+			data := make([]byte, 8)
+			binary.BigEndian.PutUint32(data, uint32(width))
+			binary.BigEndian.PutUint32(data[4:], uint32(height))
+			select {
+				case <-d.stopCh:
+					return
+				case d.frames<- v4l2.Buffer{Data: data}:
+			}
+		}
+	}()
+	return d
+}
+
+func (d *fakeCaptureDevice) Frames() <-chan v4l2.Buffer {
+	return d.frames
+}
+
+func (d *fakeCaptureDevice) Stop() error {
+	close(d.stopCh)
+	<-d.generatorDone
+	return nil
+}
+
+func (d *fakeCaptureDevice) Close() error {
+	d.closed = true
+	return nil
+}
+
+// Decoder producing blank picture of size carried by frame
+type fakeSizeDecoder struct { }
+
+func (decoder *fakeSizeDecoder) Init() error {
+	return nil
+}
+
+func (decoder *fakeSizeDecoder) Decode(data []byte) (image.Image, error) {
+	width, height := binary.BigEndian.Uint32(data), binary.BigEndian.Uint32(data[4:])
+	return image.NewYCbCr(image.Rect(0, 0, int(width), int(height)), image.YCbCrSubsampleRatio420), nil
+}
+
+func (decoder *fakeSizeDecoder) Destroy() error {
+	return nil
+}
+
+func TestCaptureStill(t *testing.T) {
+	var devices []*fakeCaptureDevice
+	var sizes []image.Point
+	var devicesMtx sync.Mutex
+	cam := &V4L2Camera{
+		name: "TestCam",
+		decoder: &fakeSizeDecoder{},
+		disposition: CameraDisposition{Width: 320, Height: 240},
+		frameReceivers: make(map[string]frameReceivingCommunicationPack),
+		framerate: 30,
+		lastImageCh: make(chan image.Image),
+		recordWidth: 64,
+		recordHeight: 48,
+		snapshotConfig: SnapshotConfig{Format: "png", JPEGQuality: 90, PNGCompression: "default", FullResolution: true},
+		newStillDecoder: func() VideoDecoder { return &fakeSizeDecoder{} },
+		stillRequestCh: make(chan chan stillResult),
+		openDevice: func(width, height uint) (captureDevice, error) {
+			// full resolution stream starts slower than stall timeout of test
+			delay := time.Duration(0)
+			if width == 320 { delay = 300 * time.Millisecond }
+			device := newFakeCaptureDevice(width, height, delay)
+			devicesMtx.Lock()
+			defer devicesMtx.Unlock()
+			devices = append(devices, device)
+			sizes = append(sizes, image.Pt(int(width), int(height)))
+			return device, nil
+		},
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	err := cam.Start(ctx)
+	if err != nil { t.Fatal(err) }
+	img, err := cam.getLastImage()
+	if err != nil || img.Bounds().Dx() != 64 { t.Fatal("Preview frame expected, got", img, err) }
+
+	stillCh := make(chan stillResult, 1)
+	go func() {
+		img, err := cam.CaptureStill()
+		stillCh<- stillResult{img, err}
+	}()
+	// paused preview isn't a stall
+	var still stillResult
+	waiting:
+	for {
+		select {
+			case still = <-stillCh:
+				break waiting
+			case <-time.After(20 * time.Millisecond):
+				if age := time.Since(cam.LastFrameTime()); age > 100 * time.Millisecond { t.Fatal("Frames look stalled during still for", age) }
+		}
+	}
+	if still.err != nil || still.img.Bounds() != image.Rect(0, 0, 320, 240) { t.Fatal("Full resolution still expected, got", still.img, still.err) }
+	devicesMtx.Lock()
+	if len(sizes) != 3 || sizes[1] != image.Pt(320, 240) || sizes[2] != image.Pt(64, 48) || !devices[0].closed || !devices[1].closed {
+		t.Fatal("Device isn't reopened at full resolution and back, opened sizes:", sizes)
+	}
+	devicesMtx.Unlock()
+	// preview goes on at record resolution
+	frameTime := cam.LastFrameTime()
+	time.Sleep(50 * time.Millisecond)
+	if !cam.LastFrameTime().After(frameTime) { t.Fatal("Frames don't flow after still") }
+
+	snapshot, err := cam.GrabSnapshotFromV4L2("test_n.png", ImageMetadata{}, true)
+	if err != nil || snapshot.Image.Bounds().Dx() != 64 { t.Fatal("Preview snapshot expected, got", snapshot, err) }
+	atomic.StoreInt32(&cam.videoRecordings, 1)
+	if _, err = cam.CaptureStill(); err == nil { t.Fatal("Still is taken during recording") }
+	snapshot, err = cam.GrabSnapshotFromV4L2("test_n.png", ImageMetadata{}, false)
+	if err != nil || snapshot.Image.Bounds().Dx() != 64 { t.Fatal("Preview frame fallback expected, got", snapshot, err) }
+
+	cancel()
+	cam.Wait()
+	devicesMtx.Lock()
+	defer devicesMtx.Unlock()
+	if len(devices) != 3 || !devices[2].closed { t.Fatal("Device isn't closed after stop") }
+}
+
+func TestStreamSenderDropsUntilKeyframe(t *testing.T) {
+	keyframe, frame := []byte{0, 0, 0, 1, 0x65, 1}, []byte{0, 0, 1, 0x41, 2}
+	sender := newStreamSender()
+	for i := 0; i < streamBufferFrames + 3; i++ {
+		sender.send(frame)
+	}
+	<-sender.ch
+	// consumer catching up doesn't get frames referencing dropped ones
+	sender.send(frame)
+	sender.send(keyframe)
+	sender.send(frame)
+	var got [][]byte
+	for len(sender.ch) > 0 {
+		got = append(got, <-sender.ch)
+	}
+	if len(got) != streamBufferFrames || &got[len(got) - 1][0] != &keyframe[0] { t.Fatal("Stream isn't resumed from keyframe:", got) }
+}
+
+func TestStreamDeviceFramesSlowConsumer(t *testing.T) {
+	cam := &V4L2Camera{
+		name: "TestCam",
+		decoder: &fakeSizeDecoder{},
+		frameReceivers: make(map[string]frameReceivingCommunicationPack),
+		framerate: 30,
+		lastImageCh: make(chan image.Image),
+		recordWidth: 64,
+		recordHeight: 48,
+		stillRequestCh: make(chan chan stillResult),
+		openDevice: func(width, height uint) (captureDevice, error) {
+			return newFakeCaptureDevice(width, height, 0), nil
+		},
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cam.Wait()
+	defer cancel()
+	if err := cam.Start(ctx); err != nil { t.Fatal(err) }
+	// stream which is never read mustn't hold frames of camera
+	stream := cam.StreamDeviceFrames(ctx)
+	time.Sleep(50 * time.Millisecond)
+	frameTime := cam.LastFrameTime()
+	time.Sleep(100 * time.Millisecond)
+	if !cam.LastFrameTime().After(frameTime) { t.Fatal("Frames stall behind slow stream consumer") }
+	if len(stream) != streamBufferFrames { t.Fatal("Full stream buffer expected, got", len(stream)) }
+}
@@ -0,0 +1,165 @@
+package irnc
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+	"github.com/pion/webrtc/v3"
+	"github.com/pion/webrtc/v3/pkg/media"
+)
+
+// Minimal browser client: sends offer with receive-only video transceivers, shows both tracks
+const webRTCViewerPage = `<!DOCTYPE html>
+<html><head><title>IRNC</title><style>body{background:#000;margin:0}video{width:49%}</style></head>
+<body><video id="ir" autoplay muted playsinline></video><video id="n" autoplay muted playsinline></video>
+<script>
+const pc = new RTCPeerConnection();
+// tracks are matched by transceiver order, browsers don't keep sender's track ids
+const videoIDs = ["n", "ir"];
+const transceivers = videoIDs.map(() => pc.addTransceiver("video", {direction: "recvonly"}));
+pc.ontrack = e => {
+	const video = document.getElementById(videoIDs[transceivers.indexOf(e.transceiver)]);
+	if (video) video.srcObject = new MediaStream([e.track]);
+};
+// connection is closed on camera restart, new one is needed
+pc.onconnectionstatechange = () => {
+	if (pc.connectionState === "failed" || pc.connectionState === "closed") setTimeout(() => location.reload(), 2000);
+};
+const token = new URLSearchParams(location.search).get("token") || "";
+pc.createOffer().then(offer => pc.setLocalDescription(offer)).then(() => new Promise(resolve => {
+	if (pc.iceGatheringState === "complete") { resolve(); return; }
+	pc.onicegatheringstatechange = () => { if (pc.iceGatheringState === "complete") resolve(); };
+})).then(() => fetch("offer", {method: "POST", body: JSON.stringify(pc.localDescription), headers: {"Authorization": "Bearer " + token}}))
+	.then(resp => resp.json()).then(answer => pc.setRemoteDescription(answer));
+</script></body></html>`
+
+// Peer connection which isn't connected in time is closed, so abandoned offers don't keep camera streams
+const webRTCConnectTimeout = 30 * time.Second
+
+// Open peer connections with cancellation of their camera streams (cameras are captured at offer time)
+var webRTCPeers = make(map[*webrtc.PeerConnection]context.CancelFunc)
+var webRTCPeersMtx sync.Mutex
+
+// Stop camera streams of peer connection, close it and forget it
+func closeWebRTCPeer(pc *webrtc.PeerConnection) {
+	webRTCPeersMtx.Lock()
+	cancel, ok := webRTCPeers[pc]
+	delete(webRTCPeers, pc)
+	webRTCPeersMtx.Unlock()
+	if !ok { return }
+	cancel()
+	err := pc.Close()
+	if err != nil { log.Println("WebRTC connection closing error:", err) }
+}
+
+// Close all peer connections, so clients reconnect to replaced cameras
+func closeWebRTCPeers() {
+	webRTCPeersMtx.Lock()
+	var peers []*webrtc.PeerConnection
+	for pc := range webRTCPeers {
+		peers = append(peers, pc)
+	}
+	webRTCPeersMtx.Unlock()
+	for _, pc := range peers {
+		closeWebRTCPeer(pc)
+	}
+}
+
+// Send H264 stream chunks to track as samples until stream is exhausted
+func writeH264Track(track *webrtc.TrackLocalStaticSample, stream <-chan []byte, framerate uint) {
+	frameDuration := time.Second / time.Duration(framerate)
+	for data := range stream {
+		err := track.WriteSample(media.Sample{Data: data, Duration: frameDuration})
+		if err != nil {
+			log.Println("WebRTC sample writing error:", err)
+			return
+		}
+	}
+}
+
+// Create peer connection streaming both cameras for given offer and return answer with gathered candidates
+func answerWebRTCOffer(offer webrtc.SessionDescription) (*webrtc.SessionDescription, error) {
+	// LAN only: no STUN/TURN servers, host candidates are enough
+	pc, err := webrtc.NewPeerConnection(webrtc.Configuration{})
+	if err != nil { return nil, err }
+	ctx, cancel := context.WithCancel(context.Background())
+	webRTCPeersMtx.Lock()
+	webRTCPeers[pc] = cancel
+	webRTCPeersMtx.Unlock()
+	connectTimer := time.AfterFunc(webRTCConnectTimeout, func() {
+		log.Println("WebRTC connection isn't established in time, closing it")
+		closeWebRTCPeer(pc)
+	})
+	pc.OnConnectionStateChange(func(state webrtc.PeerConnectionState) {
+		log.Println("WebRTC connection state:", state)
+		switch state {
+			case webrtc.PeerConnectionStateConnected:
+				connectTimer.Stop()
+			case webrtc.PeerConnectionStateFailed, webrtc.PeerConnectionStateClosed, webrtc.PeerConnectionStateDisconnected:
+				connectTimer.Stop()
+				closeWebRTCPeer(pc)
+		}
+	})
+	failed := func(err error) (*webrtc.SessionDescription, error) {
+		connectTimer.Stop()
+		closeWebRTCPeer(pc)
+		return nil, err
+	}
+
+	// tracks take offered transceivers in order of viewer's video elements
+	nCam, irCam := Cameras()
+	for _, camIDPair := range []struct{cam Camera; id string}{{nCam, "n"}, {irCam, "ir"}} {
+		track, err := webrtc.NewTrackLocalStaticSample(webrtc.RTPCodecCapability{MimeType: webrtc.MimeTypeH264}, camIDPair.id, "irnc")
+		if err != nil { return failed(err) }
+		sender, err := pc.AddTrack(track)
+		if err != nil { return failed(err) }
+		go func() {
+			// RTCP must be read for interceptors to work
+			buf := make([]byte, 1500)
+			for {
+				if _, _, err := sender.Read(buf); err != nil { return }
+			}
+		}()
+		stream, err := camIDPair.cam.StreamH264(ctx)
+		if err != nil { return failed(err) }
+		go writeH264Track(track, stream, RecordingFramerate())
+	}
+
+	err = pc.SetRemoteDescription(offer)
+	if err != nil { return failed(err) }
+	answer, err := pc.CreateAnswer(nil)
+	if err != nil { return failed(err) }
+	gatheringComplete := webrtc.GatheringCompletePromise(pc)
+	err = pc.SetLocalDescription(answer)
+	if err != nil { return failed(err) }
+	select {
+		case <-gatheringComplete:
+		case <-time.After(GeneralExternalsExecutionTimeout):
+	}
+	return pc.LocalDescription(), nil
+}
+
+// GET /webrtc/ shows viewer page
+func handleWebRTCViewer(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write([]byte(webRTCViewerPage))
+}
+
+// POST /webrtc/offer accepts SDP offer and responds with SDP answer (no trickle ICE)
+func handleWebRTCOffer(w http.ResponseWriter, r *http.Request) {
+	var offer webrtc.SessionDescription
+	err := json.NewDecoder(r.Body).Decode(&offer)
+	if err != nil {
+		writeErrors(w, http.StatusBadRequest, err)
+		return
+	}
+	answer, err := answerWebRTCOffer(offer)
+	if err != nil {
+		writeErrors(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, answer)
+}
@@ -0,0 +1,47 @@
+package irnc
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+	"github.com/pion/webrtc/v3"
+)
+
+// Number of open peer connections
+func countWebRTCPeers() int {
+	webRTCPeersMtx.Lock()
+	defer webRTCPeersMtx.Unlock()
+	return len(webRTCPeers)
+}
+
+func TestCloseWebRTCPeers(t *testing.T) {
+	setupSequenceTest(t)
+	nCam, irCam := Cameras()
+	// offer like viewer page's one
+	client, err := webrtc.NewPeerConnection(webrtc.Configuration{})
+	if err != nil { t.Fatal(err) }
+	defer client.Close()
+	for i := 0; i < 2; i++ {
+		_, err = client.AddTransceiverFromKind(webrtc.RTPCodecTypeVideo, webrtc.RTPTransceiverInit{Direction: webrtc.RTPTransceiverDirectionRecvonly})
+		if err != nil { t.Fatal(err) }
+	}
+	offer, err := client.CreateOffer(nil)
+	if err != nil { t.Fatal(err) }
+	gatheringComplete := webrtc.GatheringCompletePromise(client)
+	if err = client.SetLocalDescription(offer); err != nil { t.Fatal(err) }
+	<-gatheringComplete
+
+	answer, err := answerWebRTCOffer(*client.LocalDescription())
+	if err != nil || answer == nil { t.Fatal("Answer expected, got", answer, err) }
+	streams := func() int32 {
+		return atomic.LoadInt32(&nCam.(*fakeCamera).streams) + atomic.LoadInt32(&irCam.(*fakeCamera).streams)
+	}
+	if countWebRTCPeers() != 1 || streams() != 2 { t.Fatal("Peer streaming both cameras expected, got", countWebRTCPeers(), streams()) }
+
+	// camera restart closes peers, they don't keep reading released cameras
+	closeWebRTCPeers()
+	for deadline := time.Now().Add(time.Second); streams() > 0 && time.Now().Before(deadline); {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if countWebRTCPeers() != 0 || streams() != 0 { t.Fatal("Peers aren't closed:", countWebRTCPeers(), streams()) }
+}
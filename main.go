@@ -1,9 +1,47 @@
 package main
 
-import "irnc"
+import (
+	"context"
+	"flag"
+	"irnc"
+	"irnc/ui"
+	"log"
+	"os/signal"
+	"syscall"
+)
 
 func main() {
+	headless := flag.Bool("headless", false, "run cameras and remote APIs without GUI (no display required)")
+	windowed := flag.Bool("windowed", false, "show GUI in resizable window instead of fullscreen (desktop use)")
+	rebuildCatalog := flag.Bool("rebuild-catalog", false, "rebuild capture catalog from files in capture root and exit")
+	flag.Parse()
+	
+	if *rebuildCatalog {
+		count, err := irnc.RebuildCatalog()
+		if err != nil { log.Fatal("Catalog rebuild error: ", err) }
+		log.Printf("Catalog is rebuilt from %d capture sets", count)
+		return
+	}
 	irnc.Init()
 	defer irnc.Finish()
-	irnc.RunGUI()
+	// SIGINT/SIGTERM lead to the same orderly shutdown as exit button
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	// as well as exit requested by physical inputs
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		select {
+			case <-irnc.ExitRequested():
+				cancel()
+			case <-ctx.Done():
+		}
+	}()
+	if *headless {
+		log.Println("Running headless")
+		<-ctx.Done()
+		log.Println("Termination requested")
+	} else {
+		ui.RunGUI(ctx, *windowed)
+	}
 }